@@ -0,0 +1,330 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	rtpprof "runtime/pprof"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jursonmo/gomonitor/model"
+	"github.com/shirou/gopsutil/process"
+)
+
+var cpuNum = expvar.NewInt("cpuNum")
+var threadNum = expvar.NewInt("threadNum")
+var grNum = expvar.NewInt("goroutineNum")
+var cgoCalls = expvar.NewInt("cgoCalls")
+var serial = expvar.NewString("serial")
+var runtimeName = expvar.NewString("runtime")
+
+// schemaVersion is the version of the layout of the runtime data, bumped
+// on incompatible changes
+var schemaVersion = expvar.NewInt("schemaVersion")
+var threadProfile = rtpprof.Lookup("threadcreate")
+
+var p, _ = process.NewProcess(int32(os.Getpid()))
+var memPercent = expvar.NewInt("memPercent")
+var cpuPercent = expvar.NewInt("cpuPercent")
+
+var started = time.Now()
+var clock = expvar.NewInt("clock")
+var monotonic = expvar.NewInt("monotonic")
+
+// seq numbers the samples delivered to a consumer, a sample which is not
+// delivered, e.g. answered by 304, is released and its number used again
+// unless a concurrent sample took the next one, so gaps mean lost
+// samples. Every consumer has its own sequence: a scraper is known by its
+// ConsumerHeader or else its host, a push by its url.
+var seq = expvar.NewInt("seq")
+var consumers = struct {
+	sync.Mutex
+	// taken is the last number taken by the consumer
+	taken map[string]int64
+}{taken: make(map[string]int64)}
+
+// ConsumerHeader names the consumer of the runtime data, for scrapers
+// sharing a host
+const ConsumerHeader = "X-Gomonitor-Consumer"
+
+// maxConsumers bounds the sequences remembered, a forgotten consumer
+// starts over which it sees as a restart
+const maxConsumers = 1024
+
+// sampleMu keeps the seq of a consumer and the rendering together
+var sampleMu sync.Mutex
+
+var procStart = processStart()
+var startTime = expvar.NewInt("startTime")
+var uptime = expvar.NewInt("uptime")
+
+// processStart returns when the process was created, falling back to
+// when the agent was initialized
+func processStart() time.Time {
+	if p != nil {
+		if ms, err := p.CreateTime(); err == nil {
+			return time.Unix(0, ms*int64(time.Millisecond))
+		}
+	}
+	return started
+}
+
+func init() {
+	schemaVersion.Set(1)
+	runtimeName.Set(model.RuntimeGo)
+}
+
+// SetSerial sets the serial reported with the runtime data
+func SetSerial(s string) {
+	serial.Set(s)
+}
+
+// Handler returns the handler serving the runtime data, usually at /debug/vars
+func Handler() http.Handler {
+	return http.HandlerFunc(exp)
+}
+
+func exp(w http.ResponseWriter, req *http.Request) {
+	consumer := consumerOf(req)
+	body, etag, n := sample(consumer)
+	w.Header().Set("ETag", etag)
+	if req.Header.Get("If-None-Match") == etag {
+		release(consumer, n)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	body, contentType, err := seal(body)
+	if err == nil {
+		err = sign(w.Header(), body)
+	}
+	if err != nil {
+		release(consumer, n)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Write(body)
+	countSent(len(body))
+}
+
+// consumerOf returns the consumer of the request
+func consumerOf(req *http.Request) string {
+	if c := req.Header.Get(ConsumerHeader); c != "" {
+		return c
+	}
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+// sample updates the runtime data and renders it with the seq of the
+// next sample of the consumer, which it takes and returns. A sample which
+// is not delivered must be released.
+func sample(consumer string) ([]byte, string, int64) {
+	end := measureCycle()
+	cpuNum.Set(int64(runtime.NumCPU()))
+	threadNum.Set(int64(threadProfile.Count()))
+	grNum.Set(int64(runtime.NumGoroutine()))
+	cgoCalls.Set(runtime.NumCgoCall())
+
+	mp, _ := p.MemoryPercent()
+	memPercent.Set(int64(mp))
+	// the second the CPU percent is measured over is not a cost
+	wait := time.Now()
+	var cp float64
+	// Percent keeps its last times in the process, so the concurrent
+	// samples measure with their own
+	if proc, err := process.NewProcess(int32(os.Getpid())); err == nil {
+		cp, _ = proc.Percent(time.Second)
+	}
+	cpuPercent.Set(int64(cp))
+	waited := time.Since(wait)
+
+	// sampled last, as close as possible to the response
+	now := time.Now()
+	clock.Set(now.UnixNano())
+	monotonic.Set(int64(time.Since(started)))
+	startTime.Set(procStart.Unix())
+	uptime.Set(int64(now.Sub(procStart) / time.Second))
+
+	n := take(consumer)
+
+	sampleMu.Lock()
+	defer sampleMu.Unlock()
+	seq.Set(n)
+	body, etag := render()
+	body = runProcessors(body)
+	end(waited)
+	return body, etag, n
+}
+
+// take takes the next number of the consumer, the concurrent samples of
+// a consumer get distinct numbers
+func take(consumer string) int64 {
+	consumers.Lock()
+	defer consumers.Unlock()
+	if _, ok := consumers.taken[consumer]; !ok && len(consumers.taken) >= maxConsumers {
+		for c := range consumers.taken {
+			delete(consumers.taken, c)
+			break
+		}
+	}
+	consumers.taken[consumer]++
+	return consumers.taken[consumer]
+}
+
+// release gives back the number n of a sample of the consumer which was
+// not delivered, unless a later sample took one
+func release(consumer string, n int64) {
+	consumers.Lock()
+	defer consumers.Unlock()
+	if consumers.taken[consumer] == n {
+		consumers.taken[consumer] = n - 1
+	}
+}
+
+// volatile vars change on every request, they are left out of the ETag
+var volatile = map[string]bool{
+	"clock":     true,
+	"monotonic": true,
+	"uptime":    true,
+	"seq":       true,
+	"overhead":  true,
+}
+
+// ETagPolicy decides when the ETag served by Handler changes. Counters
+// like TotalAlloc move on every request, so a number only changes it when
+// it moved by more than Threshold (0.01 is 1%) since the ETag was issued,
+// or at all for the Exact paths, e.g. "memstats.NumGC". Anything else
+// changes it when it differs. After MaxAge the ETag changes anyway, so a
+// consumer gets a full payload at least that often.
+type ETagPolicy struct {
+	Threshold float64
+	Exact     []string
+	MaxAge    time.Duration
+}
+
+var DefaultETagPolicy = ETagPolicy{
+	Threshold: 0.01,
+	Exact:     []string{"memstats.NumGC", "memstats.LastGC", "panics"},
+	MaxAge:    time.Minute,
+}
+
+// etag is the ETag issued last and the values it was issued for
+var etag = struct {
+	sync.Mutex
+	policy ETagPolicy
+	tag    string
+	values map[string]float64
+	other  uint64
+	issued time.Time
+}{policy: DefaultETagPolicy}
+
+// SetETagPolicy sets the policy of the ETag
+func SetETagPolicy(p ETagPolicy) {
+	etag.Lock()
+	defer etag.Unlock()
+	etag.policy = p
+	etag.tag = ""
+}
+
+// render returns the published vars as JSON, like the expvar handler,
+// and a weak ETag of the vars which are not volatile
+func render() ([]byte, string) {
+	values := make(map[string]float64)
+	other := fnv.New64a()
+	body := renderVars(values, other)
+	return body, currentETag(values, other.Sum64())
+}
+
+// renderVars returns the published vars as JSON, collecting the values
+// of the ETag of the vars which are not volatile unless values is nil
+func renderVars(values map[string]float64, other io.Writer) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("{\n")
+	first := true
+	expvar.Do(func(kv expvar.KeyValue) {
+		if !first {
+			buf.WriteString(",\n")
+		}
+		first = false
+		v := kv.Value.String()
+		fmt.Fprintf(&buf, "%q: %s", kv.Key, v)
+		if values != nil && !volatile[kv.Key] {
+			var x interface{}
+			dec := json.NewDecoder(strings.NewReader(v))
+			dec.UseNumber()
+			dec.Decode(&x)
+			etagValues(values, other, kv.Key, x)
+		}
+	})
+	buf.WriteString("\n}\n")
+	return buf.Bytes()
+}
+
+// etagValues collects the numbers of v by path and hashes the rest
+func etagValues(values map[string]float64, other io.Writer, path string, v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			// per size class counters move all the time and are not reported
+			if k != "BySize" {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			etagValues(values, other, path+"."+k, v[k])
+		}
+	case []interface{}:
+		for i, e := range v {
+			etagValues(values, other, path+"."+strconv.Itoa(i), e)
+		}
+	case json.Number:
+		f, _ := v.Float64()
+		values[path] = f
+	default:
+		fmt.Fprintf(other, "%s=%v\n", path, v)
+	}
+}
+
+// currentETag returns the ETag issued last, or a new one when the values
+// changed by the policy
+func currentETag(values map[string]float64, other uint64) string {
+	etag.Lock()
+	defer etag.Unlock()
+	p := etag.policy
+	now := time.Now()
+	if etag.tag != "" && other == etag.other && len(values) == len(etag.values) &&
+		(p.MaxAge <= 0 || now.Sub(etag.issued) < p.MaxAge) && !p.moved(etag.values, values) {
+		return etag.tag
+	}
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%d %d", now.UnixNano(), other)
+	etag.tag = fmt.Sprintf(`W/"%x"`, h.Sum64())
+	etag.values, etag.other, etag.issued = values, other, now
+	return etag.tag
+}
+
+func (p ETagPolicy) moved(last, current map[string]float64) bool {
+	for _, k := range p.Exact {
+		if last[k] != current[k] {
+			return true
+		}
+	}
+	return changed(last, current, p.Threshold)
+}
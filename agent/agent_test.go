@@ -0,0 +1,57 @@
+package agent
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestSeqConcurrent(t *testing.T) {
+	const n = 8
+	seqs := make(chan int64, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodGet, "/debug/vars", nil)
+			req.Header.Set(ConsumerHeader, "concurrent")
+			w := httptest.NewRecorder()
+			Handler().ServeHTTP(w, req)
+			var vars struct {
+				Seq int64 `json:"seq"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &vars); err != nil {
+				t.Error(err)
+			}
+			seqs <- vars.Seq
+		}()
+	}
+	wg.Wait()
+	close(seqs)
+
+	seen := make(map[int64]bool)
+	for s := range seqs {
+		if seen[s] || s < 1 || s > n {
+			t.Errorf("seq %d served twice or out of 1..%d", s, n)
+		}
+		seen[s] = true
+	}
+}
+
+func TestSeqReleased(t *testing.T) {
+	a := take("released")
+	b := take("released")
+	// b was not delivered, its number is used again
+	release("released", b)
+	if got := take("released"); got != b {
+		t.Errorf("took %d after releasing %d", got, b)
+	}
+	// a concurrent sample took a later number, a is lost
+	release("released", a)
+	if got := take("released"); got != b+1 {
+		t.Errorf("took %d after releasing %d, want %d", got, a, b+1)
+	}
+}
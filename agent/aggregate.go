@@ -0,0 +1,120 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AggregateHandler returns a handler which scrapes the runtime data of
+// sibling processes and serves them as one JSON array, so that several
+// local apps can be collected through a single exposed endpoint.
+// A target is either an http url or a unix socket "unix:///path/app.sock",
+// for which /debug/vars is requested. Failed targets, and targets whose
+// body is not JSON, are left out and their error is reported in the
+// aggregateErrors var until they answer again.
+func AggregateHandler(targets []string, timeout time.Duration) http.Handler {
+	return AggregateTokenHandler(targets, timeout, "")
+}
+
+// AggregateTokenHandler is AggregateHandler sending the bearer token to
+// the targets unless it is empty
+func AggregateTokenHandler(targets []string, timeout time.Duration, token string) http.Handler {
+	clients := make([]*http.Client, len(targets))
+	urls := make([]string, len(targets))
+	for i, t := range targets {
+		clients[i], urls[i] = newTargetClient(t, timeout)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		// the siblings number the samples of the consumer behind us
+		consumer := consumerOf(req)
+		payloads := make([][]byte, len(targets))
+		var wg sync.WaitGroup
+		for i := range targets {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				p, err := fetch(clients[i], urls[i], consumer, token)
+				if err == nil && !json.Valid(p) {
+					err = fmt.Errorf("invalid json body from %s", urls[i])
+				}
+				if err != nil {
+					msg := new(expvar.String)
+					msg.Set(err.Error())
+					aggregateErrors.Set(targets[i], msg)
+					return
+				}
+				aggregateErrors.Delete(targets[i])
+				payloads[i] = p
+			}(i)
+		}
+		wg.Wait()
+
+		var buf bytes.Buffer
+		buf.WriteByte('[')
+		n := 0
+		for _, p := range payloads {
+			if p == nil {
+				continue
+			}
+			if n > 0 {
+				buf.WriteByte(',')
+			}
+			buf.Write(p)
+			n++
+		}
+		buf.WriteByte(']')
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Write(buf.Bytes())
+	})
+}
+
+var aggregateErrors = expvar.NewMap("aggregateErrors")
+
+func newTargetClient(target string, timeout time.Duration) (*http.Client, string) {
+	if !strings.HasPrefix(target, "unix://") {
+		return &http.Client{Timeout: timeout}, target
+	}
+
+	sock := strings.TrimPrefix(target, "unix://")
+	var d net.Dialer
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return d.DialContext(ctx, "unix", sock)
+			},
+		},
+		Timeout: timeout,
+	}, "http://unix/debug/vars"
+}
+
+func fetch(client *http.Client, url, consumer, token string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(ConsumerHeader, consumer)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("received status code %d from %s", resp.StatusCode, url)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
@@ -0,0 +1,161 @@
+package agent
+
+import (
+	"expvar"
+	"math"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jursonmo/gomonitor/model"
+)
+
+// AllocSampler attributes the allocation rate to the Top functions
+// allocating the most, from the heap profile read every Interval. The
+// profile samples an allocation every runtime.MemProfileRate bytes and is
+// as of the last gc, the rates are estimates.
+type AllocSampler struct {
+	Top      int
+	Interval time.Duration
+}
+
+var DefaultAllocSampler = AllocSampler{
+	Top:      10,
+	Interval: 10 * time.Second,
+}
+
+var allocSites struct {
+	sync.Mutex
+	sites []model.AllocSite
+}
+
+func init() {
+	expvar.Publish("allocSites", expvar.Func(func() interface{} {
+		allocSites.Lock()
+		defer allocSites.Unlock()
+		return allocSites.sites
+	}))
+}
+
+// siteTotals are the bytes and objects allocated by a function
+type siteTotals struct {
+	bytes, objects int64
+}
+
+// StartAllocSampler starts the sampler, the returned func stops it. A zero
+// Top or Interval is the one of DefaultAllocSampler.
+func StartAllocSampler(s AllocSampler) (stop func()) {
+	if s.Top <= 0 {
+		s.Top = DefaultAllocSampler.Top
+	}
+	if s.Interval <= 0 {
+		s.Interval = DefaultAllocSampler.Interval
+	}
+	done := make(chan struct{})
+	go func() {
+		prev, at := allocTotals(), time.Now()
+		t := time.NewTicker(s.Interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+			}
+			// a skipped run makes the next one cover a longer interval
+			budgeted("alloc_sites", func() {
+				cur, now := allocTotals(), time.Now()
+				sites := topAllocSites(prev, cur, now.Sub(at), s.Top)
+				allocSites.Lock()
+				allocSites.sites = sites
+				allocSites.Unlock()
+				prev, at = cur, now
+			})
+		}
+	}()
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
+
+// allocTotals returns the bytes and objects allocated since the start by
+// function, the first frame of the stack outside of the runtime
+func allocTotals() map[string]siteTotals {
+	var records []runtime.MemProfileRecord
+	n, _ := runtime.MemProfile(nil, true)
+	for {
+		// room for the records added in between
+		records = make([]runtime.MemProfileRecord, n+50)
+		var ok bool
+		n, ok = runtime.MemProfile(records, true)
+		if ok {
+			records = records[:n]
+			break
+		}
+	}
+
+	totals := make(map[string]siteTotals)
+	for i := range records {
+		r := &records[i]
+		fn := allocFunction(r.Stack())
+		bytes, objects := scaleAllocSample(r.AllocBytes, r.AllocObjects)
+		t := totals[fn]
+		t.bytes += bytes
+		t.objects += objects
+		totals[fn] = t
+	}
+	return totals
+}
+
+// scaleAllocSample estimates the allocations a sample stands for, like
+// pprof: an allocation of size s is sampled with probability
+// 1-exp(-s/MemProfileRate)
+func scaleAllocSample(bytes, objects int64) (int64, int64) {
+	rate := runtime.MemProfileRate
+	if objects == 0 || rate <= 1 {
+		return bytes, objects
+	}
+	size := float64(bytes) / float64(objects)
+	scale := 1 / (1 - math.Exp(-size/float64(rate)))
+	return int64(float64(bytes) * scale), int64(float64(objects) * scale)
+}
+
+func allocFunction(stack []uintptr) string {
+	frames := runtime.CallersFrames(stack)
+	for {
+		f, more := frames.Next()
+		if !strings.HasPrefix(f.Function, "runtime.") {
+			return f.Function
+		}
+		if !more {
+			return f.Function
+		}
+	}
+}
+
+// topAllocSites returns the top functions by bytes allocated per second
+// between the totals
+func topAllocSites(prev, cur map[string]siteTotals, d time.Duration, top int) []model.AllocSite {
+	secs := d.Seconds()
+	if secs <= 0 {
+		return nil
+	}
+	sites := make([]model.AllocSite, 0, len(cur))
+	for fn, t := range cur {
+		p := prev[fn]
+		if t.bytes <= p.bytes {
+			continue
+		}
+		sites = append(sites, model.AllocSite{
+			Function:      fn,
+			BytesPerSec:   float64(t.bytes-p.bytes) / secs,
+			ObjectsPerSec: float64(t.objects-p.objects) / secs,
+		})
+	}
+	sort.Slice(sites, func(i, j int) bool { return sites[i].BytesPerSec > sites[j].BytesPerSec })
+	if len(sites) > top {
+		sites = sites[:top]
+	}
+	return sites
+}
@@ -0,0 +1,151 @@
+package agent
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// maxAudit is how many audit records are kept in memory and served on
+// /control/audit, the oldest are evicted beyond. The file is the
+// append-only record, it keeps all of them.
+const maxAudit = 1024
+
+// auditMaxBytes is the size the audit file is rotated at, renamed with
+// the time of the rotation. The rotated files are never removed.
+var auditMaxBytes int64 = 64 << 20
+
+// maxUnauthorized is how many unauthorized requests are audited per
+// minute, the others are only counted, so unauthenticated callers cannot
+// fill the disk
+const maxUnauthorized = 60
+
+var (
+	auditMu   sync.Mutex
+	audit     = make([]Event, 0, maxAudit)
+	auditNext int // the oldest record once audit is full
+	auditFile *os.File
+	auditPath string
+	auditSize int64
+
+	// the unauthorized requests audited in the current minute, and the
+	// ones which were not
+	unauthorizedMinute     time.Time
+	unauthorized           int
+	unauthorizedSuppressed int
+)
+
+// auditErrors counts the records which could not be written to the file
+var auditErrors = expvar.NewInt("auditErrors")
+
+// auditSuppressed counts the unauthorized requests which were not audited
+var auditSuppressed = expvar.NewInt("auditSuppressed")
+
+// SetAuditFile appends every audit record as a JSON line to path, in
+// addition to keeping the recent ones in memory. The file set before is
+// closed.
+func SetAuditFile(path string) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	auditMu.Lock()
+	prev := auditFile
+	auditFile, auditPath, auditSize = f, path, fi.Size()
+	auditMu.Unlock()
+	if prev != nil {
+		return prev.Close()
+	}
+	return nil
+}
+
+// recordUnauthorized audits an unauthorized request, up to
+// maxUnauthorized a minute. The count of the ones left out is audited
+// with the next one audited.
+func recordUnauthorized(who, action string) {
+	now := time.Now()
+	auditMu.Lock()
+	if minute := now.Truncate(time.Minute); !minute.Equal(unauthorizedMinute) {
+		unauthorizedMinute, unauthorized = minute, 0
+	}
+	unauthorized++
+	if unauthorized > maxUnauthorized {
+		unauthorizedSuppressed++
+		auditMu.Unlock()
+		auditSuppressed.Add(1)
+		return
+	}
+	suppressed := unauthorizedSuppressed
+	unauthorizedSuppressed = 0
+	auditMu.Unlock()
+
+	if suppressed > 0 {
+		recordAction("agent", "audit", fmt.Sprintf("%d unauthorized requests not audited", suppressed), false)
+	}
+	recordAction(who, action, "unauthorized", false)
+}
+
+// recordAction audits a control or diagnostic action and reports it as
+// an event
+func recordAction(who, action, result string, ok bool) {
+	e := recordEvent(who, action, result, ok)
+
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	if len(audit) < maxAudit {
+		audit = append(audit, e)
+	} else {
+		audit[auditNext] = e
+		auditNext = (auditNext + 1) % maxAudit
+	}
+	if auditFile == nil {
+		return
+	}
+	b, err := json.Marshal(e)
+	if err == nil && auditSize+int64(len(b))+1 > auditMaxBytes && auditSize > 0 {
+		err = rotateAudit()
+	}
+	if err == nil {
+		var n int
+		n, err = auditFile.Write(append(b, '\n'))
+		auditSize += int64(n)
+	}
+	if err != nil {
+		auditErrors.Add(1)
+		recordEvent("agent", "audit", err.Error(), false)
+	}
+}
+
+func serveAudit(w http.ResponseWriter) {
+	auditMu.Lock()
+	records := append(append([]Event(nil), audit[auditNext:]...), audit[:auditNext]...)
+	auditMu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(records)
+}
+
+// rotateAudit renames the audit file with the time and opens a new one,
+// auditMu is held
+func rotateAudit() error {
+	rotated := fmt.Sprintf("%s.%s", auditPath, time.Now().UTC().Format("20060102T150405.000000000Z"))
+	if err := os.Rename(auditPath, rotated); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(auditPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	auditFile.Close()
+	auditFile, auditSize = f, 0
+	return nil
+}
@@ -0,0 +1,90 @@
+package agent
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAuditUnauthorizedLimit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	setAuditFile(t, path)
+	before := auditSuppressed.Value()
+	for i := 0; i < 3*maxUnauthorized; i++ {
+		recordUnauthorized("anonymous@test", "gc-now")
+	}
+	lines := readLines(t, path)
+	suppressed := auditSuppressed.Value() - before
+	// the minute may have turned during the loop
+	if len(lines) > 2*maxUnauthorized+1 || suppressed < maxUnauthorized {
+		t.Errorf("%d records, %d suppressed of %d unauthorized requests", len(lines), suppressed, 3*maxUnauthorized)
+	}
+}
+
+func TestAuditRotation(t *testing.T) {
+	defer func(max int64) { auditMaxBytes = max }(auditMaxBytes)
+	auditMaxBytes = 512
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "audit.log")
+	setAuditFile(t, path)
+	const n = 20
+	for i := 0; i < n; i++ {
+		recordAction("operator@test", "gc-now", "gc done", true)
+	}
+
+	files, err := filepath.Glob(path + "*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) < 2 {
+		t.Fatalf("files %v, want the audit file rotated", files)
+	}
+	records := 0
+	for _, f := range files {
+		fi, err := os.Stat(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Size() > auditMaxBytes {
+			t.Errorf("%s: %d bytes over %d", f, fi.Size(), auditMaxBytes)
+		}
+		records += len(readLines(t, f))
+	}
+	// the rotated files are kept, no record is lost
+	if records != n {
+		t.Errorf("%d records in %d files, want %d", records, len(files), n)
+	}
+}
+
+// setAuditFile audits to path until the test ends
+func setAuditFile(t *testing.T, path string) {
+	if err := SetAuditFile(path); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		auditMu.Lock()
+		defer auditMu.Unlock()
+		auditFile.Close()
+		auditFile = nil
+	})
+}
+
+func readLines(t *testing.T, path string) []string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
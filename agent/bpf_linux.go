@@ -0,0 +1,213 @@
+//go:build linux && gomonitor_ebpf
+// +build linux,gomonitor_ebpf
+
+package agent
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"runtime"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// bpfInsn is an instruction of the eBPF virtual machine
+type bpfInsn struct {
+	code uint8
+	regs uint8 // dst | src<<4
+	off  int16
+	imm  int32
+}
+
+// opcodes, see Documentation/bpf/instruction-set.rst in the kernel
+const (
+	bpfLD    = 0x00
+	bpfLDX   = 0x01
+	bpfST    = 0x02
+	bpfSTX   = 0x03
+	bpfJMP   = 0x05
+	bpfALU64 = 0x07
+
+	bpfW  = 0x00
+	bpfH  = 0x08
+	bpfDW = 0x18
+
+	bpfIMM    = 0x00
+	bpfMEM    = 0x60
+	bpfATOMIC = 0xc0
+
+	bpfK = 0x00
+	bpfX = 0x08
+
+	bpfADD = 0x00
+	bpfSUB = 0x10
+	bpfRSH = 0x70
+	bpfMOV = 0xb0
+
+	bpfJEQ  = 0x10
+	bpfJNE  = 0x50
+	bpfCALL = 0x80
+	bpfEXIT = 0x90
+
+	bpfPseudoMapFD = 1
+)
+
+// helpers, see include/uapi/linux/bpf.h
+const (
+	helperMapLookupElem     = 1
+	helperMapUpdateElem     = 2
+	helperMapDeleteElem     = 3
+	helperKtimeGetNs        = 5
+	helperGetCurrentPidTgid = 14
+)
+
+// toExit is the offset of a jump to the exit of the program, set by exit
+const toExit = math.MinInt16
+
+func regs(dst, src uint8) uint8 { return dst | src<<4 }
+
+func mov(dst, src uint8) bpfInsn {
+	return bpfInsn{code: bpfALU64 | bpfMOV | bpfX, regs: regs(dst, src)}
+}
+
+func movImm(dst uint8, imm int32) bpfInsn {
+	return bpfInsn{code: bpfALU64 | bpfMOV | bpfK, regs: dst, imm: imm}
+}
+
+func aluImm(op, dst uint8, imm int32) bpfInsn {
+	return bpfInsn{code: bpfALU64 | op | bpfK, regs: dst, imm: imm}
+}
+
+func aluReg(op, dst, src uint8) bpfInsn {
+	return bpfInsn{code: bpfALU64 | op | bpfX, regs: regs(dst, src)}
+}
+
+func jmpImm(op, dst uint8, imm int32, off int16) bpfInsn {
+	return bpfInsn{code: bpfJMP | op | bpfK, regs: dst, off: off, imm: imm}
+}
+
+// load is dst = *(size *)(src + off)
+func load(size, dst, src uint8, off int16) bpfInsn {
+	return bpfInsn{code: bpfLDX | bpfMEM | size, regs: regs(dst, src), off: off}
+}
+
+// store is *(size *)(dst + off) = src
+func store(size, dst, src uint8, off int16) bpfInsn {
+	return bpfInsn{code: bpfSTX | bpfMEM | size, regs: regs(dst, src), off: off}
+}
+
+func storeImm(size, dst uint8, off int16, imm int32) bpfInsn {
+	return bpfInsn{code: bpfST | bpfMEM | size, regs: dst, off: off, imm: imm}
+}
+
+// atomicAdd is *(u64 *)(dst + off) += src
+func atomicAdd(dst, src uint8, off int16) bpfInsn {
+	return bpfInsn{code: bpfSTX | bpfATOMIC | bpfDW, regs: regs(dst, src), off: off, imm: bpfADD}
+}
+
+// loadMap loads the map fd into dst, it takes two instructions
+func loadMap(dst uint8, fd int) []bpfInsn {
+	return []bpfInsn{
+		{code: bpfLD | bpfIMM | bpfDW, regs: regs(dst, bpfPseudoMapFD), imm: int32(fd)},
+		{},
+	}
+}
+
+func call(helper int32) bpfInsn {
+	return bpfInsn{code: bpfJMP | bpfCALL, imm: helper}
+}
+
+// exit ends the program returning 0, resolving the jumps to it
+func exit(p []bpfInsn) []bpfInsn {
+	for i := range p {
+		if p[i].off == toExit && p[i].code&0x07 == bpfJMP {
+			p[i].off = int16(len(p) - i - 1)
+		}
+	}
+	return append(p, movImm(0, 0), bpfInsn{code: bpfJMP | bpfEXIT})
+}
+
+func bpf(cmd int, attr unsafe.Pointer, size uintptr) (int, error) {
+	fd, _, errno := unix.Syscall(unix.SYS_BPF, uintptr(cmd), uintptr(attr), size)
+	if errno != 0 {
+		return -1, errno
+	}
+	return int(fd), nil
+}
+
+func bpfMapCreate(typ, keySize, valueSize, entries uint32) (int, error) {
+	attr := struct {
+		typ, keySize, valueSize, entries, flags uint32
+	}{typ, keySize, valueSize, entries, 0}
+	fd, err := bpf(unix.BPF_MAP_CREATE, unsafe.Pointer(&attr), unsafe.Sizeof(attr))
+	if err != nil {
+		return -1, fmt.Errorf("ebpf: map: %v", err)
+	}
+	return fd, nil
+}
+
+type bpfMapElem struct {
+	fd    uint32
+	_     uint32
+	key   uint64
+	value uint64
+	flags uint64
+}
+
+func bpfMapLookup(fd int, key, value unsafe.Pointer) error {
+	attr := bpfMapElem{fd: uint32(fd), key: uint64(uintptr(key)), value: uint64(uintptr(value))}
+	_, err := bpf(unix.BPF_MAP_LOOKUP_ELEM, unsafe.Pointer(&attr), unsafe.Sizeof(attr))
+	runtime.KeepAlive(key)
+	runtime.KeepAlive(value)
+	return err
+}
+
+func bpfMapUpdate(fd int, key, value unsafe.Pointer) error {
+	attr := bpfMapElem{fd: uint32(fd), key: uint64(uintptr(key)), value: uint64(uintptr(value))}
+	_, err := bpf(unix.BPF_MAP_UPDATE_ELEM, unsafe.Pointer(&attr), unsafe.Sizeof(attr))
+	runtime.KeepAlive(key)
+	runtime.KeepAlive(value)
+	return err
+}
+
+func bpfMapDelete(fd int, key unsafe.Pointer) error {
+	attr := bpfMapElem{fd: uint32(fd), key: uint64(uintptr(key))}
+	_, err := bpf(unix.BPF_MAP_DELETE_ELEM, unsafe.Pointer(&attr), unsafe.Sizeof(attr))
+	runtime.KeepAlive(key)
+	return err
+}
+
+// bpfProgLoad loads a tracepoint program, the error has the log of the
+// verifier
+func bpfProgLoad(insns []bpfInsn) (int, error) {
+	license := []byte("GPL\x00")
+	log := make([]byte, 1<<16)
+	attr := struct {
+		typ, insnCnt      uint32
+		insns, license    uint64
+		logLevel, logSize uint32
+		logBuf            uint64
+		kernVersion       uint32
+		flags             uint32
+	}{
+		typ:      unix.BPF_PROG_TYPE_TRACEPOINT,
+		insnCnt:  uint32(len(insns)),
+		insns:    uint64(uintptr(unsafe.Pointer(&insns[0]))),
+		license:  uint64(uintptr(unsafe.Pointer(&license[0]))),
+		logLevel: 1,
+		logSize:  uint32(len(log)),
+		logBuf:   uint64(uintptr(unsafe.Pointer(&log[0]))),
+	}
+	fd, err := bpf(unix.BPF_PROG_LOAD, unsafe.Pointer(&attr), unsafe.Sizeof(attr))
+	runtime.KeepAlive(insns)
+	runtime.KeepAlive(license)
+	if err != nil {
+		if i := bytes.IndexByte(log, 0); i > 0 {
+			return -1, fmt.Errorf("%v: %s", err, bytes.TrimSpace(log[:i]))
+		}
+		return -1, err
+	}
+	return fd, nil
+}
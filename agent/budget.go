@@ -0,0 +1,165 @@
+package agent
+
+import (
+	"expvar"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/jursonmo/gomonitor/model"
+)
+
+// Budget bounds the overhead of the expensive collectors: the goroutine
+// dumps of the watchdog, the alloc sampler and the captured profiles.
+// Every run is measured, its CPU time on linux and the bytes allocated by
+// the process meanwhile, and while the spend of a collector over the last
+// Window exceeds CPUPercent of a CPU or AllocRate bytes per second its
+// runs are skipped, which throttles it to the rate the budget allows. A
+// zero CPUPercent or AllocRate does not bound it. The allocations of the
+// app during a run are counted too, a long run like a CPU profile may
+// exceed an AllocRate on its own.
+type Budget struct {
+	CPUPercent float64
+	AllocRate  float64
+	Window     time.Duration
+}
+
+var DefaultBudget = Budget{
+	CPUPercent: 1,
+	Window:     time.Minute,
+}
+
+// budgetResume is the part of the budget under which a throttled
+// collector resumes
+const budgetResume = 0.8
+
+// collectorSpend are the runs of a collector within the window
+type collectorSpend struct {
+	runs      []collectorRun
+	throttled bool
+	reason    string
+	skipped   int64
+}
+
+type collectorRun struct {
+	at     time.Time
+	cpuNs  int64
+	allocs int64
+}
+
+var budgets = struct {
+	sync.Mutex
+	budget     Budget
+	collectors map[string]*collectorSpend
+}{budget: DefaultBudget, collectors: make(map[string]*collectorSpend)}
+
+func init() {
+	expvar.Publish("budget", expvar.Func(func() interface{} {
+		budgets.Lock()
+		defer budgets.Unlock()
+		if len(budgets.collectors) == 0 {
+			return nil
+		}
+		now := time.Now()
+		m := make(map[string]model.CollectorBudget, len(budgets.collectors))
+		for name, c := range budgets.collectors {
+			cpu, allocs := c.spend(now, budgets.budget.Window)
+			m[name] = model.CollectorBudget{
+				CPUPercent: cpu,
+				AllocRate:  allocs,
+				Throttled:  c.throttled,
+				Reason:     c.reason,
+				Skipped:    c.skipped,
+			}
+		}
+		return m
+	}))
+}
+
+// SetBudget sets the budget of the expensive collectors. A zero Window is
+// the one of DefaultBudget.
+func SetBudget(b Budget) {
+	if b.Window <= 0 {
+		b.Window = DefaultBudget.Window
+	}
+	budgets.Lock()
+	budgets.budget = b
+	budgets.Unlock()
+}
+
+// budgeted runs f as a run of the collector unless the collector is over
+// the budget, which is the error
+func budgeted(name string, f func()) error {
+	if err := allowRun(name, time.Now()); err != nil {
+		return err
+	}
+	runtime.LockOSThread()
+	cpu := threadCPUNs()
+	allocs := heapAllocs()
+	f()
+	run := collectorRun{at: time.Now(), cpuNs: threadCPUNs() - cpu, allocs: heapAllocs() - allocs}
+	runtime.UnlockOSThread()
+
+	budgets.Lock()
+	c := budgets.collectors[name]
+	c.runs = append(c.runs, run)
+	budgets.Unlock()
+	return nil
+}
+
+// allowRun fails when the collector is over the budget, reporting the
+// start and the end of its throttling as events
+func allowRun(name string, now time.Time) error {
+	budgets.Lock()
+	defer budgets.Unlock()
+	b := budgets.budget
+	c, ok := budgets.collectors[name]
+	if !ok {
+		c = &collectorSpend{}
+		budgets.collectors[name] = c
+	}
+	cpu, allocs := c.spend(now, b.Window)
+	// a throttled collector resumes under a lower bound, not to flap
+	// around the budget
+	slack := 1.0
+	if c.throttled {
+		slack = budgetResume
+	}
+	reason := ""
+	switch {
+	case b.CPUPercent > 0 && cpu > b.CPUPercent*slack:
+		reason = fmt.Sprintf("cpu %.2f%% over the budget of %g%% in %s", cpu, b.CPUPercent, b.Window)
+	case b.AllocRate > 0 && allocs > b.AllocRate*slack:
+		reason = fmt.Sprintf("allocations of %.0f B/s over the budget of %g B/s in %s", allocs, b.AllocRate, b.Window)
+	}
+	if reason != "" {
+		if !c.throttled {
+			c.throttled, c.reason = true, reason
+			recordEvent("budget", name, reason, false)
+		}
+		c.skipped++
+		return fmt.Errorf("%s throttled: %s", name, c.reason)
+	}
+	if c.throttled {
+		c.throttled, c.reason = false, ""
+		recordEvent("budget", name, "within the budget", true)
+	}
+	return nil
+}
+
+// spend drops the runs out of the window and returns the percent of a
+// CPU and the bytes per second spent within it
+func (c *collectorSpend) spend(now time.Time, window time.Duration) (cpu, allocs float64) {
+	i := 0
+	for i < len(c.runs) && now.Sub(c.runs[i].at) > window {
+		i++
+	}
+	c.runs = c.runs[i:]
+	var cpuNs, bytes int64
+	for _, r := range c.runs {
+		cpuNs += r.cpuNs
+		bytes += r.allocs
+	}
+	return float64(cpuNs) / float64(window) * 100, float64(bytes) / window.Seconds()
+}
@@ -0,0 +1,184 @@
+package agent
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/jursonmo/gomonitor/model"
+	"github.com/jursonmo/gomonitor/websocket"
+)
+
+// Channel keeps a WebSocket connection to a collector, dialed out so it
+// traverses NAT and firewalls, redialed with a backoff up to RetryMax.
+// The runtime data is sent every Interval, sealed and signed like a push,
+// and the collector runs the actions of Allow on the agent, as with the
+// control API, and sends configs, in the format of the config file. The
+// actions and configs are audited with the url of the collector.
+type Channel struct {
+	URL       string
+	Header    http.Header
+	TLSConfig *tls.Config
+	Interval  time.Duration
+	RetryMax  time.Duration
+
+	Allow      []string
+	ProfileDir string
+}
+
+var DefaultChannel = Channel{
+	Interval: 10 * time.Second,
+	RetryMax: time.Minute,
+}
+
+// StartChannel starts keeping the channel, the returned func closes it.
+// A zero Interval or RetryMax is the one of DefaultChannel.
+func StartChannel(ch Channel) (stop func()) {
+	if ch.Interval <= 0 {
+		ch.Interval = DefaultChannel.Interval
+	}
+	if ch.RetryMax <= 0 {
+		ch.RetryMax = DefaultChannel.RetryMax
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		backoff := time.Second
+		for ctx.Err() == nil {
+			start := time.Now()
+			ch.serve(ctx)
+			if time.Since(start) > ch.RetryMax {
+				backoff = time.Second
+			}
+			select {
+			case <-ctx.Done():
+			case <-time.After(backoff):
+			}
+			if backoff *= 2; backoff > ch.RetryMax {
+				backoff = ch.RetryMax
+			}
+		}
+	}()
+	return cancel
+}
+
+// serve dials the collector and serves the channel until it breaks
+func (ch *Channel) serve(ctx context.Context) {
+	dialCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	conn, err := websocket.Dial(dialCtx, ch.URL, ch.Header, ch.TLSConfig)
+	cancel()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	hello := model.ChannelMessage{Type: model.ChannelHello, Serial: serial.Value(), Version: remoteConfigVersion()}
+	if send(conn, hello) != nil {
+		return
+	}
+	go ch.sendData(conn, done)
+	for {
+		b, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var m model.ChannelMessage
+		if json.Unmarshal(b, &m) != nil {
+			continue
+		}
+		switch m.Type {
+		case model.ChannelCommand:
+			// an action may take a while, e.g. a cpu profile
+			go func() {
+				if send(conn, ch.run(m)) != nil {
+					conn.Close()
+				}
+			}()
+		case model.ChannelConfig, model.ChannelRollback:
+			if send(conn, ch.configure(m)) != nil {
+				return
+			}
+		}
+	}
+}
+
+// sendData sends the runtime data every Interval, a failing write
+// breaks the channel
+func (ch *Channel) sendData(conn *websocket.Conn, done chan struct{}) {
+	consumer := "channel " + ch.URL
+	t := time.NewTicker(ch.Interval)
+	defer t.Stop()
+	for {
+		body, _, n := sample(consumer)
+		m := model.ChannelMessage{Type: model.ChannelData}
+		var err error
+		m.Payload, m.ContentType, err = seal(body)
+		if err == nil {
+			h := http.Header{}
+			if err = sign(h, m.Payload); err == nil {
+				m.Signature = h.Get(model.SignatureHeader)
+			}
+		}
+		if err == nil {
+			if err = send(conn, m); err != nil {
+				release(consumer, n)
+				conn.Close()
+				return
+			}
+			countSent(len(m.Payload))
+		} else {
+			release(consumer, n)
+		}
+		select {
+		case <-done:
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// run runs the action of a command if allowed
+func (ch *Channel) run(m model.ChannelMessage) model.ChannelMessage {
+	res := model.ChannelMessage{Type: model.ChannelResult, ID: m.ID}
+	who := "channel@" + ch.URL
+	c := Control{Allow: ch.Allow, ProfileDir: ch.ProfileDir}
+	act, ok := actions[m.Action]
+	if !ok || !c.allowed(m.Action) {
+		recordAction(who, m.Action, "action not allowed", false)
+		res.Result = "action not allowed"
+		return res
+	}
+	form := url.Values{}
+	for k, v := range m.Args {
+		form.Set(k, v)
+	}
+	result, err := act(&c, &http.Request{Method: http.MethodPost, Form: form})
+	if err != nil {
+		recordAction(who, m.Action, err.Error(), false)
+		res.Result = err.Error()
+		return res
+	}
+	recordAction(who, m.Action, result, true)
+	res.OK, res.Result = true, result
+	return res
+}
+
+func send(conn *websocket.Conn, m model.ChannelMessage) error {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return conn.WriteMessage(b)
+}
@@ -0,0 +1,86 @@
+package agent
+
+import (
+	"expvar"
+	"hash/fnv"
+	"sort"
+	"sync"
+)
+
+// cohortFeatures are the collectors of the config which a cohort policy
+// may roll out
+var cohortFeatures = []string{"thread_cpu", "collect_host", "gc_events", "alloc_sites", "watchdog"}
+
+// cohorts are the features of the cohort policy the app is enrolled in
+var cohorts struct {
+	sync.Mutex
+	enrolled []string
+}
+
+func init() {
+	expvar.Publish("cohorts", expvar.Func(func() interface{} {
+		cohorts.Lock()
+		defer cohorts.Unlock()
+		return cohorts.enrolled
+	}))
+}
+
+// InCohort tells if the app is among the percent of the fleet enrolled in
+// the feature. The bucket of an app is a hash of its serial and the
+// feature, so it stays enrolled as the percent grows and the cohorts of
+// the features are independent.
+func InCohort(feature string, percent float64) bool {
+	if percent >= 100 {
+		return true
+	}
+	h := fnv.New64a()
+	h.Write([]byte(feature + "/" + serial.Value()))
+	return float64(h.Sum64()%10000) < percent*100
+}
+
+// rollout returns the config with the features of the cohort policy
+// turned off unless the app is enrolled in them
+func (cfg *fileConfig) rollout() *fileConfig {
+	if len(cfg.Cohorts) == 0 {
+		setCohorts(nil)
+		return cfg
+	}
+	eff := *cfg
+	var enrolled []string
+	for feature, percent := range cfg.Cohorts {
+		if InCohort(feature, percent) {
+			enrolled = append(enrolled, feature)
+			continue
+		}
+		switch feature {
+		case "thread_cpu":
+			eff.ThreadCPU = 0
+		case "collect_host":
+			eff.CollectHost = false
+		case "gc_events":
+			eff.GCEvents = false
+		case "alloc_sites":
+			eff.AllocSites = 0
+		case "watchdog":
+			eff.Watchdog = nil
+		}
+	}
+	sort.Strings(enrolled)
+	setCohorts(enrolled)
+	return &eff
+}
+
+func setCohorts(enrolled []string) {
+	cohorts.Lock()
+	cohorts.enrolled = enrolled
+	cohorts.Unlock()
+}
+
+func validCohortFeature(feature string) bool {
+	for _, f := range cohortFeatures {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
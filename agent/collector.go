@@ -0,0 +1,180 @@
+package agent
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jursonmo/gomonitor/model"
+)
+
+// Fields are the values of a collector by name: numbers, strings or
+// booleans
+type Fields map[string]interface{}
+
+// Collector collects metrics the agent does not know about, e.g. the
+// stats of a Redis client. Its fields are reported as
+// collector.<name>.<field>.
+type Collector interface {
+	Name() string
+	Collect(ctx context.Context) (Fields, error)
+}
+
+// CollectorOptions are how often a collector runs and how long a run may
+// take. A run still going at the next interval skips it.
+type CollectorOptions struct {
+	Interval time.Duration
+	Timeout  time.Duration
+}
+
+var DefaultCollectorOptions = CollectorOptions{
+	Interval: 10 * time.Second,
+	Timeout:  5 * time.Second,
+}
+
+// registered is a collector and the result of its last run
+type registered struct {
+	c    Collector
+	opts CollectorOptions
+	done chan struct{}
+
+	mu       sync.Mutex
+	running  bool
+	result   model.CollectorResult
+	errors   int64
+	timeouts int64
+	panics   int64
+}
+
+var collectors struct {
+	sync.Mutex
+	m map[string]*registered
+}
+
+func init() {
+	expvar.Publish("collectors", expvar.Func(func() interface{} {
+		collectors.Lock()
+		defer collectors.Unlock()
+		if len(collectors.m) == 0 {
+			return nil
+		}
+		m := make(map[string]model.CollectorResult, len(collectors.m))
+		for name, r := range collectors.m {
+			r.mu.Lock()
+			res := r.result
+			res.Errors, res.Timeouts, res.Panics = r.errors, r.timeouts, r.panics
+			r.mu.Unlock()
+			m[name] = res
+		}
+		return m
+	}))
+}
+
+// RegisterCollector runs the collector every Interval, the returned func
+// unregisters it. A panic of the collector fails its run instead of
+// crashing the app. A collector of the same name replaces the previous
+// one. A zero Interval or Timeout is the one of DefaultCollectorOptions.
+func RegisterCollector(c Collector, opts CollectorOptions) (unregister func()) {
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultCollectorOptions.Interval
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultCollectorOptions.Timeout
+	}
+	r := &registered{c: c, opts: opts, done: make(chan struct{})}
+	name := c.Name()
+	collectors.Lock()
+	if collectors.m == nil {
+		collectors.m = make(map[string]*registered)
+	}
+	if prev, ok := collectors.m[name]; ok {
+		close(prev.done)
+	}
+	collectors.m[name] = r
+	collectors.Unlock()
+
+	go func() {
+		t := time.NewTicker(opts.Interval)
+		defer t.Stop()
+		for {
+			r.run()
+			select {
+			case <-r.done:
+				return
+			case <-t.C:
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			collectors.Lock()
+			defer collectors.Unlock()
+			if collectors.m[name] == r {
+				delete(collectors.m, name)
+				close(r.done)
+			}
+		})
+	}
+}
+
+// run runs the collector once, a run which outlasts the timeout keeps
+// going in the background and fails
+func (r *registered) run() {
+	r.mu.Lock()
+	if r.running {
+		r.mu.Unlock()
+		return
+	}
+	r.running = true
+	r.mu.Unlock()
+
+	type outcome struct {
+		fields Fields
+		err    error
+		panic  bool
+	}
+	res := make(chan outcome, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), r.opts.Timeout)
+	defer cancel()
+	start := time.Now()
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				res <- outcome{err: fmt.Errorf("panic: %v", p), panic: true}
+			}
+			r.mu.Lock()
+			r.running = false
+			r.mu.Unlock()
+		}()
+		fields, err := r.c.Collect(ctx)
+		res <- outcome{fields: fields, err: err}
+	}()
+
+	var o outcome
+	timedOut := false
+	select {
+	case o = <-res:
+	case <-ctx.Done():
+		o.err, timedOut = fmt.Errorf("timeout after %s", r.opts.Timeout), true
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.result.Time = start.Unix()
+	r.result.DurationMs = float64(time.Since(start)) / float64(time.Millisecond)
+	switch {
+	case o.err == nil:
+		r.result.Fields, r.result.Error = o.fields, ""
+		return
+	case o.panic:
+		r.panics++
+	case timedOut:
+		r.timeouts++
+	}
+	r.errors++
+	r.result.Fields, r.result.Error = nil, o.err.Error()
+}
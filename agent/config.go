@@ -0,0 +1,391 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/jursonmo/gomonitor/processor"
+)
+
+// configPoll is how often the config file is checked for changes
+const configPoll = 5 * time.Second
+
+// fileConfig is the config file of the agent, TOML, or JSON when its
+// name ends in .json:
+//
+//	serial = "edge-42"
+//	thread_cpu = 5
+//	collect_host = true
+//	gc_events = true
+//	alloc_sites = 10
+//
+//	[labels]
+//	team = "core"
+//
+//	[etag]
+//	threshold = 0.01
+//	exact = ["memstats.NumGC"]
+//	max_age = "1m"
+//
+//	[push]
+//	url = "https://collector:8186/push"
+//	interval = "10s"
+//	watch = ["goroutineNum", "memstats.HeapAlloc"]
+//	threshold = 0.1
+//	max_interval = "5m"
+//	wal_file = "/var/lib/app/push.wal"
+//
+//	[spool]
+//	dir = "/var/lib/app/spool"
+//	interval = "10s"
+//	format = "json"
+//
+//	[channel]
+//	url = "wss://collector:8186/ws"
+//	interval = "10s"
+//	allow = ["gc-now"]
+//
+//	[watchdog]
+//	dump_threshold = "5s"
+//	dump_dir = "/var/lib/app/dumps"
+//
+//	[[processors]]
+//	type = "scale"
+//	field = "memstats.HeapAlloc"
+//	factor = 0.000001
+//
+//	[budget]
+//	cpu_percent = 1
+//	alloc_rate = 1048576
+//	window = "1m"
+//
+// The cohorts roll out the collectors to the percent of the fleet whose
+// serial hashes into them, e.g. the goroutine dumps on 1% of the apps:
+//
+//	[cohorts]
+//	watchdog = 1
+//	gc_events = 10
+type fileConfig struct {
+	Serial      string            `json:"serial"`
+	Labels      map[string]string `json:"labels"`
+	ThreadCPU   int               `json:"thread_cpu"`
+	CollectHost bool              `json:"collect_host"`
+	GCEvents    bool              `json:"gc_events"`
+	AllocSites  int               `json:"alloc_sites"`
+
+	ETag *struct {
+		Threshold float64  `json:"threshold"`
+		Exact     []string `json:"exact"`
+		MaxAge    duration `json:"max_age"`
+	} `json:"etag"`
+
+	Push *struct {
+		URL         string   `json:"url"`
+		Interval    duration `json:"interval"`
+		Watch       []string `json:"watch"`
+		Threshold   float64  `json:"threshold"`
+		MaxInterval duration `json:"max_interval"`
+		WALFile     string   `json:"wal_file"`
+	} `json:"push"`
+
+	Spool *struct {
+		Dir      string   `json:"dir"`
+		Interval duration `json:"interval"`
+		Format   string   `json:"format"`
+	} `json:"spool"`
+
+	Channel *struct {
+		URL      string   `json:"url"`
+		Interval duration `json:"interval"`
+		Allow    []string `json:"allow"`
+	} `json:"channel"`
+
+	Watchdog *struct {
+		Interval      duration `json:"interval"`
+		DumpThreshold duration `json:"dump_threshold"`
+		DumpDir       string   `json:"dump_dir"`
+	} `json:"watchdog"`
+
+	Budget *struct {
+		CPUPercent float64  `json:"cpu_percent"`
+		AllocRate  float64  `json:"alloc_rate"`
+		Window     duration `json:"window"`
+	} `json:"budget"`
+
+	Processors []processor.Config `json:"processors"`
+
+	Cohorts map[string]float64 `json:"cohorts"`
+}
+
+// duration is a duration of the config, e.g. "10s"
+type duration time.Duration
+
+func (d *duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("invalid duration %s: must be a string, e.g. \"10s\"", b)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(v)
+	return nil
+}
+
+// loadConfig reads and validates the config file
+func loadConfig(path string) (*fileConfig, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if filepath.Ext(path) != ".json" {
+		m, err := parseTOML(b)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+		if b, err = json.Marshal(m); err != nil {
+			return nil, err
+		}
+	}
+	cfg, err := decodeConfig(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return cfg, nil
+}
+
+// decodeConfig decodes and validates a config in JSON
+func decodeConfig(b []byte) (*fileConfig, error) {
+	var cfg fileConfig
+	dec := json.NewDecoder(bytes.NewReader(b))
+	// a misspelled key fails instead of being ignored
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, err
+	}
+	if cfg.Push != nil && cfg.Push.URL == "" {
+		return nil, errors.New("push without url")
+	}
+	if cfg.Spool != nil {
+		if cfg.Spool.Dir == "" {
+			return nil, errors.New("spool without dir")
+		}
+		if f := cfg.Spool.Format; f != "" && f != SpoolJSON && f != SpoolLine {
+			return nil, fmt.Errorf("invalid spool format %q: must be %q or %q", f, SpoolJSON, SpoolLine)
+		}
+	}
+	if cfg.Channel != nil && cfg.Channel.URL == "" {
+		return nil, errors.New("channel without url")
+	}
+	if _, err := processor.New(cfg.Processors); err != nil {
+		return nil, err
+	}
+	for feature, percent := range cfg.Cohorts {
+		if !validCohortFeature(feature) {
+			return nil, fmt.Errorf("invalid cohort %q: must be one of %s", feature, strings.Join(cohortFeatures, ", "))
+		}
+		if percent < 0 || percent > 100 {
+			return nil, fmt.Errorf("invalid percent %g of cohort %q: must be within 0 and 100", percent, feature)
+		}
+	}
+	return &cfg, nil
+}
+
+// configState is the config applied and the stop funcs of what it
+// started
+type configState struct {
+	sync.Mutex
+	cfg   *fileConfig
+	stops map[string]func()
+}
+
+// agentConfig is applied by the config file and the remote configs,
+// whichever changed last wins
+var agentConfig = &configState{stops: make(map[string]func())}
+
+// StartConfig sets up the agent from the config file at path, then
+// applies its changes when it is modified or the process gets SIGHUP.
+// Only the sections which changed are restarted, e.g. the push. An
+// invalid change is reported as an event and the current config kept.
+// The returned func stops watching the file and what the config started.
+func StartConfig(path string) (stop func(), err error) {
+	cfg, err := loadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	st := agentConfig
+	st.apply(cfg)
+	fi, _ := os.Stat(path)
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	done := make(chan struct{})
+	go func() {
+		t := time.NewTicker(configPoll)
+		defer t.Stop()
+		for {
+			force := false
+			select {
+			case <-done:
+				return
+			case <-hup:
+				force = true
+			case <-t.C:
+			}
+			cur, err := os.Stat(path)
+			if err != nil || !force && fi != nil && cur.ModTime().Equal(fi.ModTime()) && cur.Size() == fi.Size() {
+				continue
+			}
+			fi = cur
+			cfg, err := loadConfig(path)
+			if err != nil {
+				recordEvent("config", "reload", err.Error(), false)
+				continue
+			}
+			st.apply(cfg)
+			recordEvent("config", "reload", path, true)
+		}
+	}()
+
+	return func() {
+		signal.Stop(hup)
+		close(done)
+		st.Lock()
+		defer st.Unlock()
+		for k, stop := range st.stops {
+			stop()
+			delete(st.stops, k)
+		}
+	}, nil
+}
+
+// apply applies the config, restarting the sections which changed
+func (st *configState) apply(cfg *fileConfig) {
+	st.Lock()
+	defer st.Unlock()
+	prev := st.cfg
+	if prev == nil {
+		prev = &fileConfig{}
+	}
+
+	if cfg.Serial != "" {
+		SetSerial(cfg.Serial)
+	}
+	// the cohorts hash the serial, set first
+	cfg = cfg.rollout()
+	for k := range prev.Labels {
+		if _, ok := cfg.Labels[k]; !ok {
+			labels.Delete(k)
+		}
+	}
+	for k, v := range cfg.Labels {
+		SetLabel(k, v)
+	}
+	EnableThreadCPU(cfg.ThreadCPU)
+	CollectHost(cfg.CollectHost)
+	if cfg.ETag != nil {
+		p := DefaultETagPolicy
+		p.Threshold = cfg.ETag.Threshold
+		if cfg.ETag.Exact != nil {
+			p.Exact = cfg.ETag.Exact
+		}
+		if cfg.ETag.MaxAge > 0 {
+			p.MaxAge = time.Duration(cfg.ETag.MaxAge)
+		}
+		SetETagPolicy(p)
+	} else if prev.ETag != nil {
+		SetETagPolicy(DefaultETagPolicy)
+	}
+	// validated with the config
+	SetProcessors(cfg.Processors)
+	if cfg.Budget != nil {
+		SetBudget(Budget{
+			CPUPercent: cfg.Budget.CPUPercent,
+			AllocRate:  cfg.Budget.AllocRate,
+			Window:     time.Duration(cfg.Budget.Window),
+		})
+	} else if prev.Budget != nil {
+		SetBudget(DefaultBudget)
+	}
+
+	st.restart("gc_events", prev.GCEvents != cfg.GCEvents, cfg.GCEvents, StartGCEvents)
+	st.restart("alloc_sites", prev.AllocSites != cfg.AllocSites, cfg.AllocSites > 0, func() func() {
+		return StartAllocSampler(AllocSampler{Top: cfg.AllocSites})
+	})
+	st.restart("push", !reflect.DeepEqual(prev.Push, cfg.Push), cfg.Push != nil, func() func() {
+		p := DefaultPush
+		p.URL, p.WALFile = cfg.Push.URL, cfg.Push.WALFile
+		if cfg.Push.Interval > 0 {
+			p.Interval = time.Duration(cfg.Push.Interval)
+		}
+		if cfg.Push.Watch != nil {
+			p.Watch = cfg.Push.Watch
+		}
+		if cfg.Push.Threshold > 0 {
+			p.Threshold = cfg.Push.Threshold
+		}
+		if cfg.Push.MaxInterval > 0 {
+			p.MaxInterval = time.Duration(cfg.Push.MaxInterval)
+		}
+		return StartPush(p)
+	})
+	st.restart("spool", !reflect.DeepEqual(prev.Spool, cfg.Spool), cfg.Spool != nil, func() func() {
+		s := DefaultSpool
+		s.Dir = cfg.Spool.Dir
+		if cfg.Spool.Interval > 0 {
+			s.Interval = time.Duration(cfg.Spool.Interval)
+		}
+		if cfg.Spool.Format != "" {
+			s.Format = cfg.Spool.Format
+		}
+		stop, err := StartSpool(s)
+		if err != nil {
+			recordEvent("config", "spool", err.Error(), false)
+			return nil
+		}
+		return stop
+	})
+	st.restart("watchdog", !reflect.DeepEqual(prev.Watchdog, cfg.Watchdog), cfg.Watchdog != nil, func() func() {
+		return StartWatchdog(Watchdog{
+			Interval:      time.Duration(cfg.Watchdog.Interval),
+			DumpThreshold: time.Duration(cfg.Watchdog.DumpThreshold),
+			DumpDir:       cfg.Watchdog.DumpDir,
+		})
+	})
+	st.restart("channel", !reflect.DeepEqual(prev.Channel, cfg.Channel), cfg.Channel != nil, func() func() {
+		return StartChannel(Channel{
+			URL:      cfg.Channel.URL,
+			Interval: time.Duration(cfg.Channel.Interval),
+			Allow:    cfg.Channel.Allow,
+		})
+	})
+	st.cfg = cfg
+}
+
+// restart stops the section when it changed and starts it again when on
+func (st *configState) restart(name string, changed, on bool, start func() func()) {
+	if !changed {
+		return
+	}
+	if stop, ok := st.stops[name]; ok {
+		stop()
+		delete(st.stops, name)
+	}
+	if on {
+		if stop := start(); stop != nil {
+			st.stops[name] = stop
+		}
+	}
+}
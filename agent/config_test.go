@@ -0,0 +1,47 @@
+//go:build !windows
+// +build !windows
+
+package agent
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestConfigReloadOnSIGHUP(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.json")
+	write := func(serial string) {
+		if err := ioutil.WriteFile(path, []byte(`{"serial": "`+serial+`"}`), 0644); err != nil {
+			t.Fatal(err)
+		}
+		// the change keeps the modification time and the size
+		at := time.Unix(1600000000, 0)
+		if err := os.Chtimes(path, at, at); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("edge-a")
+	stop, err := StartConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+	if serial.Value() != "edge-a" {
+		t.Fatalf("serial %q, want edge-a", serial.Value())
+	}
+
+	write("edge-b")
+	if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); serial.Value() != "edge-b"; {
+		if time.Now().After(deadline) {
+			t.Fatalf("serial %q after SIGHUP, want edge-b", serial.Value())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
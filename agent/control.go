@@ -0,0 +1,179 @@
+package agent
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	rtpprof "runtime/pprof"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Control configures the control API, which runs allowlisted actions on
+// POST /control/<action>: gc-now, free-os-memory, set-gogc?value=N and
+// capture-profile?type=cpu|heap&seconds=N. Every action is audited and
+// reported as an event, and so are the unauthorized requests up to
+// maxUnauthorized a minute, the audit records are served on GET
+// /control/audit.
+type Control struct {
+	// Auth identifies the callers, operators may run the actions and read
+	// the audit, set-gogc needs an admin. When nil, Token is required.
+	Auth Authenticator
+	// Token is the bearer token granting every action
+	Token string
+	// Allow lists the actions allowed, none when empty
+	Allow []string
+	// ProfileDir receives the captured profiles
+	ProfileDir string
+}
+
+type action func(c *Control, req *http.Request) (string, error)
+
+// actionRoles are the roles required by the actions, operator by default
+var actionRoles = map[string]Role{
+	"set-gogc": RoleAdmin,
+}
+
+var actions = map[string]action{
+	"gc-now": func(*Control, *http.Request) (string, error) {
+		runtime.GC()
+		return "gc done", nil
+	},
+	"free-os-memory": func(*Control, *http.Request) (string, error) {
+		debug.FreeOSMemory()
+		forcedReleaseCount.Add(1)
+		lastForcedRelease.Set(time.Now().Unix())
+		return "memory freed", nil
+	},
+	"set-gogc": func(_ *Control, req *http.Request) (string, error) {
+		n, err := strconv.Atoi(req.FormValue("value"))
+		if err != nil {
+			return "", fmt.Errorf("invalid value: %s", err)
+		}
+		prev := debug.SetGCPercent(n)
+		atomic.StoreInt64(&gcPercent, int64(n))
+		return fmt.Sprintf("gogc %d -> %d", prev, n), nil
+	},
+	"capture-profile": (*Control).captureProfile,
+}
+
+// ControlHandler returns the handler of the control API, to be served
+// under /control/
+func ControlHandler(c Control) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		name := strings.TrimPrefix(req.URL.Path, "/control/")
+		id, ok := c.identify(req)
+		if !ok {
+			recordUnauthorized("anonymous@"+req.RemoteAddr, name)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if name == "audit" && req.Method == http.MethodGet {
+			if id.Role < RoleOperator {
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+			serveAudit(w)
+			return
+		}
+		if req.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		who := id.Name + "@" + req.RemoteAddr
+		act, ok := actions[name]
+		if !ok || !c.allowed(name) {
+			recordAction(who, name, "action not allowed", false)
+			http.Error(w, "action not allowed", http.StatusForbidden)
+			return
+		}
+		required := RoleOperator
+		if r, ok := actionRoles[name]; ok {
+			required = r
+		}
+		if id.Role < required {
+			recordAction(who, name, "role not allowed", false)
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		result, err := act(&c, req)
+		if err != nil {
+			recordAction(who, name, err.Error(), false)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		recordAction(who, name, result, true)
+		fmt.Fprintln(w, result)
+	})
+}
+
+func (c *Control) identify(req *http.Request) (Identity, bool) {
+	if c.Auth != nil {
+		return c.Auth.Identify(req)
+	}
+	return TokenAuth{Name: "token", Token: c.Token, Role: RoleAdmin}.Identify(req)
+}
+
+func (c *Control) allowed(name string) bool {
+	for _, a := range c.Allow {
+		if a == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Control) captureProfile(req *http.Request) (string, error) {
+	if c.ProfileDir == "" {
+		return "", fmt.Errorf("no profile dir configured")
+	}
+	var path string
+	var err error
+	if berr := budgeted("profiles", func() { path, err = c.writeProfile(req) }); berr != nil {
+		return "", berr
+	}
+	return path, err
+}
+
+func (c *Control) writeProfile(req *http.Request) (string, error) {
+	typ := req.FormValue("type")
+	path := filepath.Join(c.ProfileDir, fmt.Sprintf("%s-%d.pprof", typ, time.Now().Unix()))
+
+	switch typ {
+	case "heap":
+		f, err := os.Create(path)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		if err = rtpprof.WriteHeapProfile(f); err != nil {
+			return "", err
+		}
+	case "cpu":
+		seconds, _ := strconv.Atoi(req.FormValue("seconds"))
+		if seconds <= 0 || seconds > 60 {
+			seconds = 10
+		}
+		f, err := os.Create(path)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		if err = rtpprof.StartCPUProfile(f); err != nil {
+			return "", err
+		}
+		time.Sleep(time.Duration(seconds) * time.Second)
+		rtpprof.StopCPUProfile()
+	default:
+		return "", fmt.Errorf("invalid profile type %q: must be cpu or heap", typ)
+	}
+	return path, nil
+}
@@ -0,0 +1,78 @@
+package agent
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"expvar"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	rtpprof "runtime/pprof"
+	"time"
+)
+
+var lastDiagnostics = expvar.NewString("lastDiagnostics")
+
+// WriteDiagnostics writes a bundle with a goroutine dump, a heap profile,
+// the runtime data and the build info to a tar.gz in dir and returns its
+// path, which is also reported in the runtime data
+func WriteDiagnostics(dir string) (string, error) {
+	path := filepath.Join(dir, fmt.Sprintf("diagnostics-%d.tar.gz", time.Now().Unix()))
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+
+	// the ETag served to the consumers is left alone
+	vars := renderVars(nil, nil)
+	var goroutines, heap bytes.Buffer
+	rtpprof.Lookup("goroutine").WriteTo(&goroutines, 2)
+	rtpprof.WriteHeapProfile(&heap)
+
+	files := []struct {
+		name string
+		data []byte
+	}{
+		{"goroutines.txt", goroutines.Bytes()},
+		{"heap.pprof", heap.Bytes()},
+		{"vars.json", vars},
+		{"buildinfo.txt", buildInfo()},
+	}
+	for _, file := range files {
+		hdr := &tar.Header{Name: file.name, Mode: 0644, Size: int64(len(file.data)), ModTime: time.Now()}
+		if err = tw.WriteHeader(hdr); err != nil {
+			return "", err
+		}
+		if _, err = tw.Write(file.data); err != nil {
+			return "", err
+		}
+	}
+	if err = tw.Close(); err != nil {
+		return "", err
+	}
+	if err = gz.Close(); err != nil {
+		return "", err
+	}
+
+	lastDiagnostics.Set(path)
+	return path, nil
+}
+
+func buildInfo() []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "go\t%s\n", runtime.Version())
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		fmt.Fprintf(&buf, "path\t%s\nmod\t%s\t%s\n", bi.Path, bi.Main.Path, bi.Main.Version)
+		for _, d := range bi.Deps {
+			fmt.Fprintf(&buf, "dep\t%s\t%s\n", d.Path, d.Version)
+		}
+	}
+	return buf.Bytes()
+}
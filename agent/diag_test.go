@@ -0,0 +1,26 @@
+package agent
+
+import (
+	"os"
+	"testing"
+)
+
+func TestWriteDiagnosticsKeepsETag(t *testing.T) {
+	_, tag := render()
+	etag.Lock()
+	issued := etag.issued
+	etag.Unlock()
+
+	path, err := WriteDiagnostics(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Size() == 0 {
+		t.Errorf("no bundle at %s: %v", path, err)
+	}
+	etag.Lock()
+	defer etag.Unlock()
+	if etag.tag != tag || !etag.issued.Equal(issued) {
+		t.Errorf("ETag %s issued at %s, want %s issued at %s", etag.tag, etag.issued, tag, issued)
+	}
+}
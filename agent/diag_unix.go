@@ -0,0 +1,26 @@
+//go:build !windows
+// +build !windows
+
+package agent
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// EnableDiagnostics writes a diagnostics bundle into dir on every SIGUSR1
+func EnableDiagnostics(dir string) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGUSR1)
+	go func() {
+		for range c {
+			path, err := WriteDiagnostics(dir)
+			if err != nil {
+				recordAction("SIGUSR1", "diagnostics", err.Error(), false)
+				continue
+			}
+			recordAction("SIGUSR1", "diagnostics", path, true)
+		}
+	}()
+}
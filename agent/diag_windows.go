@@ -0,0 +1,5 @@
+package agent
+
+// EnableDiagnostics does nothing, there is no SIGUSR1 on windows,
+// call WriteDiagnostics instead
+func EnableDiagnostics(dir string) {}
@@ -0,0 +1,382 @@
+//go:build linux && gomonitor_ebpf
+// +build linux,gomonitor_ebpf
+
+package agent
+
+import (
+	"errors"
+	"expvar"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// the counters of the eBPF programs, indexes in the counters map
+const (
+	ebpfSyscalls = iota
+	ebpfOffCPU
+	ebpfRetransmits
+	ebpfCounters
+)
+
+// ebpfPortsRefresh is how often the ports of the process are updated for
+// the retransmits program
+const ebpfPortsRefresh = 10 * time.Second
+
+var ebpfState struct {
+	sync.Mutex
+	counters, starts, ports int
+	stop                    func()
+	err                     string
+}
+
+func init() {
+	expvar.Publish("ebpf", expvar.Func(func() interface{} {
+		ebpfState.Lock()
+		defer ebpfState.Unlock()
+		if ebpfState.stop == nil && ebpfState.err == "" {
+			return nil
+		}
+		v := map[string]interface{}{"error": ebpfState.err}
+		if ebpfState.stop != nil {
+			v["syscalls"] = ebpfCounter(ebpfSyscalls)
+			v["offCpuNs"] = ebpfCounter(ebpfOffCPU)
+			v["tcpRetransmits"] = ebpfCounter(ebpfRetransmits)
+		}
+		return v
+	}))
+}
+
+// StartEBPF attaches eBPF programs to the tracepoints of the kernel which
+// count the syscalls of the process, the time its threads are off CPU and
+// the TCP retransmits on its ports, published as the "ebpf" var. It needs
+// CAP_BPF and CAP_PERFMON, or root, and tracefs mounted.
+func StartEBPF() (stop func(), err error) {
+	ebpfState.Lock()
+	defer ebpfState.Unlock()
+	if ebpfState.stop != nil {
+		return ebpfState.stop, nil
+	}
+	stop, err = startEBPF()
+	if err != nil {
+		ebpfState.err = err.Error()
+		return nil, err
+	}
+	ebpfState.err = ""
+	ebpfState.stop = stop
+	return stop, nil
+}
+
+func startEBPF() (func(), error) {
+	tracefs, err := findTracefs()
+	if err != nil {
+		return nil, err
+	}
+	var fds []int
+	closeAll := func() {
+		for i := len(fds) - 1; i >= 0; i-- {
+			unix.Close(fds[i])
+		}
+	}
+	newMap := func(typ, key, value, entries uint32) (int, error) {
+		fd, err := bpfMapCreate(typ, key, value, entries)
+		if err == nil {
+			fds = append(fds, fd)
+		}
+		return fd, err
+	}
+	counters, err := newMap(unix.BPF_MAP_TYPE_ARRAY, 4, 8, ebpfCounters)
+	if err != nil {
+		closeAll()
+		return nil, err
+	}
+	starts, err := newMap(unix.BPF_MAP_TYPE_HASH, 4, 8, 1<<14)
+	if err != nil {
+		closeAll()
+		return nil, err
+	}
+	ports, err := newMap(unix.BPF_MAP_TYPE_HASH, 2, 1, 1<<12)
+	if err != nil {
+		closeAll()
+		return nil, err
+	}
+
+	pid := int32(os.Getpid())
+	programs := []struct {
+		event string
+		build func(format map[string]int16) []bpfInsn
+	}{
+		{"raw_syscalls/sys_enter", func(map[string]int16) []bpfInsn {
+			return syscallsProgram(pid, counters)
+		}},
+		{"sched/sched_switch", func(format map[string]int16) []bpfInsn {
+			return offCPUProgram(pid, counters, starts, format["prev_pid"], format["next_pid"])
+		}},
+		{"tcp/tcp_retransmit_skb", func(format map[string]int16) []bpfInsn {
+			return retransmitsProgram(counters, ports, format["sport"])
+		}},
+	}
+	for _, p := range programs {
+		id, format, err := readTracepoint(tracefs, p.event)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		prog, err := bpfProgLoad(p.build(format))
+		if err != nil {
+			closeAll()
+			return nil, fmt.Errorf("ebpf: %s: %v", p.event, err)
+		}
+		fds = append(fds, prog)
+		event, err := attachTracepoint(id, prog)
+		if err != nil {
+			closeAll()
+			return nil, fmt.Errorf("ebpf: %s: %v", p.event, err)
+		}
+		fds = append(fds, event)
+	}
+
+	ebpfState.counters, ebpfState.starts, ebpfState.ports = counters, starts, ports
+	refreshPorts(ports, nil)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		var known map[uint16]bool
+		t := time.NewTicker(ebpfPortsRefresh)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				known = refreshPorts(ports, known)
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			wg.Wait()
+			ebpfState.Lock()
+			ebpfState.stop = nil
+			ebpfState.Unlock()
+			closeAll()
+		})
+	}, nil
+}
+
+// ebpfCounter reads a counter, the state must be locked
+func ebpfCounter(i uint32) int64 {
+	var v uint64
+	if err := bpfMapLookup(ebpfState.counters, unsafe.Pointer(&i), unsafe.Pointer(&v)); err != nil {
+		return 0
+	}
+	return int64(v)
+}
+
+// refreshPorts puts the local ports of the TCP sockets of the process in
+// the ports map, removing the ports known before which are gone
+func refreshPorts(fd int, known map[uint16]bool) map[uint16]bool {
+	current := tcpPorts()
+	one := uint8(1)
+	for port := range current {
+		if !known[port] {
+			port := port
+			bpfMapUpdate(fd, unsafe.Pointer(&port), unsafe.Pointer(&one))
+		}
+	}
+	for port := range known {
+		if !current[port] {
+			port := port
+			bpfMapDelete(fd, unsafe.Pointer(&port))
+		}
+	}
+	return current
+}
+
+// tcpPorts returns the local ports of the TCP sockets of the process
+func tcpPorts() map[uint16]bool {
+	ports := make(map[uint16]bool)
+	for _, s := range ownSockets("tcp", "tcp6") {
+		ports[s.localPort] = true
+	}
+	return ports
+}
+
+func findTracefs() (string, error) {
+	for _, dir := range []string{"/sys/kernel/tracing", "/sys/kernel/debug/tracing"} {
+		if _, err := os.Stat(dir + "/events"); err == nil {
+			return dir, nil
+		}
+	}
+	return "", errors.New("ebpf: tracefs is not mounted")
+}
+
+// readTracepoint returns the id of the tracepoint and the offsets of its
+// fields
+func readTracepoint(tracefs, event string) (uint64, map[string]int16, error) {
+	b, err := os.ReadFile(tracefs + "/events/" + event + "/id")
+	if err != nil {
+		return 0, nil, fmt.Errorf("ebpf: %v", err)
+	}
+	id, err := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+	if err != nil {
+		return 0, nil, fmt.Errorf("ebpf: %s id: %v", event, err)
+	}
+	b, err = os.ReadFile(tracefs + "/events/" + event + "/format")
+	if err != nil {
+		return 0, nil, fmt.Errorf("ebpf: %v", err)
+	}
+	// field:int prev_pid;	offset:24;	size:4;	signed:1;
+	format := make(map[string]int16)
+	for _, line := range strings.Split(string(b), "\n") {
+		parts := strings.Split(strings.TrimSpace(line), ";")
+		if len(parts) < 2 || !strings.HasPrefix(parts[0], "field:") {
+			continue
+		}
+		decl := strings.Fields(parts[0])
+		name := decl[len(decl)-1]
+		if i := strings.IndexByte(name, '['); i >= 0 {
+			name = name[:i]
+		}
+		off, err := strconv.ParseInt(strings.TrimPrefix(strings.TrimSpace(parts[1]), "offset:"), 10, 16)
+		if err == nil {
+			format[name] = int16(off)
+		}
+	}
+	return id, format, nil
+}
+
+func attachTracepoint(id uint64, prog int) (int, error) {
+	attr := unix.PerfEventAttr{
+		Type:        unix.PERF_TYPE_TRACEPOINT,
+		Config:      id,
+		Sample:      1,
+		Wakeup:      1,
+		Bits:        unix.PerfBitDisabled,
+		Size:        uint32(unsafe.Sizeof(unix.PerfEventAttr{})),
+		Sample_type: unix.PERF_SAMPLE_RAW,
+	}
+	fd, err := unix.PerfEventOpen(&attr, -1, 0, -1, unix.PERF_FLAG_FD_CLOEXEC)
+	if err != nil {
+		return -1, err
+	}
+	if err := unix.IoctlSetInt(fd, unix.PERF_EVENT_IOC_SET_BPF, prog); err != nil {
+		unix.Close(fd)
+		return -1, err
+	}
+	if err := unix.IoctlSetInt(fd, unix.PERF_EVENT_IOC_ENABLE, 0); err != nil {
+		unix.Close(fd)
+		return -1, err
+	}
+	return fd, nil
+}
+
+// the programs, r6 and r7 survive calls, r10 is the frame pointer
+
+// syscallsProgram counts the sys_enter of the process
+func syscallsProgram(pid int32, counters int) []bpfInsn {
+	p := []bpfInsn{
+		call(helperGetCurrentPidTgid),
+		aluImm(bpfRSH, 0, 32),
+		jmpImm(bpfJNE, 0, pid, toExit),
+	}
+	p = append(p, addCounter(counters, ebpfSyscalls, -1)...)
+	return exit(p)
+}
+
+// offCPUProgram stamps the threads of the process switched out and adds
+// the time until they are switched in again
+func offCPUProgram(pid int32, counters, starts int, prevPid, nextPid int16) []bpfInsn {
+	// starts[prev_pid] = now
+	prev := []bpfInsn{
+		load(bpfW, 2, 6, prevPid),
+		store(bpfW, 10, 2, -4),
+		call(helperKtimeGetNs),
+		store(bpfDW, 10, 0, -16),
+	}
+	prev = append(prev, loadMap(1, starts)...)
+	prev = append(prev,
+		mov(2, 10),
+		aluImm(bpfADD, 2, -4),
+		mov(3, 10),
+		aluImm(bpfADD, 3, -16),
+		movImm(4, 0),
+		call(helperMapUpdateElem),
+	)
+	p := []bpfInsn{
+		mov(6, 1),
+		call(helperGetCurrentPidTgid),
+		aluImm(bpfRSH, 0, 32),
+		jmpImm(bpfJNE, 0, pid, int16(len(prev))),
+	}
+	p = append(p, prev...)
+	// next_pid switched in
+	p = append(p,
+		load(bpfW, 2, 6, nextPid),
+		store(bpfW, 10, 2, -4),
+	)
+	p = append(p, loadMap(1, starts)...)
+	p = append(p,
+		mov(2, 10),
+		aluImm(bpfADD, 2, -4),
+		call(helperMapLookupElem),
+		jmpImm(bpfJEQ, 0, 0, toExit),
+		load(bpfDW, 7, 0, 0),
+		call(helperKtimeGetNs),
+		aluReg(bpfSUB, 0, 7),
+		mov(7, 0),
+	)
+	p = append(p, loadMap(1, starts)...)
+	p = append(p,
+		mov(2, 10),
+		aluImm(bpfADD, 2, -4),
+		call(helperMapDeleteElem),
+	)
+	p = append(p, addCounter(counters, ebpfOffCPU, 7)...)
+	return exit(p)
+}
+
+// retransmitsProgram counts the retransmits from the ports of the process
+func retransmitsProgram(counters, ports int, sport int16) []bpfInsn {
+	p := []bpfInsn{
+		mov(6, 1),
+		load(bpfH, 2, 6, sport),
+		store(bpfH, 10, 2, -8),
+	}
+	p = append(p, loadMap(1, ports)...)
+	p = append(p,
+		mov(2, 10),
+		aluImm(bpfADD, 2, -8),
+		call(helperMapLookupElem),
+		jmpImm(bpfJEQ, 0, 0, toExit),
+	)
+	p = append(p, addCounter(counters, ebpfRetransmits, -1)...)
+	return exit(p)
+}
+
+// addCounter adds the register reg to the counter, 1 if reg is negative
+func addCounter(counters int, counter int32, reg int) []bpfInsn {
+	p := []bpfInsn{storeImm(bpfW, 10, -20, counter)}
+	p = append(p, loadMap(1, counters)...)
+	p = append(p,
+		mov(2, 10),
+		aluImm(bpfADD, 2, -20),
+		call(helperMapLookupElem),
+		jmpImm(bpfJEQ, 0, 0, toExit),
+	)
+	if reg < 0 {
+		reg = 1
+		p = append(p, movImm(1, 1))
+	}
+	return append(p, atomicAdd(0, uint8(reg), 0))
+}
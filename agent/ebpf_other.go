@@ -0,0 +1,12 @@
+//go:build !linux || !gomonitor_ebpf
+// +build !linux !gomonitor_ebpf
+
+package agent
+
+import "errors"
+
+// StartEBPF returns an error, the eBPF programs are only built on linux
+// with the gomonitor_ebpf tag
+func StartEBPF() (stop func(), err error) {
+	return nil, errors.New("ebpf: not built, build on linux with -tags gomonitor_ebpf")
+}
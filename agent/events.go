@@ -0,0 +1,42 @@
+package agent
+
+import (
+	"expvar"
+	"sync"
+	"time"
+
+	"github.com/jursonmo/gomonitor/model"
+)
+
+// Event is something done to the app, e.g. a control action, reported
+// with the runtime data and emitted by the input at its own time
+type Event = model.Event
+
+// maxEvents is how many recent events are reported, an input scraping
+// less often than they happen misses some
+const maxEvents = 32
+
+var (
+	eventsMu sync.Mutex
+	events   []Event
+)
+
+func init() {
+	expvar.Publish("events", expvar.Func(func() interface{} {
+		eventsMu.Lock()
+		defer eventsMu.Unlock()
+		return append([]Event(nil), events...)
+	}))
+}
+
+func recordEvent(who, action, result string, ok bool) Event {
+	e := Event{Time: time.Now().UnixNano(), Who: who, Action: action, Result: result, OK: ok}
+
+	eventsMu.Lock()
+	defer eventsMu.Unlock()
+	events = append(events, e)
+	if len(events) > maxEvents {
+		events = events[len(events)-maxEvents:]
+	}
+	return e
+}
@@ -0,0 +1,136 @@
+package agent
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceIDFromRequest returns the trace id of a request, by default from
+// its W3C traceparent header. Apps tracing with OpenTelemetry can return
+// trace.SpanContextFromContext(r.Context()).TraceID().String() instead.
+var TraceIDFromRequest = func(r *http.Request) string {
+	// version-traceid-parentid-flags
+	parts := strings.Split(r.Header.Get("traceparent"), "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || parts[1] == strings.Repeat("0", 32) {
+		return ""
+	}
+	return parts[1]
+}
+
+// latencyBuckets are the upper bounds of the request latency histogram,
+// in seconds
+var latencyBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type exemplar struct {
+	traceID string
+	value   float64
+	at      time.Time
+}
+
+// latency is the histogram of the requests served by Middleware, every
+// bucket keeping the last traced request falling in it as exemplar
+var latency = struct {
+	sync.Mutex
+	counts    []uint64
+	exemplars []exemplar
+	count     uint64
+	sum       float64
+	// last traced request, the exemplar of the gc cycles
+	last exemplar
+}{
+	counts:    make([]uint64, len(latencyBuckets)+1),
+	exemplars: make([]exemplar, len(latencyBuckets)+1),
+}
+
+// Middleware measures the latency of the requests of the app, exported
+// by PrometheusHandler with the trace ids of recent requests as
+// OpenMetrics exemplars, and their statuses for the burn rates of SetSLO
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r)
+		observeLatency(time.Since(start).Seconds(), TraceIDFromRequest(r))
+		if sw.status == 0 {
+			sw.status = http.StatusOK
+		}
+		observeStatus(sw.status)
+	})
+}
+
+func observeLatency(v float64, traceID string) {
+	i := 0
+	for i < len(latencyBuckets) && v > latencyBuckets[i] {
+		i++
+	}
+
+	latency.Lock()
+	defer latency.Unlock()
+	latency.counts[i]++
+	latency.count++
+	latency.sum += v
+	if traceID != "" {
+		e := exemplar{traceID: traceID, value: v, at: time.Now()}
+		latency.exemplars[i] = e
+		latency.last = e
+	}
+}
+
+// writeLatency writes the latency histogram and the gc cycles, with their
+// exemplars in the OpenMetrics format
+func writeLatency(w io.Writer, lbls string, numGC int64, openMetrics bool) {
+	latency.Lock()
+	defer latency.Unlock()
+
+	name := "gomonitor_http_request_duration_seconds"
+	fmt.Fprintf(w, "# TYPE %s histogram\n", name)
+	var cumulative uint64
+	for i, n := range latency.counts {
+		cumulative += n
+		le := "+Inf"
+		if i < len(latencyBuckets) {
+			le = fmt.Sprint(latencyBuckets[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d", name, withLabel(lbls, "le", le), cumulative)
+		if openMetrics {
+			writeExemplar(w, latency.exemplars[i])
+		}
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintf(w, "%s_sum%s %g\n%s_count%s %d\n", name, lbls, latency.sum, name, lbls, latency.count)
+
+	// the request traced last is what ran around the last gc
+	// OpenMetrics names the counter family without the _total suffix of its
+	// sample, the text format names it like the sample
+	family := "gomonitor_gc_cycles"
+	if !openMetrics {
+		family += "_total"
+	}
+	fmt.Fprintf(w, "# TYPE %s counter\ngomonitor_gc_cycles_total%s %d", family, lbls, numGC)
+	if openMetrics {
+		e := latency.last
+		e.value = 1
+		writeExemplar(w, e)
+	}
+	fmt.Fprintln(w)
+}
+
+func writeExemplar(w io.Writer, e exemplar) {
+	if e.traceID == "" {
+		return
+	}
+	fmt.Fprintf(w, ` # {trace_id="%s"} %g %.3f`, e.traceID, e.value, float64(e.at.UnixNano())/1e9)
+}
+
+// withLabel adds a label to the formatted labels
+func withLabel(lbls, key, value string) string {
+	l := key + `="` + value + `"`
+	if lbls == "" {
+		return "{" + l + "}"
+	}
+	return lbls[:len(lbls)-1] + "," + l + "}"
+}
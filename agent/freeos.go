@@ -0,0 +1,59 @@
+package agent
+
+import (
+	"expvar"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+var forcedReleaseCount = expvar.NewInt("forcedReleaseCount")
+var lastForcedRelease = expvar.NewInt("lastForcedRelease")
+
+// FreeOSMemoryPolicy returns the idle heap to the OS when the runtime
+// holds more than Threshold bytes of it, at most once per MinInterval
+type FreeOSMemoryPolicy struct {
+	Threshold     uint64
+	MinInterval   time.Duration
+	CheckInterval time.Duration
+}
+
+var DefaultFreeOSMemoryPolicy = FreeOSMemoryPolicy{
+	Threshold:     512 << 20,
+	MinInterval:   5 * time.Minute,
+	CheckInterval: 30 * time.Second,
+}
+
+// StartFreeOSMemory starts applying the policy, the returned func stops
+// it. A zero CheckInterval is the one of DefaultFreeOSMemoryPolicy.
+func StartFreeOSMemory(p FreeOSMemoryPolicy) (stop func()) {
+	if p.CheckInterval <= 0 {
+		p.CheckInterval = DefaultFreeOSMemoryPolicy.CheckInterval
+	}
+	done := make(chan struct{})
+	go func() {
+		t := time.NewTicker(p.CheckInterval)
+		defer t.Stop()
+		var last time.Time
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-t.C:
+				if now.Sub(last) < p.MinInterval {
+					continue
+				}
+				var m runtime.MemStats
+				runtime.ReadMemStats(&m)
+				if m.HeapIdle-m.HeapReleased < p.Threshold {
+					continue
+				}
+				debug.FreeOSMemory()
+				last = now
+				forcedReleaseCount.Add(1)
+				lastForcedRelease.Set(now.Unix())
+			}
+		}
+	}()
+	return func() { close(done) }
+}
@@ -0,0 +1,108 @@
+package agent
+
+import (
+	"expvar"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/jursonmo/gomonitor/model"
+)
+
+// maxGCEvents is how many recent gc cycles are reported, an input
+// scraping less often than they happen misses some
+const maxGCEvents = 64
+
+var gcEvents struct {
+	sync.Mutex
+	events []model.GCEvent
+	last   uint32 // the last cycle recorded
+	forced uint32
+	goal   uint64
+}
+
+// gcEventsGen is the generation of the running recording, 0 when stopped,
+// a sentinel of another generation is not rearmed
+var gcEventsGen, gcEventsStarts int32
+
+func init() {
+	expvar.Publish("gcEvents", expvar.Func(func() interface{} {
+		gcEvents.Lock()
+		defer gcEvents.Unlock()
+		if gcEvents.events == nil {
+			return nil
+		}
+		return append([]model.GCEvent(nil), gcEvents.events...)
+	}))
+}
+
+// StartGCEvents records an event per gc cycle: its pause, the heap goal
+// which triggered it and the heap left after it, and whether it was
+// forced. A finalizer rearmed on every cycle reads the memstats, so the
+// heap after includes what was allocated since the cycle ended. The
+// returned func stops the recording.
+func StartGCEvents() (stop func()) {
+	gen := atomic.AddInt32(&gcEventsStarts, 1)
+	if !atomic.CompareAndSwapInt32(&gcEventsGen, 0, gen) {
+		return func() {}
+	}
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	gcEvents.Lock()
+	gcEvents.events = make([]model.GCEvent, 0, maxGCEvents)
+	gcEvents.last = m.NumGC
+	gcEvents.forced = m.NumForcedGC
+	gcEvents.goal = m.NextGC
+	gcEvents.Unlock()
+
+	armGCSentinel(gen)
+	return func() {
+		atomic.CompareAndSwapInt32(&gcEventsGen, gen, 0)
+	}
+}
+
+// armGCSentinel sets a finalizer on a new object, run after the next cycle
+func armGCSentinel(gen int32) {
+	sentinel := new([16]byte)
+	runtime.SetFinalizer(sentinel, func(*[16]byte) {
+		if atomic.LoadInt32(&gcEventsGen) != gen {
+			return
+		}
+		recordGCCycles()
+		armGCSentinel(gen)
+	})
+}
+
+// recordGCCycles records the cycles since the last recorded one, the
+// pauses of the ones missed are still in the memstats
+func recordGCCycles() {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	gcEvents.Lock()
+	defer gcEvents.Unlock()
+	first := gcEvents.last + 1
+	if m.NumGC-gcEvents.last > uint32(len(m.PauseNs)) {
+		first = m.NumGC - uint32(len(m.PauseNs)) + 1
+	}
+	for n := first; n <= m.NumGC; n++ {
+		i := (n + 255) % 256
+		e := model.GCEvent{
+			Cycle:   int64(n),
+			End:     int64(m.PauseEnd[i]),
+			PauseNs: int64(m.PauseNs[i]),
+		}
+		if n == m.NumGC {
+			e.HeapGoal = int64(gcEvents.goal)
+			e.HeapAfter = int64(m.HeapAlloc)
+			e.Forced = m.NumForcedGC > gcEvents.forced
+		}
+		if len(gcEvents.events) == maxGCEvents {
+			gcEvents.events = append(gcEvents.events[:0], gcEvents.events[1:]...)
+		}
+		gcEvents.events = append(gcEvents.events, e)
+	}
+	gcEvents.last = m.NumGC
+	gcEvents.forced = m.NumForcedGC
+	gcEvents.goal = m.NextGC
+}
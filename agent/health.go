@@ -0,0 +1,59 @@
+package agent
+
+import (
+	"fmt"
+	"net/http"
+	"runtime"
+)
+
+// HealthRules are the thresholds checked by the health handler.
+// A zero value disables the rule.
+type HealthRules struct {
+	MaxGoroutines int
+	// MaxHeapLimitRatio is the max HeapAlloc relative to GOMEMLIMIT,
+	// only checked when a memory limit is set
+	MaxHeapLimitRatio float64
+	MaxGCCPUFraction  float64
+}
+
+var DefaultHealthRules = HealthRules{
+	MaxGoroutines:     50000,
+	MaxHeapLimitRatio: 0.8,
+	MaxGCCPUFraction:  0.25,
+}
+
+// HealthHandler returns a handler for /healthz, it answers 200 when all
+// rules pass and 503 with the failed rules otherwise
+func HealthHandler(rules HealthRules) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var m runtime.MemStats
+		runtime.ReadMemStats(&m)
+
+		failed := rules.check(runtime.NumGoroutine(), &m, memoryLimit())
+		if len(failed) != 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			for _, f := range failed {
+				fmt.Fprintln(w, f)
+			}
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+}
+
+func (r *HealthRules) check(goroutines int, m *runtime.MemStats, limit int64) []string {
+	var failed []string
+	if r.MaxGoroutines > 0 && goroutines >= r.MaxGoroutines {
+		failed = append(failed, fmt.Sprintf("goroutines %d >= %d", goroutines, r.MaxGoroutines))
+	}
+	if r.MaxHeapLimitRatio > 0 && limit > 0 {
+		ratio := float64(m.HeapAlloc) / float64(limit)
+		if ratio >= r.MaxHeapLimitRatio {
+			failed = append(failed, fmt.Sprintf("heap %.2f of memory limit >= %.2f", ratio, r.MaxHeapLimitRatio))
+		}
+	}
+	if r.MaxGCCPUFraction > 0 && m.GCCPUFraction >= r.MaxGCCPUFraction {
+		failed = append(failed, fmt.Sprintf("gc cpu fraction %.4f >= %.4f", m.GCCPUFraction, r.MaxGCCPUFraction))
+	}
+	return failed
+}
@@ -0,0 +1,48 @@
+package agent
+
+import (
+	"expvar"
+	"sync/atomic"
+
+	"github.com/jursonmo/gomonitor/model"
+	"github.com/shirou/gopsutil/cpu"
+	gload "github.com/shirou/gopsutil/load"
+	"github.com/shirou/gopsutil/mem"
+)
+
+var collectHost int32
+
+func init() {
+	expvar.Publish("host", expvar.Func(func() interface{} {
+		if atomic.LoadInt32(&collectHost) == 0 {
+			return nil
+		}
+		return hostMetrics()
+	}))
+}
+
+// CollectHost reports the load average, the memory and the CPU steal of
+// the host along the runtime data, for the deployments running no host
+// agent. Off by default, to not duplicate node_exporter and the like.
+func CollectHost(on bool) {
+	v := int32(0)
+	if on {
+		v = 1
+	}
+	atomic.StoreInt32(&collectHost, v)
+}
+
+func hostMetrics() *model.Host {
+	h := &model.Host{}
+	if avg, err := gload.Avg(); err == nil {
+		h.Load1, h.Load5, h.Load15 = avg.Load1, avg.Load5, avg.Load15
+	}
+	if vm, err := mem.VirtualMemory(); err == nil {
+		h.MemTotal = int64(vm.Total)
+		h.MemAvailable = int64(vm.Available)
+	}
+	if times, err := cpu.Times(false); err == nil && len(times) > 0 {
+		h.CPUSteal = times[0].Steal
+	}
+	return h
+}
@@ -0,0 +1,88 @@
+package agent
+
+import (
+	"expvar"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/jursonmo/gomonitor/model"
+)
+
+// sysfs is where the thermal zones and the cpufreq policies are read
+var sysfs = "/sys"
+
+func init() {
+	expvar.Publish("hw", expvar.Func(func() interface{} {
+		return hardware()
+	}))
+}
+
+// hardware reads the temperatures of the thermal zones and the frequency
+// of the CPUs, absent on most VMs
+func hardware() model.Hardware {
+	var hw model.Hardware
+	zones, _ := filepath.Glob(sysfs + "/class/thermal/thermal_zone*")
+	for _, z := range zones {
+		milli, ok := readSysInt(z + "/temp")
+		if !ok {
+			continue
+		}
+		name := readSysString(z + "/type")
+		if name == "" {
+			name = filepath.Base(z)
+		}
+		if hw.Temps == nil {
+			hw.Temps = make(map[string]float64)
+		}
+		// zones of the same type, e.g. per core, report the hottest
+		c := float64(milli) / 1000
+		if t, ok := hw.Temps[name]; !ok || c > t {
+			hw.Temps[name] = c
+		}
+	}
+
+	// the policies group the CPUs sharing a clock
+	policies, _ := filepath.Glob(sysfs + "/devices/system/cpu/cpufreq/policy*")
+	var cur, limit, max float64
+	for _, p := range policies {
+		c, ok1 := readSysInt(p + "/scaling_cur_freq")
+		l, ok2 := readSysInt(p + "/scaling_max_freq")
+		m, ok3 := readSysInt(p + "/cpuinfo_max_freq")
+		if !ok1 || !ok2 || !ok3 {
+			continue
+		}
+		cur += float64(c)
+		limit += float64(l)
+		max += float64(m)
+		hw.CPUs++
+	}
+	if hw.CPUs > 0 {
+		hw.CPUFreqMHz = cur / float64(hw.CPUs) / 1000
+		hw.CPULimitMHz = limit / float64(hw.CPUs) / 1000
+		hw.CPUMaxFreqMHz = max / float64(hw.CPUs) / 1000
+	}
+
+	// x86 counts the throttling events, ARM only shows the lowered clock
+	counts, _ := filepath.Glob(sysfs + "/devices/system/cpu/cpu*/thermal_throttle/core_throttle_count")
+	for _, f := range counts {
+		if n, ok := readSysInt(f); ok {
+			hw.ThrottleCount += n
+		}
+	}
+	return hw
+}
+
+func readSysString(path string) string {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+func readSysInt(path string) (int64, bool) {
+	n, err := strconv.ParseInt(readSysString(path), 10, 64)
+	return n, err == nil
+}
@@ -0,0 +1,60 @@
+package agent
+
+import (
+	"bufio"
+	"expvar"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// labels are emitted as tags on every point of the app
+var labels = expvar.NewMap("labels")
+
+// SetLabel sets a label reported with the runtime data
+func SetLabel(key, value string) {
+	s := new(expvar.String)
+	s.Set(value)
+	labels.Set(key, s)
+}
+
+// LabelsFromEnv sets the environment variables starting with prefix as
+// labels, with the prefix stripped and the key lowercased:
+// GOMONITOR_LABEL_TEAM=core gives team=core
+func LabelsFromEnv(prefix string) {
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, prefix) {
+			continue
+		}
+		i := strings.IndexByte(kv, '=')
+		if i <= len(prefix) {
+			continue
+		}
+		SetLabel(strings.ToLower(kv[len(prefix):i]), kv[i+1:])
+	}
+}
+
+// LabelsFromFile sets the labels of a file with key="value" lines, the
+// format of the kubernetes downward API labels file
+func LabelsFromFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		i := strings.IndexByte(line, '=')
+		if i <= 0 {
+			continue
+		}
+		value := line[i+1:]
+		if v, err := strconv.Unquote(value); err == nil {
+			value = v
+		}
+		SetLabel(line[:i], value)
+	}
+	return scanner.Err()
+}
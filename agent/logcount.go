@@ -0,0 +1,85 @@
+package agent
+
+import (
+	"expvar"
+	"sync"
+	"time"
+)
+
+// LogLevel is the level of a counted log line
+type LogLevel int
+
+const (
+	LogWarn LogLevel = iota
+	LogError
+)
+
+// rateWindow is the window in seconds of the reported log rates
+const rateWindow = 60
+
+// levelCounter counts log lines, in per second buckets for the rate
+type levelCounter struct {
+	mu      sync.Mutex
+	total   int64
+	buckets [rateWindow]int64
+	seconds [rateWindow]int64
+}
+
+func (c *levelCounter) add() {
+	now := time.Now().Unix()
+	i := now % rateWindow
+
+	c.mu.Lock()
+	if c.seconds[i] != now {
+		c.seconds[i] = now
+		c.buckets[i] = 0
+	}
+	c.buckets[i]++
+	c.total++
+	c.mu.Unlock()
+}
+
+// rate returns the lines per second over the last window
+func (c *levelCounter) rate() float64 {
+	now := time.Now().Unix()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var n int64
+	for i, s := range c.seconds {
+		if now-s < rateWindow {
+			n += c.buckets[i]
+		}
+	}
+	return float64(n) / rateWindow
+}
+
+var warnLogs, errorLogs levelCounter
+
+func init() {
+	expvar.Publish("log", expvar.Func(func() interface{} {
+		errorLogs.mu.Lock()
+		errors := errorLogs.total
+		errorLogs.mu.Unlock()
+		warnLogs.mu.Lock()
+		warns := warnLogs.total
+		warnLogs.mu.Unlock()
+
+		return map[string]interface{}{
+			"errors":    errors,
+			"warns":     warns,
+			"errorRate": errorLogs.rate(),
+			"warnRate":  warnLogs.rate(),
+		}
+	}))
+}
+
+// CountLog counts a log line, for loggers without an adapter
+func CountLog(level LogLevel) {
+	switch level {
+	case LogWarn:
+		warnLogs.add()
+	case LogError:
+		errorLogs.add()
+	}
+}
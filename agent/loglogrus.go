@@ -0,0 +1,24 @@
+package agent
+
+import "github.com/sirupsen/logrus"
+
+// LogrusHook returns a hook counting warn and error lines:
+// logrus.AddHook(agent.LogrusHook())
+func LogrusHook() logrus.Hook {
+	return logrusCounter{}
+}
+
+type logrusCounter struct{}
+
+func (logrusCounter) Levels() []logrus.Level {
+	return []logrus.Level{logrus.PanicLevel, logrus.FatalLevel, logrus.ErrorLevel, logrus.WarnLevel}
+}
+
+func (logrusCounter) Fire(e *logrus.Entry) error {
+	if e.Level == logrus.WarnLevel {
+		CountLog(LogWarn)
+	} else {
+		CountLog(LogError)
+	}
+	return nil
+}
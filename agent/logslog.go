@@ -0,0 +1,37 @@
+//go:build go1.21
+// +build go1.21
+
+package agent
+
+import (
+	"context"
+	"log/slog"
+)
+
+// SlogHandler wraps next, counting the warn and error records it handles:
+// slog.New(agent.SlogHandler(slog.NewJSONHandler(os.Stderr, nil)))
+func SlogHandler(next slog.Handler) slog.Handler {
+	return slogCounter{next}
+}
+
+type slogCounter struct {
+	slog.Handler
+}
+
+func (h slogCounter) Handle(ctx context.Context, r slog.Record) error {
+	switch {
+	case r.Level >= slog.LevelError:
+		CountLog(LogError)
+	case r.Level >= slog.LevelWarn:
+		CountLog(LogWarn)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h slogCounter) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return slogCounter{h.Handler.WithAttrs(attrs)}
+}
+
+func (h slogCounter) WithGroup(name string) slog.Handler {
+	return slogCounter{h.Handler.WithGroup(name)}
+}
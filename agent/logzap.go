@@ -0,0 +1,39 @@
+package agent
+
+import "go.uber.org/zap/zapcore"
+
+// ZapCore returns a core counting warn and error lines, to be teed with
+// the core writing the logs: zapcore.NewTee(core, agent.ZapCore())
+func ZapCore() zapcore.Core {
+	return zapCounter{}
+}
+
+type zapCounter struct{}
+
+func (zapCounter) Enabled(l zapcore.Level) bool {
+	return l >= zapcore.WarnLevel
+}
+
+func (c zapCounter) With([]zapcore.Field) zapcore.Core {
+	return c
+}
+
+func (c zapCounter) Check(e zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(e.Level) {
+		return ce.AddCore(e, c)
+	}
+	return ce
+}
+
+func (zapCounter) Write(e zapcore.Entry, _ []zapcore.Field) error {
+	if e.Level == zapcore.WarnLevel {
+		CountLog(LogWarn)
+	} else {
+		CountLog(LogError)
+	}
+	return nil
+}
+
+func (zapCounter) Sync() error {
+	return nil
+}
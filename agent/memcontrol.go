@@ -0,0 +1,134 @@
+package agent
+
+import (
+	"expvar"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// gcPercent is the active GOGC, only known when set through the agent
+var gcPercent = initialGCPercent()
+
+func init() {
+	expvar.Publish("gcPercent", expvar.Func(func() interface{} {
+		return atomic.LoadInt64(&gcPercent)
+	}))
+	expvar.Publish("memoryLimit", expvar.Func(func() interface{} {
+		return memoryLimit()
+	}))
+}
+
+func initialGCPercent() int64 {
+	v := os.Getenv("GOGC")
+	if v == "off" {
+		return -1
+	}
+	if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return n
+	}
+	return 100
+}
+
+// MemoryControl keeps the heap under the memory limit of the container by
+// adjusting GOGC within bounds and setting GOMEMLIMIT
+type MemoryControl struct {
+	// Limit is the memory limit in bytes, read from the cgroup when 0
+	Limit int64
+	// Target is the fraction of Limit set as GOMEMLIMIT, GOGC is lowered
+	// when the heap gets close to it and raised when far below
+	Target       float64
+	MinGCPercent int
+	MaxGCPercent int
+	Interval     time.Duration
+}
+
+var DefaultMemoryControl = MemoryControl{
+	Target:       0.9,
+	MinGCPercent: 25,
+	MaxGCPercent: 200,
+	Interval:     5 * time.Second,
+}
+
+// StartMemoryControl starts the controller, it does nothing when no
+// limit is given nor found in the cgroup. A zero Interval is the one of
+// DefaultMemoryControl. The returned func stops it.
+func StartMemoryControl(mc MemoryControl) (stop func()) {
+	if mc.Interval <= 0 {
+		mc.Interval = DefaultMemoryControl.Interval
+	}
+	limit := mc.Limit
+	if limit == 0 {
+		limit = cgroupMemoryLimit()
+	}
+	if limit <= 0 || mc.Target <= 0 {
+		return func() {}
+	}
+	target := int64(float64(limit) * mc.Target)
+	setMemoryLimit(target)
+
+	done := make(chan struct{})
+	go func() {
+		t := time.NewTicker(mc.Interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				mc.adjust(target)
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+func (mc *MemoryControl) adjust(target int64) {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	current := atomic.LoadInt64(&gcPercent)
+	if current < 0 {
+		return
+	}
+	next := current
+	switch usage := float64(m.HeapAlloc) / float64(target); {
+	case usage > 0.8:
+		next = current / 2
+	case usage < 0.4:
+		next = current * 2
+	}
+	if next < int64(mc.MinGCPercent) {
+		next = int64(mc.MinGCPercent)
+	}
+	if next > int64(mc.MaxGCPercent) {
+		next = int64(mc.MaxGCPercent)
+	}
+	if next != current {
+		debug.SetGCPercent(int(next))
+		atomic.StoreInt64(&gcPercent, next)
+	}
+}
+
+// cgroupMemoryLimit returns the memory limit of the cgroup v2 or v1,
+// 0 when there is none
+func cgroupMemoryLimit() int64 {
+	for _, f := range []string{"/sys/fs/cgroup/memory.max", "/sys/fs/cgroup/memory/memory.limit_in_bytes"} {
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			continue
+		}
+		n, err := strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+		// "max" or a huge v1 value means unlimited
+		if err != nil || n >= 1<<62 {
+			return 0
+		}
+		return n
+	}
+	return 0
+}
@@ -0,0 +1,22 @@
+//go:build go1.19
+// +build go1.19
+
+package agent
+
+import (
+	"math"
+	"runtime/debug"
+)
+
+// memoryLimit returns GOMEMLIMIT, 0 if no limit is set
+func memoryLimit() int64 {
+	limit := debug.SetMemoryLimit(-1)
+	if limit == math.MaxInt64 {
+		return 0
+	}
+	return limit
+}
+
+func setMemoryLimit(limit int64) {
+	debug.SetMemoryLimit(limit)
+}
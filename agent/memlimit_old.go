@@ -0,0 +1,12 @@
+//go:build !go1.19
+// +build !go1.19
+
+package agent
+
+// memoryLimit returns 0, GOMEMLIMIT only exists since go1.19
+func memoryLimit() int64 {
+	return 0
+}
+
+// setMemoryLimit does nothing, the controller only adjusts GOGC
+func setMemoryLimit(limit int64) {}
@@ -0,0 +1,71 @@
+package agent
+
+import (
+	"expvar"
+	"runtime"
+	"sync/atomic"
+
+	"github.com/jursonmo/gomonitor/model"
+)
+
+var finalizersSet, finalizersRun int64
+
+// cgoMemory reports the bytes allocated by C, set by SetCgoMemoryFunc
+var cgoMemory atomic.Value
+
+func init() {
+	expvar.Publish("offHeap", expvar.Func(func() interface{} {
+		set := atomic.LoadInt64(&finalizersSet)
+		run := atomic.LoadInt64(&finalizersRun)
+		return model.OffHeap{
+			FinalizersPending: set - run,
+			FinalizersRun:     run,
+			CgoEstimated:      cgoEstimated(),
+		}
+	}))
+}
+
+// SetFinalizer is runtime.SetFinalizer counting the finalizers set and
+// run, the ones pending are reported. A nil finalizer clears the one of
+// obj, which must have been set by this func, and counts as run.
+func SetFinalizer(obj interface{}, finalizer func(interface{})) {
+	if finalizer == nil {
+		runtime.SetFinalizer(obj, nil)
+		atomic.AddInt64(&finalizersRun, 1)
+		return
+	}
+	atomic.AddInt64(&finalizersSet, 1)
+	runtime.SetFinalizer(obj, func(o interface{}) {
+		atomic.AddInt64(&finalizersRun, 1)
+		finalizer(o)
+	})
+}
+
+// SetCgoMemoryFunc sets the func reporting the bytes allocated by C, e.g.
+// from the stats of the malloc in use, instead of the estimate
+func SetCgoMemoryFunc(f func() int64) {
+	cgoMemory.Store(f)
+}
+
+// cgoEstimated returns the bytes allocated by C, estimated as the
+// anonymous resident memory not mapped by Go when no func reports them.
+// It is 0 when the app made no cgo call.
+func cgoEstimated() int64 {
+	if f, ok := cgoMemory.Load().(func() int64); ok && f != nil {
+		return f()
+	}
+	// the runtime makes one call at init
+	if runtime.NumCgoCall() <= 1 {
+		return 0
+	}
+	anon := rssAnon()
+	if anon == 0 {
+		return 0
+	}
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	if est := anon - int64(m.Sys-m.HeapReleased); est > 0 {
+		return est
+	}
+	return 0
+}
@@ -0,0 +1,6 @@
+package agent
+
+// rssAnon returns the anonymous resident memory of the process
+func rssAnon() int64 {
+	return kBField("/proc/self/status", "RssAnon")
+}
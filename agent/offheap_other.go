@@ -0,0 +1,9 @@
+//go:build !linux
+// +build !linux
+
+package agent
+
+// rssAnon returns 0, the anonymous resident memory is only read on linux
+func rssAnon() int64 {
+	return 0
+}
@@ -0,0 +1,74 @@
+package agent
+
+import (
+	"expvar"
+	"math"
+	"runtime"
+	"runtime/metrics"
+	"sync/atomic"
+	"time"
+
+	"github.com/jursonmo/gomonitor/model"
+)
+
+// overhead accounts the cost of the agent, updated atomically
+var overhead struct {
+	cycles     int64
+	collectNs  int64
+	allocBytes int64
+	cpuNs      int64
+	bytesSent  int64
+}
+
+func init() {
+	expvar.Publish("overhead", expvar.Func(func() interface{} {
+		o := model.Overhead{
+			Cycles:     atomic.LoadInt64(&overhead.cycles),
+			CollectNs:  atomic.LoadInt64(&overhead.collectNs),
+			AllocBytes: atomic.LoadInt64(&overhead.allocBytes),
+			CPUNs:      atomic.LoadInt64(&overhead.cpuNs),
+			BytesSent:  atomic.LoadInt64(&overhead.bytesSent),
+		}
+		if p != nil && o.CPUNs > 0 {
+			if t, err := p.Times(); err == nil && t.User+t.System > 0 {
+				// the times of the process are in ticks, coarser than the ones
+				// of the threads
+				o.CPUPercent = math.Min(float64(o.CPUNs)/((t.User+t.System)*1e9)*100, 100)
+			}
+		}
+		return o
+	}))
+}
+
+// measureCycle starts accounting a collection cycle, the returned func
+// ends it less the time waited. The goroutine is locked to its thread for
+// the CPU time of the thread to be the one of the cycle.
+func measureCycle() (end func(waited time.Duration)) {
+	runtime.LockOSThread()
+	start := time.Now()
+	cpu := threadCPUNs()
+	allocs := heapAllocs()
+	return func(waited time.Duration) {
+		atomic.AddInt64(&overhead.cpuNs, threadCPUNs()-cpu)
+		runtime.UnlockOSThread()
+		atomic.StoreInt64(&overhead.allocBytes, heapAllocs()-allocs)
+		atomic.StoreInt64(&overhead.collectNs, int64(time.Since(start)-waited))
+		atomic.AddInt64(&overhead.cycles, 1)
+	}
+}
+
+// countSent counts the payload bytes sent
+func countSent(n int) {
+	atomic.AddInt64(&overhead.bytesSent, int64(n))
+}
+
+// heapAllocs returns the bytes allocated by the process, 0 when the
+// runtime does not have the metric
+func heapAllocs() int64 {
+	s := []metrics.Sample{{Name: "/gc/heap/allocs:bytes"}}
+	metrics.Read(s)
+	if s[0].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return int64(s[0].Value.Uint64())
+}
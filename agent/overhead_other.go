@@ -0,0 +1,9 @@
+//go:build !linux
+// +build !linux
+
+package agent
+
+// threadCPUNs returns 0, the CPU time of the threads is only read on linux
+func threadCPUNs() int64 {
+	return 0
+}
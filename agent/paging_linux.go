@@ -0,0 +1,81 @@
+package agent
+
+import (
+	"bufio"
+	"expvar"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/jursonmo/gomonitor/model"
+)
+
+func init() {
+	expvar.Publish("paging", expvar.Func(func() interface{} {
+		return paging()
+	}))
+}
+
+// paging reads the page faults and the swap of the process, and the swap
+// of the host
+func paging() model.Paging {
+	var p model.Paging
+	// pid (comm) state ppid ... minflt cminflt majflt, comm may hold spaces
+	if b, err := ioutil.ReadFile("/proc/self/stat"); err == nil {
+		s := string(b)
+		fs := strings.Fields(s[strings.LastIndexByte(s, ')')+1:])
+		if len(fs) > 9 {
+			p.MinorFaults, _ = strconv.ParseInt(fs[7], 10, 64)
+			p.MajorFaults, _ = strconv.ParseInt(fs[9], 10, 64)
+		}
+	}
+	p.SwapBytes = kBField("/proc/self/status", "VmSwap")
+	p.HostSwapTotal = kBField("/proc/meminfo", "SwapTotal")
+	if p.HostSwapTotal > 0 {
+		p.HostSwapUsed = p.HostSwapTotal - kBField("/proc/meminfo", "SwapFree")
+	}
+	if f, err := os.Open("/proc/vmstat"); err == nil {
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			fs := strings.Fields(sc.Text())
+			if len(fs) != 2 {
+				continue
+			}
+			switch fs[0] {
+			case "pswpin":
+				p.HostSwapIns, _ = strconv.ParseInt(fs[1], 10, 64)
+			case "pswpout":
+				p.HostSwapOuts, _ = strconv.ParseInt(fs[1], 10, 64)
+			}
+		}
+		f.Close()
+	}
+	return p
+}
+
+// kBField returns in bytes the "name: n kB" line of a /proc file
+func kBField(path, name string) int64 {
+	return kBFields(path)[name]
+}
+
+// kBFields returns in bytes the "name: n kB" lines of a /proc file
+func kBFields(path string) map[string]int64 {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	fields := make(map[string]int64)
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		name, value := splitField(sc.Text())
+		if !strings.HasSuffix(value, " kB") {
+			continue
+		}
+		if kB, err := strconv.ParseInt(strings.TrimSuffix(value, " kB"), 10, 64); err == nil {
+			fields[name] = kB * 1024
+		}
+	}
+	return fields
+}
@@ -0,0 +1,87 @@
+package agent
+
+import (
+	"bufio"
+	"expvar"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"runtime/debug"
+	"strings"
+)
+
+var panics = expvar.NewInt("panics")
+var lastPanic = expvar.NewString("lastPanic")
+
+// Recover reports a panic to the runtime data instead of crashing,
+// it must be deferred directly: defer agent.Recover()
+func Recover() {
+	if r := recover(); r != nil {
+		reportPanic(fmt.Sprintf("panic: %v\n\n%s", r, debug.Stack()))
+	}
+}
+
+// Go runs f in a goroutine, reporting a panic instead of crashing
+func Go(f func()) {
+	go func() {
+		defer Recover()
+		f()
+	}()
+}
+
+func reportPanic(msg string) {
+	panics.Add(1)
+	lastPanic.Set(msg)
+}
+
+// stackLine matches the lines following a panic message in a stack dump
+var stackLine = regexp.MustCompile(`^($|goroutine \d+ \[|\t|created by |\S+\(.*\)$)`)
+
+// TeeStderr replaces os.Stderr with a pipe copied to the original stderr,
+// counting the panics written through it, e.g. by a recovering http
+// server or logger. The std logger is redirected too unless it was set
+// to write elsewhere. The runtime writes fatal crashes to the file
+// descriptor directly, those are not seen.
+func TeeStderr() error {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	stderr := os.Stderr
+	os.Stderr = w
+	// the std logger, used by net/http, keeps the stderr it started with
+	if log.Writer() == io.Writer(stderr) {
+		log.SetOutput(w)
+	}
+
+	go teePanics(r, stderr)
+	return nil
+}
+
+// maxStderrLine is the longest line the panics are looked for in, stderr
+// is only copied after a longer one
+const maxStderrLine = 1 << 20
+
+// teePanics copies r to stderr, reporting the panics written to it
+func teePanics(r io.Reader, stderr io.Writer) {
+	scanner := bufio.NewScanner(io.TeeReader(r, stderr))
+	scanner.Buffer(nil, maxStderrLine)
+	var msg []string
+	for scanner.Scan() {
+		line := scanner.Text()
+		if msg != nil && stackLine.MatchString(line) {
+			msg = append(msg, line)
+			lastPanic.Set(strings.Join(msg, "\n"))
+			continue
+		}
+		msg = nil
+		if strings.Contains(line, "panic: ") || strings.Contains(line, "panic serving ") {
+			msg = []string{line}
+			reportPanic(line)
+		}
+	}
+	// the writers of the pipe would block once it is full
+	io.Copy(stderr, r)
+}
@@ -0,0 +1,35 @@
+package agent
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestTeePanicsLongLine(t *testing.T) {
+	// the panic after a line beyond maxStderrLine is only copied
+	for n, want := range map[int]int64{100 << 10: 1, 2 * maxStderrLine: 0} {
+		before := panics.Value()
+		in := strings.Repeat("x", n) + "\npanic: boom\n\ngoroutine 1 [running]:\nmain.main()\n"
+		r, w := io.Pipe()
+		var out bytes.Buffer
+		done := make(chan struct{})
+		go func() {
+			teePanics(r, &out)
+			close(done)
+		}()
+		if _, err := io.WriteString(w, in); err != nil {
+			t.Fatal(err)
+		}
+		w.Close()
+		<-done
+
+		if out.String() != in {
+			t.Errorf("line of %d bytes: copied %d bytes of %d", n, out.Len(), len(in))
+		}
+		if got := panics.Value() - before; got != want {
+			t.Errorf("line of %d bytes: %d panics reported, want %d", n, got, want)
+		}
+	}
+}
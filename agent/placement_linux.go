@@ -0,0 +1,124 @@
+package agent
+
+import (
+	"bufio"
+	"expvar"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jursonmo/gomonitor/model"
+)
+
+// numaRefresh is how often the NUMA distribution is read, walking
+// numa_maps costs as much as the memory of the process is large
+const numaRefresh = 30 * time.Second
+
+var numa struct {
+	sync.Mutex
+	nodes map[string]int64
+	at    time.Time
+}
+
+func init() {
+	expvar.Publish("placement", expvar.Func(func() interface{} {
+		return placement()
+	}))
+}
+
+// placement reads where the process may run and where its memory is:
+// its CPU and memory node affinity, the CPUs of its cpuset cgroup and
+// its memory per NUMA node
+func placement() model.Placement {
+	var p model.Placement
+	if f, err := os.Open("/proc/self/status"); err == nil {
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			switch name, value := splitField(sc.Text()); name {
+			case "Cpus_allowed_list":
+				p.CPUs = value
+				p.CPUCount = cpuListCount(value)
+			case "Mems_allowed_list":
+				p.MemNodes = value
+			}
+		}
+		f.Close()
+	}
+	for _, f := range []string{
+		"/sys/fs/cgroup/cpuset.cpus.effective",
+		"/sys/fs/cgroup/cpuset/cpuset.effective_cpus",
+		"/sys/fs/cgroup/cpuset/cpuset.cpus",
+	} {
+		if b, err := ioutil.ReadFile(f); err == nil {
+			p.CgroupCPUs = strings.TrimSpace(string(b))
+			break
+		}
+	}
+
+	numa.Lock()
+	defer numa.Unlock()
+	if time.Since(numa.at) >= numaRefresh {
+		numa.nodes = numaNodes()
+		numa.at = time.Now()
+	}
+	p.NUMA = numa.nodes
+	return p
+}
+
+// cpuListCount counts the CPUs of a list like "0-3,8"
+func cpuListCount(list string) int {
+	n := 0
+	for _, r := range strings.Split(list, ",") {
+		lo, hi := r, r
+		if i := strings.IndexByte(r, '-'); i >= 0 {
+			lo, hi = r[:i], r[i+1:]
+		}
+		a, err1 := strconv.Atoi(lo)
+		b, err2 := strconv.Atoi(hi)
+		if err1 == nil && err2 == nil && b >= a {
+			n += b - a + 1
+		}
+	}
+	return n
+}
+
+// numaNodes returns the bytes of the process per NUMA node, e.g. "0",
+// summing the "N0=pages" of the mappings in /proc/self/numa_maps
+func numaNodes() map[string]int64 {
+	f, err := os.Open("/proc/self/numa_maps")
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	nodes := make(map[string]int64)
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		pageSize := int64(4096)
+		pages := make(map[string]int64)
+		for _, kv := range strings.Fields(sc.Text()) {
+			i := strings.IndexByte(kv, '=')
+			if i < 0 {
+				continue
+			}
+			n, err := strconv.ParseInt(kv[i+1:], 10, 64)
+			if err != nil {
+				continue
+			}
+			switch k := kv[:i]; {
+			case k == "kernelpagesize_kB":
+				pageSize = n * 1024
+			case len(k) > 1 && k[0] == 'N':
+				pages[k[1:]] += n
+			}
+		}
+		for node, n := range pages {
+			nodes[node] += n * pageSize
+		}
+	}
+	return nodes
+}
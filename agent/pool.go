@@ -0,0 +1,151 @@
+package agent
+
+import (
+	"expvar"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jursonmo/gomonitor/model"
+)
+
+// poolLatencies is how many of the last task latencies the percentiles
+// of a pool are computed from
+const poolLatencies = 1024
+
+var pools struct {
+	sync.Mutex
+	m map[string]*Pool
+}
+
+func init() {
+	expvar.Publish("pools", expvar.Func(func() interface{} {
+		pools.Lock()
+		defer pools.Unlock()
+		if len(pools.m) == 0 {
+			return nil
+		}
+		m := make(map[string]model.Pool, len(pools.m))
+		for name, p := range pools.m {
+			m[name] = p.stats()
+		}
+		return m
+	}))
+}
+
+// Pool is a worker pool whose queue depth, busy workers and task
+// latency percentiles are published by name
+type Pool struct {
+	name      string
+	workers   int
+	tasks     chan func()
+	wg        sync.WaitGroup
+	busy      int64
+	completed int64
+
+	mu        sync.Mutex
+	latencies []time.Duration
+	next      int
+}
+
+// NewPool starts workers goroutines running the tasks submitted, queue
+// of which may wait for a worker. A pool of the same name replaces the
+// previous one in the payload.
+func NewPool(name string, workers, queue int) *Pool {
+	if workers < 1 {
+		workers = 1
+	}
+	p := &Pool{name: name, workers: workers, tasks: make(chan func(), queue)}
+	p.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go p.work()
+	}
+	pools.Lock()
+	if pools.m == nil {
+		pools.m = make(map[string]*Pool)
+	}
+	pools.m[name] = p
+	pools.Unlock()
+	return p
+}
+
+// Submit queues task, blocking while the queue is full
+func (p *Pool) Submit(task func()) {
+	p.tasks <- task
+}
+
+// TrySubmit queues task unless the queue is full
+func (p *Pool) TrySubmit(task func()) bool {
+	select {
+	case p.tasks <- task:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close waits for the tasks queued to be done and removes the pool from
+// the payload, no task may be submitted after
+func (p *Pool) Close() {
+	close(p.tasks)
+	p.wg.Wait()
+	pools.Lock()
+	if pools.m[p.name] == p {
+		delete(pools.m, p.name)
+	}
+	pools.Unlock()
+}
+
+func (p *Pool) work() {
+	defer p.wg.Done()
+	for task := range p.tasks {
+		p.run(task)
+	}
+}
+
+func (p *Pool) run(task func()) {
+	atomic.AddInt64(&p.busy, 1)
+	start := time.Now()
+	defer func() {
+		p.observe(time.Since(start))
+		atomic.AddInt64(&p.busy, -1)
+		atomic.AddInt64(&p.completed, 1)
+	}()
+	task()
+}
+
+func (p *Pool) observe(d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.latencies) < poolLatencies {
+		p.latencies = append(p.latencies, d)
+		return
+	}
+	p.latencies[p.next] = d
+	p.next = (p.next + 1) % poolLatencies
+}
+
+func (p *Pool) stats() model.Pool {
+	s := model.Pool{
+		Workers:   p.workers,
+		Busy:      atomic.LoadInt64(&p.busy),
+		Queued:    len(p.tasks),
+		QueueCap:  cap(p.tasks),
+		Completed: atomic.LoadInt64(&p.completed),
+	}
+	p.mu.Lock()
+	latencies := append([]time.Duration(nil), p.latencies...)
+	p.mu.Unlock()
+	if len(latencies) == 0 {
+		return s
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	percentile := func(q float64) float64 {
+		return float64(latencies[int(q*float64(len(latencies)-1))]) / float64(time.Millisecond)
+	}
+	s.LatencyP50Ms = percentile(0.5)
+	s.LatencyP90Ms = percentile(0.9)
+	s.LatencyP99Ms = percentile(0.99)
+	return s
+}
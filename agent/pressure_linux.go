@@ -0,0 +1,83 @@
+package agent
+
+import (
+	"bufio"
+	"expvar"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/jursonmo/gomonitor/model"
+)
+
+func init() {
+	expvar.Publish("pressure", expvar.Func(func() interface{} {
+		return pressure()
+	}))
+}
+
+var pressureResources = []string{"cpu", "memory", "io"}
+
+// pressure reads the pressure stall information of the host, keyed by
+// resource, and of the cgroup v2 of the process, keyed "cgroup.<resource>"
+func pressure() map[string]model.PSI {
+	psi := make(map[string]model.PSI)
+	for _, r := range pressureResources {
+		if p, ok := readPSI("/proc/pressure/" + r); ok {
+			psi[r] = p
+		}
+		// the unified hierarchy of a hybrid setup
+		for _, dir := range []string{"/sys/fs/cgroup/", "/sys/fs/cgroup/unified/"} {
+			if p, ok := readPSI(dir + r + ".pressure"); ok {
+				psi["cgroup."+r] = p
+				break
+			}
+		}
+	}
+	return psi
+}
+
+// readPSI parses "some avg10=0.00 avg60=0.00 avg300=0.00 total=0" and
+// the full line
+func readPSI(path string) (model.PSI, bool) {
+	var p model.PSI
+	f, err := os.Open(path)
+	if err != nil {
+		return p, false
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fs := strings.Fields(sc.Text())
+		if len(fs) == 0 {
+			continue
+		}
+		var l *model.PSILine
+		switch fs[0] {
+		case "some":
+			l = &p.Some
+		case "full":
+			l = &p.Full
+		default:
+			continue
+		}
+		for _, kv := range fs[1:] {
+			i := strings.IndexByte(kv, '=')
+			if i < 0 {
+				continue
+			}
+			switch kv[:i] {
+			case "avg10":
+				l.Avg10, _ = strconv.ParseFloat(kv[i+1:], 64)
+			case "avg60":
+				l.Avg60, _ = strconv.ParseFloat(kv[i+1:], 64)
+			case "avg300":
+				l.Avg300, _ = strconv.ParseFloat(kv[i+1:], 64)
+			case "total":
+				l.Total, _ = strconv.ParseInt(kv[i+1:], 10, 64)
+			}
+		}
+	}
+	return p, true
+}
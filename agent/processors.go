@@ -0,0 +1,52 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+
+	"github.com/jursonmo/gomonitor/processor"
+)
+
+var processors struct {
+	sync.Mutex
+	chain processor.Chain
+}
+
+// SetProcessors sets the processors transforming the runtime data before
+// it is emitted, its fields named by their dotted path, e.g.
+// memstats.HeapAlloc, and the labels being the tags. An invalid config
+// keeps the processors set. Renaming or dropping the serial or the seq
+// breaks their use by the collector.
+func SetProcessors(cfgs []processor.Config) error {
+	chain, err := processor.New(cfgs)
+	if err != nil {
+		return err
+	}
+	processors.Lock()
+	processors.chain = chain
+	processors.Unlock()
+	return nil
+}
+
+// runProcessors runs the processors on the payload
+func runProcessors(body []byte) []byte {
+	processors.Lock()
+	chain := processors.chain
+	processors.Unlock()
+	if len(chain) == 0 {
+		return body
+	}
+	var root map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if dec.Decode(&root) != nil {
+		return body
+	}
+	chain.Process(processor.Tree{Root: root, TagsKey: "labels"})
+	b, err := json.Marshal(root)
+	if err != nil {
+		return body
+	}
+	return b
+}
@@ -0,0 +1,53 @@
+package agent
+
+import (
+	"bufio"
+	"expvar"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/jursonmo/gomonitor/model"
+)
+
+func init() {
+	expvar.Publish("procIO", expvar.Func(func() interface{} {
+		return procIO()
+	}))
+}
+
+// procIO reads the I/O counters of the process from /proc/self/io, the
+// bytes are those which reached the storage layer
+func procIO() model.ProcIO {
+	var io model.ProcIO
+	f, err := os.Open("/proc/self/io")
+	if err != nil {
+		return io
+	}
+	defer f.Close()
+
+	counters := map[string]*int64{
+		"read_bytes":  &io.ReadBytes,
+		"write_bytes": &io.WriteBytes,
+		"syscr":       &io.ReadSyscalls,
+		"syscw":       &io.WriteSyscalls,
+	}
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		// read_bytes: 4096
+		name, value := splitField(sc.Text())
+		if p, ok := counters[name]; ok {
+			*p, _ = strconv.ParseInt(value, 10, 64)
+		}
+	}
+	return io
+}
+
+// splitField splits a "name: value" line of /proc
+func splitField(line string) (string, string) {
+	i := strings.IndexByte(line, ':')
+	if i < 0 {
+		return "", ""
+	}
+	return line[:i], strings.TrimSpace(line[i+1:])
+}
@@ -0,0 +1,135 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// skipped vars and memstats arrays are not exported to Prometheus
+var promSkipped = map[string]bool{
+	"cmdline":  true,
+	"labels":   true,
+	"events":   true,
+	"BySize":   true,
+	"PauseNs":  true,
+	"PauseEnd": true,
+}
+
+// PrometheusHandler serves the same runtime data as Handler in the
+// Prometheus text format, usually at /metrics. Every number or boolean of
+// the vars, custom ones included, is a gauge named by its path, e.g.
+// gomonitor_memstats_HeapAlloc, labeled with the serial and the labels.
+// The latency of the requests measured by Middleware and the gc cycles
+// follow, served in the OpenMetrics format with the trace ids of recent
+// requests as exemplars when the scraper accepts it.
+func PrometheusHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		consumer := consumerOf(r)
+		body, _, n := sample(consumer)
+		// the seq is not served
+		release(consumer, n)
+		var vars map[string]interface{}
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.UseNumber()
+		if err := dec.Decode(&vars); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		samples := make(map[string]string)
+		for k, v := range vars {
+			promFlatten(samples, "gomonitor_"+promName(k), v)
+		}
+		names := make([]string, 0, len(samples))
+		for name := range samples {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		lbls := promLabels(vars)
+		openMetrics := strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text")
+		if openMetrics {
+			w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+		} else {
+			w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		}
+		for _, name := range names {
+			fmt.Fprintf(w, "# TYPE %s gauge\n%s%s %s\n", name, name, lbls, samples[name])
+		}
+
+		var numGC int64
+		if m, ok := vars["memstats"].(map[string]interface{}); ok {
+			if n, ok := m["NumGC"].(json.Number); ok {
+				numGC, _ = n.Int64()
+			}
+		}
+		writeLatency(w, lbls, numGC, openMetrics)
+		if openMetrics {
+			fmt.Fprintln(w, "# EOF")
+		}
+	})
+}
+
+func promFlatten(samples map[string]string, name string, v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			if !promSkipped[k] {
+				promFlatten(samples, name+"_"+promName(k), e)
+			}
+		}
+	case json.Number:
+		samples[name] = v.String()
+	case bool:
+		if v {
+			samples[name] = "1"
+		} else {
+			samples[name] = "0"
+		}
+	}
+}
+
+var promEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// promLabels returns the serial and the labels in the Prometheus format
+func promLabels(vars map[string]interface{}) string {
+	lbls := map[string]string{}
+	if m, ok := vars["labels"].(map[string]interface{}); ok {
+		for k, v := range m {
+			if s, ok := v.(string); ok {
+				lbls[promName(k)] = s
+			}
+		}
+	}
+	if s, ok := vars["serial"].(string); ok && s != "" {
+		lbls["serial"] = s
+	}
+	if len(lbls) == 0 {
+		return ""
+	}
+
+	keys := make([]string, 0, len(lbls))
+	for k := range lbls {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + `="` + promEscaper.Replace(lbls[k]) + `"`
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// promName replaces the characters not allowed in Prometheus names
+func promName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' {
+			return r
+		}
+		return '_'
+	}, s)
+}
@@ -0,0 +1,171 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Push posts the runtime data to a collector every Interval. With Watch
+// set it only reports on change: the data is pushed when a watched value
+// moved by more than Threshold (0.1 is 10%) since the last push, or at
+// the latest after MaxInterval as a heartbeat. With WALFile set, the
+// payloads failing to push are buffered there, up to WALMaxBytes, and
+// replayed once the collector is reachable again; they carry the clock
+// of when they were sampled.
+type Push struct {
+	URL      string
+	Interval time.Duration
+	Header   http.Header
+	Client   *http.Client
+
+	// Watch are dotted paths in the runtime data, e.g. "memstats.HeapAlloc"
+	Watch       []string
+	Threshold   float64
+	MaxInterval time.Duration
+
+	WALFile     string
+	WALMaxBytes int64
+}
+
+var DefaultPush = Push{
+	Interval:    10 * time.Second,
+	Client:      &http.Client{Timeout: 10 * time.Second},
+	Watch:       []string{"goroutineNum", "threadNum", "cpuPercent", "memstats.HeapAlloc", "memstats.NumGC"},
+	Threshold:   0.1,
+	MaxInterval: 5 * time.Minute,
+	WALMaxBytes: 64 << 20,
+}
+
+// StartPush starts pushing, the returned func stops it. A zero Interval
+// is the one of DefaultPush.
+func StartPush(p Push) (stop func()) {
+	if p.Interval <= 0 {
+		p.Interval = DefaultPush.Interval
+	}
+	var w *wal
+	if p.WALFile != "" {
+		w = &wal{path: p.WALFile, max: p.WALMaxBytes}
+	}
+
+	consumer := "push " + p.URL
+	done := make(chan struct{})
+	go func() {
+		t := time.NewTicker(p.Interval)
+		defer t.Stop()
+
+		var last map[string]float64
+		var lastPush time.Time
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-t.C:
+				body, _, n := sample(consumer)
+				watched := p.watched(body)
+				if last != nil && now.Sub(lastPush) < p.MaxInterval && !changed(last, watched, p.Threshold) {
+					release(consumer, n)
+					continue
+				}
+				// the backlog goes first, the collector sees seq in order
+				if w != nil {
+					if err := w.replay(p.post); err != nil {
+						w.append(body)
+						continue
+					}
+				}
+				if err := p.post(body); err != nil {
+					if w != nil {
+						w.append(body)
+					}
+					continue
+				}
+				last, lastPush = watched, now
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+func (p *Push) post(body []byte) error {
+	body, contentType, err := seal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, p.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range p.Header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", contentType)
+	if err = sign(req.Header, body); err != nil {
+		return err
+	}
+
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("push to %s: status code %d", p.URL, resp.StatusCode)
+	}
+	countSent(len(body))
+	return nil
+}
+
+// watched returns the watched values of the payload
+func (p *Push) watched(body []byte) map[string]float64 {
+	if len(p.Watch) == 0 {
+		return nil
+	}
+	var data map[string]interface{}
+	json.Unmarshal(body, &data)
+
+	values := make(map[string]float64, len(p.Watch))
+	for _, path := range p.Watch {
+		var v interface{} = data
+		for _, k := range strings.Split(path, ".") {
+			m, _ := v.(map[string]interface{})
+			v = m[k]
+		}
+		if f, ok := v.(float64); ok {
+			values[path] = f
+		}
+	}
+	return values
+}
+
+// changed tells if a value moved by more than threshold, always true
+// when nothing is watched
+func changed(last, current map[string]float64, threshold float64) bool {
+	if current == nil {
+		return true
+	}
+	for k, v := range current {
+		prev, ok := last[k]
+		if !ok {
+			return true
+		}
+		if prev == 0 {
+			if v != 0 {
+				return true
+			}
+			continue
+		}
+		if math.Abs(v-prev)/math.Abs(prev) > threshold {
+			return true
+		}
+	}
+	return false
+}
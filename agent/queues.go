@@ -0,0 +1,52 @@
+package agent
+
+import (
+	"expvar"
+	"sync"
+
+	"github.com/jursonmo/gomonitor/model"
+)
+
+type queue struct {
+	len, cap func() int
+}
+
+var queues struct {
+	sync.Mutex
+	m map[string]queue
+}
+
+func init() {
+	expvar.Publish("queues", expvar.Func(func() interface{} {
+		queues.Lock()
+		defer queues.Unlock()
+		if len(queues.m) == 0 {
+			return nil
+		}
+		m := make(map[string]model.Queue, len(queues.m))
+		for name, q := range queues.m {
+			m[name] = model.Queue{Len: q.len(), Cap: q.cap()}
+		}
+		return m
+	}))
+}
+
+// WatchChan registers a channel or queue whose length and capacity are
+// sampled on every scrape, e.g. WatchChan("jobs", func() int { return
+// len(jobs) }, func() int { return cap(jobs) }). It replaces the one of
+// the same name.
+func WatchChan(name string, lenFn, capFn func() int) {
+	queues.Lock()
+	defer queues.Unlock()
+	if queues.m == nil {
+		queues.m = make(map[string]queue)
+	}
+	queues.m[name] = queue{len: lenFn, cap: capFn}
+}
+
+// UnwatchChan unregisters the channel or queue of name
+func UnwatchChan(name string) {
+	queues.Lock()
+	defer queues.Unlock()
+	delete(queues.m, name)
+}
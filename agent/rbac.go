@@ -0,0 +1,176 @@
+package agent
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Role grants access to the agent endpoints, a role includes the lower ones
+type Role int
+
+const (
+	RoleNone Role = iota
+	// RoleReader reads the runtime data, /debug and /metrics
+	RoleReader
+	// RoleOperator runs control actions
+	RoleOperator
+	// RoleAdmin changes the configuration of the app
+	RoleAdmin
+)
+
+// Identity is who made a request
+type Identity struct {
+	Name string
+	Role Role
+}
+
+// Authenticator identifies the caller of a request
+type Authenticator interface {
+	Identify(req *http.Request) (Identity, bool)
+}
+
+// TokenAuth grants Role to the callers presenting the bearer Token
+type TokenAuth struct {
+	Name  string
+	Token string
+	Role  Role
+}
+
+func (a TokenAuth) Identify(req *http.Request) (Identity, bool) {
+	token := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if a.Token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(a.Token)) != 1 {
+		return Identity{}, false
+	}
+	return Identity{Name: a.Name, Role: a.Role}, true
+}
+
+// CertOURoles maps the organizational units of the verified mTLS client
+// certificate to roles, the identity is named after its common name
+type CertOURoles map[string]Role
+
+func (m CertOURoles) Identify(req *http.Request) (Identity, bool) {
+	if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 || len(req.TLS.VerifiedChains[0]) == 0 {
+		return Identity{}, false
+	}
+	cert := req.TLS.VerifiedChains[0][0]
+	id := Identity{Name: cert.Subject.CommonName}
+	for _, ou := range cert.Subject.OrganizationalUnit {
+		if r := m[ou]; r > id.Role {
+			id.Role = r
+		}
+	}
+	return id, id.Role != RoleNone
+}
+
+// JWTRoles verifies HS256 bearer tokens signed with Secret and maps the
+// values of the Claim claim to roles, the identity is named after "sub"
+type JWTRoles struct {
+	Secret []byte
+	Claim  string
+	Roles  map[string]Role
+}
+
+func (j JWTRoles) Identify(req *http.Request) (Identity, bool) {
+	parts := strings.Split(strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer "), ".")
+	if len(parts) != 3 {
+		return Identity{}, false
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if !decodeSegment(parts[0], &header) || header.Alg != "HS256" {
+		return Identity{}, false
+	}
+	mac := hmac.New(sha256.New, j.Secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(sig, mac.Sum(nil)) {
+		return Identity{}, false
+	}
+
+	var claims map[string]interface{}
+	if !decodeSegment(parts[1], &claims) {
+		return Identity{}, false
+	}
+	if exp, ok := claims["exp"].(float64); ok && time.Now().Unix() > int64(exp) {
+		return Identity{}, false
+	}
+
+	id := Identity{}
+	id.Name, _ = claims["sub"].(string)
+	var values []interface{}
+	switch v := claims[j.Claim].(type) {
+	case string:
+		values = []interface{}{v}
+	case []interface{}:
+		values = v
+	}
+	for _, v := range values {
+		if s, ok := v.(string); ok && j.Roles[s] > id.Role {
+			id.Role = j.Roles[s]
+		}
+	}
+	return id, id.Role != RoleNone
+}
+
+func decodeSegment(seg string, v interface{}) bool {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	return err == nil && json.Unmarshal(b, v) == nil
+}
+
+// FirstOf identifies the caller with the first authenticator succeeding
+func FirstOf(auths ...Authenticator) Authenticator {
+	return firstOf(auths)
+}
+
+type firstOf []Authenticator
+
+func (f firstOf) Identify(req *http.Request) (Identity, bool) {
+	for _, a := range f {
+		if id, ok := a.Identify(req); ok {
+			return id, true
+		}
+	}
+	return Identity{}, false
+}
+
+type identityKey struct{}
+
+// IdentityFrom returns the identity set by RequireRole
+func IdentityFrom(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(Identity)
+	return id, ok
+}
+
+// RequireRole serves h only to the callers identified with at least role
+func RequireRole(role Role, auth Authenticator, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		id, ok := auth.Identify(req)
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if id.Role < role {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), identityKey{}, id)))
+	})
+}
+
+// RequireRoleOf serves h to everyone when no authenticator is given, as
+// before any token was configured, else as RequireRole
+func RequireRoleOf(role Role, auths []Authenticator, h http.Handler) http.Handler {
+	if len(auths) == 0 {
+		return h
+	}
+	return RequireRole(role, FirstOf(auths...), h)
+}
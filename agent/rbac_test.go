@@ -0,0 +1,134 @@
+package agent
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var okHandler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+	w.Write([]byte("[]"))
+})
+
+func status(h http.Handler, token string) int {
+	req := httptest.NewRequest(http.MethodGet, "/debug/vars", nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestRequireRoleOfNoToken(t *testing.T) {
+	h := RequireRoleOf(RoleReader, nil, okHandler)
+	if code := status(h, ""); code != http.StatusOK {
+		t.Errorf("without token configured: status %d, want 200", code)
+	}
+
+	h = RequireRoleOf(RoleReader, []Authenticator{TokenAuth{Name: "reader", Token: "r", Role: RoleReader}}, okHandler)
+	for token, want := range map[string]int{"": http.StatusUnauthorized, "x": http.StatusUnauthorized, "r": http.StatusOK} {
+		if code := status(h, token); code != want {
+			t.Errorf("token %q: status %d, want %d", token, code, want)
+		}
+	}
+}
+
+func TestAggregateToken(t *testing.T) {
+	sibling := httptest.NewServer(RequireRole(RoleReader, TokenAuth{Name: "reader", Token: "r", Role: RoleReader}, okHandler))
+	defer sibling.Close()
+
+	for token, want := range map[string]string{"": "[]", "r": "[[]]"} {
+		w := httptest.NewRecorder()
+		AggregateTokenHandler([]string{sibling.URL}, time.Second, token).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/aggregate", nil))
+		if got := w.Body.String(); got != want {
+			t.Errorf("token %q: body %s, want %s", token, got, want)
+		}
+	}
+}
+
+func jwt(t *testing.T, secret string, alg string, claims map[string]interface{}) string {
+	t.Helper()
+	seg := func(v interface{}) string {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	unsigned := seg(map[string]string{"alg": alg, "typ": "JWT"}) + "." + seg(claims)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestIdentify(t *testing.T) {
+	j := JWTRoles{Secret: []byte("s3cret"), Claim: "groups", Roles: map[string]Role{"sre": RoleOperator, "admins": RoleAdmin}}
+	exp := float64(time.Now().Add(time.Hour).Unix())
+	ou := func(ous ...string) *tls.ConnectionState {
+		cert := &x509.Certificate{Subject: pkix.Name{CommonName: "scraper", OrganizationalUnit: ous}}
+		return &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	}
+	tests := []struct {
+		name  string
+		auth  Authenticator
+		token string
+		tls   *tls.ConnectionState
+		want  Identity
+		ok    bool
+	}{
+		{"token", TokenAuth{Name: "reader", Token: "r", Role: RoleReader}, "r", nil, Identity{"reader", RoleReader}, true},
+		{"wrong token", TokenAuth{Name: "reader", Token: "r", Role: RoleReader}, "x", nil, Identity{}, false},
+		{"empty token never matches", TokenAuth{Name: "reader", Role: RoleReader}, "", nil, Identity{}, false},
+
+		{"jwt highest role", j, jwt(t, "s3cret", "HS256", map[string]interface{}{"sub": "ann", "groups": []string{"sre", "admins"}, "exp": exp}), nil, Identity{"ann", RoleAdmin}, true},
+		{"jwt string claim", j, jwt(t, "s3cret", "HS256", map[string]interface{}{"sub": "bob", "groups": "sre"}), nil, Identity{"bob", RoleOperator}, true},
+		{"jwt no role", j, jwt(t, "s3cret", "HS256", map[string]interface{}{"sub": "eve", "groups": "guests"}), nil, Identity{}, false},
+		{"jwt wrong secret", j, jwt(t, "other", "HS256", map[string]interface{}{"sub": "eve", "groups": "admins"}), nil, Identity{}, false},
+		{"jwt other alg", j, jwt(t, "s3cret", "none", map[string]interface{}{"sub": "eve", "groups": "admins"}), nil, Identity{}, false},
+		{"jwt expired", j, jwt(t, "s3cret", "HS256", map[string]interface{}{"sub": "ann", "groups": "admins", "exp": float64(time.Now().Add(-time.Minute).Unix())}), nil, Identity{}, false},
+
+		{"cert ou", CertOURoles{"metrics": RoleReader, "ops": RoleOperator}, "", ou("metrics", "ops"), Identity{"scraper", RoleOperator}, true},
+		{"cert unknown ou", CertOURoles{"ops": RoleOperator}, "", ou("dev"), Identity{}, false},
+		{"no cert", CertOURoles{"ops": RoleOperator}, "", nil, Identity{}, false},
+
+		{"first of", FirstOf(TokenAuth{Name: "reader", Token: "r", Role: RoleReader}, TokenAuth{Name: "control", Token: "c", Role: RoleAdmin}), "c", nil, Identity{"control", RoleAdmin}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/debug/vars", nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			req.TLS = tt.tls
+			id, ok := tt.auth.Identify(req)
+			if ok != tt.ok || ok && id != tt.want {
+				t.Errorf("Identify = %+v, %v, want %+v, %v", id, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	auth := FirstOf(TokenAuth{Name: "reader", Token: "r", Role: RoleReader}, TokenAuth{Name: "control", Token: "c", Role: RoleAdmin})
+	var got Identity
+	h := RequireRole(RoleOperator, auth, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		got, _ = IdentityFrom(req.Context())
+	}))
+	for token, want := range map[string]int{"": http.StatusUnauthorized, "r": http.StatusForbidden, "c": http.StatusOK} {
+		if code := status(h, token); code != want {
+			t.Errorf("token %q: status %d, want %d", token, code, want)
+		}
+	}
+	if got != (Identity{"control", RoleAdmin}) {
+		t.Errorf("identity %+v in the context of the handler", got)
+	}
+}
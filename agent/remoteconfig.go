@@ -0,0 +1,88 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/jursonmo/gomonitor/model"
+)
+
+// maxRemoteConfigs is how many remote configs are kept to roll back to
+const maxRemoteConfigs = 8
+
+// remoteConfigs are the configs sent by the collector, the last one is
+// applied
+var remoteConfigs struct {
+	sync.Mutex
+	history []remoteConfig
+}
+
+type remoteConfig struct {
+	version int64
+	cfg     *fileConfig
+}
+
+// remoteConfigVersion returns the version of the remote config applied,
+// 0 for none
+func remoteConfigVersion() int64 {
+	remoteConfigs.Lock()
+	defer remoteConfigs.Unlock()
+	if n := len(remoteConfigs.history); n > 0 {
+		return remoteConfigs.history[n-1].version
+	}
+	return 0
+}
+
+// configure applies a config of the collector, or rolls back to the one
+// before. A remote config may not change the channel, which would cut
+// off the collector.
+func (ch *Channel) configure(m model.ChannelMessage) model.ChannelMessage {
+	res := model.ChannelMessage{Type: model.ChannelResult, ID: m.ID}
+	who := "channel@" + ch.URL
+	version, err := applyRemoteConfig(m)
+	if err != nil {
+		recordAction(who, m.Type, err.Error(), false)
+		res.Result = err.Error()
+		return res
+	}
+	res.OK, res.Version = true, version
+	res.Result = "config version " + strconv.FormatInt(version, 10)
+	recordAction(who, m.Type, res.Result, true)
+	return res
+}
+
+func applyRemoteConfig(m model.ChannelMessage) (int64, error) {
+	remoteConfigs.Lock()
+	defer remoteConfigs.Unlock()
+	h := remoteConfigs.history
+
+	if m.Type == model.ChannelRollback {
+		if len(h) < 2 {
+			return 0, errors.New("no config to roll back to")
+		}
+		prev := h[len(h)-2]
+		agentConfig.apply(prev.cfg)
+		remoteConfigs.history = h[:len(h)-1]
+		return prev.version, nil
+	}
+
+	if m.Version <= 0 {
+		return 0, errors.New("the version of the config must be positive")
+	}
+	cfg, err := decodeConfig(m.Config)
+	if err != nil {
+		return 0, fmt.Errorf("config version %d: %s", m.Version, err)
+	}
+	if cfg.Channel != nil {
+		return 0, fmt.Errorf("config version %d: the channel can't be configured remotely", m.Version)
+	}
+	agentConfig.apply(cfg)
+	h = append(h, remoteConfig{version: m.Version, cfg: cfg})
+	if len(h) > maxRemoteConfigs {
+		h = h[len(h)-maxRemoteConfigs:]
+	}
+	remoteConfigs.history = h
+	return m.Version, nil
+}
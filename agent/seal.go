@@ -0,0 +1,43 @@
+package agent
+
+import (
+	"sync"
+
+	"github.com/jursonmo/gomonitor/model"
+)
+
+// payloadKey seals the payloads served and pushed when set
+var payloadKey struct {
+	sync.RWMutex
+	id  string
+	key []byte
+}
+
+// SetPayloadKey seals the payloads with AES-GCM under the key, of 16, 24
+// or 32 bytes, sent along with its id so the collector picks the key. A
+// key per device is set with the serial as id. Keys are rotated by adding
+// the new key to the collector before setting it here. An empty key
+// stops sealing.
+func SetPayloadKey(id string, key []byte) error {
+	if len(key) > 0 {
+		if _, err := model.Seal(id, key, nil); err != nil {
+			return err
+		}
+	}
+	payloadKey.Lock()
+	defer payloadKey.Unlock()
+	payloadKey.id, payloadKey.key = id, append([]byte(nil), key...)
+	return nil
+}
+
+// seal returns the body sealed when a key is set, and its content type
+func seal(body []byte) ([]byte, string, error) {
+	payloadKey.RLock()
+	id, key := payloadKey.id, payloadKey.key
+	payloadKey.RUnlock()
+	if len(key) == 0 {
+		return body, "application/json; charset=utf-8", nil
+	}
+	sealed, err := model.Seal(id, key, body)
+	return sealed, model.SealedContentType, err
+}
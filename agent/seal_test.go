@@ -0,0 +1,44 @@
+package agent
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jursonmo/gomonitor/model"
+)
+
+func TestSeal(t *testing.T) {
+	defer SetPayloadKey("", nil)
+	body := []byte(`{"serial":"edge-a"}`)
+
+	got, contentType, err := seal(body)
+	if err != nil || string(got) != string(body) || contentType != "application/json; charset=utf-8" {
+		t.Fatalf("without key: %q, %q, %v", got, contentType, err)
+	}
+
+	if err := SetPayloadKey("edge-a", []byte("short")); err == nil {
+		t.Error("a 5 byte key is accepted")
+	}
+	key := []byte("0123456789abcdef")
+	if err := SetPayloadKey("edge-a", key); err != nil {
+		t.Fatal(err)
+	}
+	got, contentType, err = seal(body)
+	if err != nil || contentType != model.SealedContentType || !model.IsSealed(got) {
+		t.Fatalf("with key: %q, %q, %v", got, contentType, err)
+	}
+	opened, err := model.Open(got, func(id string) ([]byte, error) {
+		if id != "edge-a" {
+			return nil, errors.New("unknown key " + id)
+		}
+		return key, nil
+	})
+	if err != nil || string(opened) != string(body) {
+		t.Errorf("opened %q, %v", opened, err)
+	}
+
+	SetPayloadKey("", nil)
+	if got, _, _ := seal(body); model.IsSealed(got) {
+		t.Error("sealed after the key is removed")
+	}
+}
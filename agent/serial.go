@@ -0,0 +1,101 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// SerialProvider returns the serial identifying the app, any callback
+// can be used as a provider
+type SerialProvider func() (string, error)
+
+// SetSerialFrom sets the serial from the first provider succeeding
+func SetSerialFrom(providers ...SerialProvider) error {
+	var errs []string
+	for _, p := range providers {
+		s, err := p()
+		if err == nil && s != "" {
+			SetSerial(s)
+			return nil
+		}
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	return fmt.Errorf("no serial found: %s", strings.Join(errs, "; "))
+}
+
+// MachineID provides the systemd machine id
+func MachineID() (string, error) {
+	for _, f := range []string{"/etc/machine-id", "/var/lib/dbus/machine-id"} {
+		if b, err := ioutil.ReadFile(f); err == nil {
+			return strings.TrimSpace(string(b)), nil
+		}
+	}
+	return "", errors.New("machine-id not found")
+}
+
+// Hostname provides the host name
+func Hostname() (string, error) {
+	return os.Hostname()
+}
+
+// MACAddress provides the hardware address of the first interface which
+// is up and not a loopback
+func MACAddress() (string, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return "", err
+	}
+	for _, i := range ifaces {
+		if i.Flags&net.FlagUp == 0 || i.Flags&net.FlagLoopback != 0 || len(i.HardwareAddr) == 0 {
+			continue
+		}
+		return i.HardwareAddr.String(), nil
+	}
+	return "", errors.New("no mac address found")
+}
+
+var metadataClient = &http.Client{Timeout: 2 * time.Second}
+
+// EC2InstanceID provides the instance id from the EC2 metadata service,
+// using an IMDSv2 session token
+func EC2InstanceID() (string, error) {
+	req, _ := http.NewRequest(http.MethodPut, "http://169.254.169.254/latest/api/token", nil)
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "60")
+	token, err := metadata(req)
+	if err != nil {
+		return "", err
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, "http://169.254.169.254/latest/meta-data/instance-id", nil)
+	req.Header.Set("X-aws-ec2-metadata-token", token)
+	return metadata(req)
+}
+
+// GCEInstanceID provides the instance id from the GCE metadata server
+func GCEInstanceID() (string, error) {
+	req, _ := http.NewRequest(http.MethodGet, "http://metadata.google.internal/computeMetadata/v1/instance/id", nil)
+	req.Header.Set("Metadata-Flavor", "Google")
+	return metadata(req)
+}
+
+func metadata(req *http.Request) (string, error) {
+	resp, err := metadataClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("metadata %s: status code %d", req.URL, resp.StatusCode)
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	return strings.TrimSpace(string(b)), err
+}
@@ -0,0 +1,48 @@
+package agent
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/jursonmo/gomonitor/model"
+)
+
+// signingKey signs the payloads served and pushed when set
+var signingKey struct {
+	sync.RWMutex
+	id, alg string
+	key     []byte
+}
+
+// SetSigningKey signs the payloads as sent, sealed or not, with alg,
+// model.SignHMACSHA256 under a shared secret or model.SignEd25519 under
+// a private key or seed, in the model.SignatureHeader. An empty key
+// stops signing.
+func SetSigningKey(id, alg string, key []byte) error {
+	if len(key) > 0 {
+		if _, err := model.Sign(id, alg, key, nil, time.Now()); err != nil {
+			return err
+		}
+	}
+	signingKey.Lock()
+	defer signingKey.Unlock()
+	signingKey.id, signingKey.alg, signingKey.key = id, alg, append([]byte(nil), key...)
+	return nil
+}
+
+// sign sets the signature of the body in the header when a key is set
+func sign(h http.Header, body []byte) error {
+	signingKey.RLock()
+	id, alg, key := signingKey.id, signingKey.alg, signingKey.key
+	signingKey.RUnlock()
+	if len(key) == 0 {
+		return nil
+	}
+	s, err := model.Sign(id, alg, key, body, time.Now())
+	if err != nil {
+		return err
+	}
+	h.Set(model.SignatureHeader, s.String())
+	return nil
+}
@@ -0,0 +1,42 @@
+package agent
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/jursonmo/gomonitor/model"
+)
+
+func TestSign(t *testing.T) {
+	defer SetSigningKey("", "", nil)
+	body := []byte(`{"serial":"edge-a"}`)
+
+	h := http.Header{}
+	if err := sign(h, body); err != nil || h.Get(model.SignatureHeader) != "" {
+		t.Fatalf("without key: %q, %v", h.Get(model.SignatureHeader), err)
+	}
+
+	if err := SetSigningKey("k1", "md5", []byte("secret")); err == nil {
+		t.Error("an unknown algorithm is accepted")
+	}
+	key := []byte("secret")
+	if err := SetSigningKey("k1", model.SignHMACSHA256, key); err != nil {
+		t.Fatal(err)
+	}
+	if err := sign(h, body); err != nil {
+		t.Fatal(err)
+	}
+	s, err := model.ParseSignature(h.Get(model.SignatureHeader))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.KeyID != "k1" || s.Alg != model.SignHMACSHA256 {
+		t.Errorf("signature %+v", s)
+	}
+	if err := s.Verify(model.SignHMACSHA256, key, body); err != nil {
+		t.Errorf("verify: %v", err)
+	}
+	if err := s.Verify(model.SignHMACSHA256, key, []byte(`{"serial":"edge-b"}`)); err == nil {
+		t.Error("verified another body")
+	}
+}
@@ -0,0 +1,311 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jursonmo/gomonitor/model"
+)
+
+// Sink sends the runtime data somewhere, e.g. a broker or a statsd
+// server. Send gets the JSON payload of a sample, the sink seals and
+// signs it if its transport needs it. The pulls keep being served by
+// Handler.
+type Sink interface {
+	Name() string
+	Send(ctx context.Context, payload []byte) error
+}
+
+// Sinks fans the runtime data sampled every Interval out to Sinks. Each
+// sink sends from its own buffer of Buffer payloads, the oldest dropped
+// when it is full, so a slow or failing sink does not hold up the
+// others. A send failing, panicking or lasting more than Timeout is an
+// error of its sink, the payload is not sent again.
+type Sinks struct {
+	Interval time.Duration
+	Sinks    []Sink
+	Buffer   int
+	Timeout  time.Duration
+}
+
+var DefaultSinks = Sinks{
+	Interval: 10 * time.Second,
+	Buffer:   16,
+	Timeout:  10 * time.Second,
+}
+
+// sinkState is a sink, its buffer and its counters
+type sinkState struct {
+	sink    Sink
+	timeout time.Duration
+	buffer  chan []byte
+
+	sent, errors, dropped int64
+	lastError             atomic.Value
+}
+
+var sinks struct {
+	sync.Mutex
+	m map[string]*sinkState
+}
+
+func init() {
+	expvar.Publish("sinks", expvar.Func(func() interface{} {
+		sinks.Lock()
+		defer sinks.Unlock()
+		if len(sinks.m) == 0 {
+			return nil
+		}
+		m := make(map[string]model.Sink, len(sinks.m))
+		for name, s := range sinks.m {
+			lastError, _ := s.lastError.Load().(string)
+			m[name] = model.Sink{
+				Sent:      atomic.LoadInt64(&s.sent),
+				Errors:    atomic.LoadInt64(&s.errors),
+				Dropped:   atomic.LoadInt64(&s.dropped),
+				Queued:    len(s.buffer),
+				LastError: lastError,
+			}
+		}
+		return m
+	}))
+}
+
+// StartSinks starts the fan-out, the returned func stops it. Zero fields
+// are the ones of DefaultSinks.
+func StartSinks(s Sinks) (stop func()) {
+	if s.Interval <= 0 {
+		s.Interval = DefaultSinks.Interval
+	}
+	if s.Buffer <= 0 {
+		s.Buffer = DefaultSinks.Buffer
+	}
+	if s.Timeout <= 0 {
+		s.Timeout = DefaultSinks.Timeout
+	}
+	done := make(chan struct{})
+	states := make([]*sinkState, len(s.Sinks))
+	sinks.Lock()
+	if sinks.m == nil {
+		sinks.m = make(map[string]*sinkState)
+	}
+	for i, sink := range s.Sinks {
+		st := &sinkState{sink: sink, timeout: s.Timeout, buffer: make(chan []byte, s.Buffer)}
+		st.lastError.Store("")
+		states[i] = st
+		sinks.m[sink.Name()] = st
+		go st.run(done)
+	}
+	sinks.Unlock()
+
+	// the sinks share one sequence, a payload dropped by a sink is a gap
+	consumer := "sinks"
+	go func() {
+		t := time.NewTicker(s.Interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+			}
+			body, _, _ := sample(consumer)
+			for _, st := range states {
+				st.enqueue(body)
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			sinks.Lock()
+			defer sinks.Unlock()
+			for _, st := range states {
+				if sinks.m[st.sink.Name()] == st {
+					delete(sinks.m, st.sink.Name())
+				}
+			}
+		})
+	}
+}
+
+// enqueue buffers the payload, dropping the oldest one when full
+func (st *sinkState) enqueue(body []byte) {
+	for {
+		select {
+		case st.buffer <- body:
+			return
+		default:
+		}
+		select {
+		case <-st.buffer:
+			atomic.AddInt64(&st.dropped, 1)
+		default:
+		}
+	}
+}
+
+func (st *sinkState) run(done chan struct{}) {
+	for {
+		select {
+		case <-done:
+			return
+		case body := <-st.buffer:
+			if err := st.send(body); err != nil {
+				atomic.AddInt64(&st.errors, 1)
+				st.lastError.Store(err.Error())
+				continue
+			}
+			atomic.AddInt64(&st.sent, 1)
+		}
+	}
+}
+
+// send sends the payload, a panic of the sink is its error
+func (st *sinkState) send(body []byte) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), st.timeout)
+	defer cancel()
+	return st.sink.Send(ctx, body)
+}
+
+type sinkFunc struct {
+	name string
+	send func(ctx context.Context, payload []byte) error
+}
+
+func (s sinkFunc) Name() string { return s.name }
+
+func (s sinkFunc) Send(ctx context.Context, payload []byte) error { return s.send(ctx, payload) }
+
+// PushSink posts the payloads to the url of the push, sealed and signed,
+// its Watch and WAL are not used
+func PushSink(name string, p Push) Sink {
+	if p.Client == nil {
+		p.Client = DefaultPush.Client
+	}
+	return sinkFunc{name, func(ctx context.Context, payload []byte) error {
+		return p.post(payload)
+	}}
+}
+
+// FileSink appends the payloads to the file at path as lines of JSON,
+// e.g. for a log shipper tailing it
+func FileSink(name, path string) Sink {
+	var mu sync.Mutex
+	return sinkFunc{name, func(ctx context.Context, payload []byte) error {
+		var line bytes.Buffer
+		if err := json.Compact(&line, payload); err != nil {
+			return err
+		}
+		line.WriteByte('\n')
+		mu.Lock()
+		defer mu.Unlock()
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return err
+		}
+		if _, err = f.Write(line.Bytes()); err != nil {
+			f.Close()
+			return err
+		}
+		if err = f.Close(); err == nil {
+			countSent(line.Len())
+		}
+		return err
+	}}
+}
+
+// statsdDatagram is the largest datagram sent to statsd, to stay under
+// the MTU
+const statsdDatagram = 1432
+
+// StatsdSink sends the numbers of the payloads as statsd gauges over UDP
+// to addr, named prefix.<dotted path>, e.g. gomonitor.memstats.HeapAlloc
+func StatsdSink(name, addr, prefix string) Sink {
+	return sinkFunc{name, func(ctx context.Context, payload []byte) error {
+		var vars map[string]interface{}
+		dec := json.NewDecoder(bytes.NewReader(payload))
+		dec.UseNumber()
+		if err := dec.Decode(&vars); err != nil {
+			return err
+		}
+		gauges := make(map[string]string)
+		for k, v := range vars {
+			if !promSkipped[k] {
+				statsdFlatten(gauges, prefix+"."+statsdName(k), v)
+			}
+		}
+		names := make([]string, 0, len(gauges))
+		for name := range gauges {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "udp", addr)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		var buf bytes.Buffer
+		flush := func() error {
+			if buf.Len() == 0 {
+				return nil
+			}
+			_, err := conn.Write(bytes.TrimSuffix(buf.Bytes(), []byte("\n")))
+			countSent(buf.Len())
+			buf.Reset()
+			return err
+		}
+		for _, name := range names {
+			line := name + ":" + gauges[name] + "|g\n"
+			if buf.Len()+len(line) > statsdDatagram {
+				if err = flush(); err != nil {
+					return err
+				}
+			}
+			buf.WriteString(line)
+		}
+		return flush()
+	}}
+}
+
+// statsdFlatten collects the numbers and booleans of v by dotted path
+func statsdFlatten(gauges map[string]string, name string, v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			if !promSkipped[k] {
+				statsdFlatten(gauges, name+"."+statsdName(k), e)
+			}
+		}
+	case json.Number:
+		gauges[name] = v.String()
+	case bool:
+		if v {
+			gauges[name] = "1"
+		} else {
+			gauges[name] = "0"
+		}
+	}
+}
+
+// statsdName replaces the characters of the statsd syntax in a name
+var statsdName = strings.NewReplacer(":", "_", "|", "_", "@", "_", "\n", "_").Replace
@@ -0,0 +1,161 @@
+package agent
+
+import (
+	"bufio"
+	"errors"
+	"expvar"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// SLO is the availability objective of the requests served by Middleware,
+// a response with a 5xx status being an error. The burn rate of a window
+// is its error ratio over the error budget 1-Target, 1 spending the budget
+// exactly over the SLO period.
+type SLO struct {
+	Target      float64
+	ShortWindow time.Duration
+	LongWindow  time.Duration
+}
+
+// DefaultSLO is the objective set by SetSLO for a zero Target or window,
+// the 5m and 1h windows of the multiwindow burn rate alerts
+var DefaultSLO = SLO{
+	Target:      0.999,
+	ShortWindow: 5 * time.Minute,
+	LongWindow:  time.Hour,
+}
+
+// sloBucket is the width of the buckets counting the requests
+const sloBucket = 10 * time.Second
+
+var slo struct {
+	sync.Mutex
+	SLO
+	set      bool
+	requests []int64
+	errors   []int64
+	starts   []int64 // the start of the buckets, in sloBucket units
+}
+
+func init() {
+	expvar.Publish("slo", expvar.Func(func() interface{} {
+		slo.Lock()
+		defer slo.Unlock()
+		if !slo.set {
+			return nil
+		}
+		return map[string]interface{}{
+			"target":        slo.Target,
+			"shortBurnRate": burnRate(slo.ShortWindow),
+			"longBurnRate":  burnRate(slo.LongWindow),
+		}
+	}))
+}
+
+// SetSLO reports the burn rates of the requests served by Middleware
+// against s over its windows
+func SetSLO(s SLO) {
+	if s.Target <= 0 || s.Target >= 1 {
+		s.Target = DefaultSLO.Target
+	}
+	if s.ShortWindow <= 0 {
+		s.ShortWindow = DefaultSLO.ShortWindow
+	}
+	if s.LongWindow <= 0 {
+		s.LongWindow = DefaultSLO.LongWindow
+	}
+	n := int(s.LongWindow / sloBucket)
+	if m := int(s.ShortWindow / sloBucket); m > n {
+		n = m
+	}
+
+	slo.Lock()
+	defer slo.Unlock()
+	slo.SLO = s
+	slo.set = true
+	slo.requests = make([]int64, n+1)
+	slo.errors = make([]int64, n+1)
+	slo.starts = make([]int64, n+1)
+}
+
+func observeStatus(status int) {
+	now := time.Now().UnixNano() / int64(sloBucket)
+
+	slo.Lock()
+	defer slo.Unlock()
+	if !slo.set {
+		return
+	}
+	i := int(now % int64(len(slo.starts)))
+	if slo.starts[i] != now {
+		slo.starts[i] = now
+		slo.requests[i] = 0
+		slo.errors[i] = 0
+	}
+	slo.requests[i]++
+	if status >= 500 {
+		slo.errors[i]++
+	}
+}
+
+// burnRate returns the burn rate over the window, slo must be locked
+func burnRate(window time.Duration) float64 {
+	now := time.Now().UnixNano() / int64(sloBucket)
+	n := int64(window / sloBucket)
+	var requests, failed int64
+	for i, start := range slo.starts {
+		if now-start < n {
+			requests += slo.requests[i]
+			failed += slo.errors[i]
+		}
+	}
+	if requests == 0 {
+		return 0
+	}
+	return float64(failed) / float64(requests) / (1 - slo.Target)
+}
+
+// statusWriter keeps the status of the response, passing flushes and
+// hijacks through
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("agent: the response writer is no http.Hijacker")
+	}
+	// a hijacked connection has no status, it is no error
+	w.status = http.StatusSwitchingProtocols
+	return h.Hijack()
+}
+
+// Unwrap returns the wrapped writer, for http.ResponseController
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,28 @@
+package agent
+
+import (
+	"expvar"
+
+	"github.com/jursonmo/gomonitor/model"
+)
+
+func init() {
+	expvar.Publish("memOS", expvar.Func(func() interface{} {
+		return memOS()
+	}))
+}
+
+// memOS breaks the resident memory of the process down from
+// /proc/self/smaps_rollup, the memory the OS accounts to it unlike the
+// memstats of Go
+func memOS() model.MemOS {
+	r := kBFields("/proc/self/smaps_rollup")
+	return model.MemOS{
+		RSS:     r["Rss"],
+		PSS:     r["Pss"],
+		Anon:    r["Anonymous"],
+		File:    r["Rss"] - r["Anonymous"],
+		Shared:  r["Shared_Clean"] + r["Shared_Dirty"],
+		Private: r["Private_Clean"] + r["Private_Dirty"],
+	}
+}
@@ -0,0 +1,171 @@
+package agent
+
+import (
+	"bufio"
+	"expvar"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/jursonmo/gomonitor/model"
+)
+
+func init() {
+	expvar.Publish("sockets", expvar.Func(func() interface{} {
+		return socketStats()
+	}))
+}
+
+// the states of /proc/net/tcp, see include/net/tcp_states.h
+const (
+	tcpEstablished = 0x01
+	tcpSynSent     = 0x02
+	tcpSynRecv     = 0x03
+	tcpFinWait1    = 0x04
+	tcpFinWait2    = 0x05
+	tcpCloseWait   = 0x08
+	tcpListen      = 0x0a
+)
+
+// socket is a line of /proc/net/tcp and the like
+type socket struct {
+	localPort uint16
+	state     int
+	rxQueue   int64
+	inode     uint64
+}
+
+// socketStats counts the sockets open by the process. Sockets in
+// TIME_WAIT belong to no process anymore and are not counted.
+func socketStats() model.Sockets {
+	var s model.Sockets
+	for _, sock := range ownSockets("tcp", "tcp6") {
+		switch sock.state {
+		case tcpEstablished:
+			s.TCP.Established++
+		case tcpSynSent:
+			s.TCP.SynSent++
+		case tcpSynRecv:
+			s.TCP.SynRecv++
+		case tcpFinWait1, tcpFinWait2:
+			s.TCP.FinWait++
+		case tcpCloseWait:
+			s.TCP.CloseWait++
+		case tcpListen:
+			s.TCP.Listen++
+			// the connections waiting to be accepted
+			s.ListenQueue += sock.rxQueue
+		default:
+			s.TCP.Other++
+		}
+	}
+	s.UDP = int64(len(ownSockets("udp", "udp6")))
+	s.ListenDrops = listenDrops()
+	return s
+}
+
+// socketInodes returns the inodes of the sockets open by the process
+func socketInodes() map[uint64]bool {
+	inodes := make(map[uint64]bool)
+	fds, _ := filepath.Glob("/proc/self/fd/*")
+	for _, fd := range fds {
+		link, err := os.Readlink(fd)
+		if err != nil || !strings.HasPrefix(link, "socket:[") {
+			continue
+		}
+		inode, err := strconv.ParseUint(strings.TrimSuffix(link[len("socket:["):], "]"), 10, 64)
+		if err == nil {
+			inodes[inode] = true
+		}
+	}
+	return inodes
+}
+
+// ownSockets returns the sockets of the process in the tables, e.g. "tcp"
+// and "tcp6"
+func ownSockets(tables ...string) []socket {
+	inodes := socketInodes()
+	var sockets []socket
+	for _, table := range tables {
+		f, err := os.Open("/proc/self/net/" + table)
+		if err != nil {
+			continue
+		}
+		sc := bufio.NewScanner(f)
+		sc.Scan() // header
+		for sc.Scan() {
+			s, ok := parseSocket(sc.Text())
+			if ok && inodes[s.inode] {
+				sockets = append(sockets, s)
+			}
+		}
+		f.Close()
+	}
+	return sockets
+}
+
+// parseSocket parses "sl local_address rem_address st tx_queue:rx_queue
+// tr:tm->when retrnsmt uid timeout inode ..."
+func parseSocket(line string) (socket, bool) {
+	fs := strings.Fields(line)
+	if len(fs) < 10 {
+		return socket{}, false
+	}
+	var s socket
+	i := strings.LastIndexByte(fs[1], ':')
+	port, err := strconv.ParseUint(fs[1][i+1:], 16, 16)
+	if err != nil {
+		return s, false
+	}
+	st, err := strconv.ParseUint(fs[3], 16, 8)
+	if err != nil {
+		return s, false
+	}
+	i = strings.IndexByte(fs[4], ':')
+	rx, err := strconv.ParseInt(fs[4][i+1:], 16, 64)
+	if err != nil {
+		return s, false
+	}
+	inode, err := strconv.ParseUint(fs[9], 10, 64)
+	if err != nil {
+		return s, false
+	}
+	s.localPort = uint16(port)
+	s.state = int(st)
+	s.rxQueue = rx
+	s.inode = inode
+	return s, true
+}
+
+// listenDrops returns the connections dropped by the full accept queues
+// of the network namespace, the kernel does not count them per socket
+func listenDrops() int64 {
+	f, err := os.Open("/proc/self/net/netstat")
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+
+	// a line of names followed by a line of values per protocol
+	var names []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fs := strings.Fields(sc.Text())
+		if len(fs) == 0 || fs[0] != "TcpExt:" {
+			continue
+		}
+		if names == nil {
+			names = fs
+			continue
+		}
+		for i, name := range names {
+			if name == "ListenDrops" && i < len(fs) {
+				n, _ := strconv.ParseInt(fs[i], 10, 64)
+				return n
+			}
+		}
+		return 0
+	}
+	return 0
+}
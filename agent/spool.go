@@ -0,0 +1,175 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jursonmo/gomonitor/model"
+)
+
+// the formats of the spool
+const (
+	SpoolJSON = "json"
+	SpoolLine = "line"
+)
+
+// Spool writes the runtime data to files in Dir every Interval instead of
+// serving or pushing it, for devices without a collector in reach. Each
+// sample is a line of JSON, or of InfluxDB line protocol with Format
+// SpoolLine. The file being written ends in .open, it is renamed to
+// <unix nanos of its first sample>.json, or .lp, once it reaches
+// MaxFileBytes; the oldest files are removed to stay under MaxTotalBytes.
+// The json files are what the import_dir of the goruntime input reads.
+type Spool struct {
+	Dir         string
+	Interval    time.Duration
+	Format      string
+	Measurement string
+
+	MaxFileBytes  int64
+	MaxTotalBytes int64
+}
+
+var DefaultSpool = Spool{
+	Interval:      10 * time.Second,
+	Format:        SpoolJSON,
+	Measurement:   "goruntime_m",
+	MaxFileBytes:  8 << 20,
+	MaxTotalBytes: 256 << 20,
+}
+
+// StartSpool starts spooling, the returned func stops it and closes the
+// file being written. Zero fields are the ones of DefaultSpool.
+func StartSpool(s Spool) (stop func(), err error) {
+	if s.Interval <= 0 {
+		s.Interval = DefaultSpool.Interval
+	}
+	if s.Format == "" {
+		s.Format = DefaultSpool.Format
+	}
+	if s.Format != SpoolJSON && s.Format != SpoolLine {
+		return nil, fmt.Errorf("spool format %q: must be %q or %q", s.Format, SpoolJSON, SpoolLine)
+	}
+	if s.Measurement == "" {
+		s.Measurement = DefaultSpool.Measurement
+	}
+	if s.MaxFileBytes <= 0 {
+		s.MaxFileBytes = DefaultSpool.MaxFileBytes
+	}
+	if s.MaxTotalBytes <= 0 {
+		s.MaxTotalBytes = DefaultSpool.MaxTotalBytes
+	}
+	if err = os.MkdirAll(s.Dir, 0700); err != nil {
+		return nil, err
+	}
+	// files left open by a crash are complete up to their last line
+	open, _ := filepath.Glob(filepath.Join(s.Dir, "*.open"))
+	for _, f := range open {
+		os.Rename(f, strings.TrimSuffix(f, ".open"))
+	}
+
+	consumer := "spool " + s.Dir
+	w := &spoolWriter{Spool: s}
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		t := time.NewTicker(s.Interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				w.rotate()
+				return
+			case now := <-t.C:
+				body, _, n := sample(consumer)
+				if err := w.write(body, now); err != nil {
+					release(consumer, n)
+					recordEvent("agent", "spool", err.Error(), false)
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}, nil
+}
+
+type spoolWriter struct {
+	Spool
+	f    *os.File
+	name string
+	size int64
+}
+
+func (w *spoolWriter) ext() string {
+	if w.Format == SpoolLine {
+		return ".lp"
+	}
+	return ".json"
+}
+
+func (w *spoolWriter) write(body []byte, now time.Time) error {
+	var line bytes.Buffer
+	if w.Format == SpoolLine {
+		var rd model.RuntimeData
+		if err := json.Unmarshal(body, &rd); err != nil {
+			return err
+		}
+		fields := rd.Fields()
+		line.WriteString(fields.ToLineProtocol(w.Measurement, now))
+	} else if err := json.Compact(&line, body); err != nil {
+		return err
+	}
+	line.WriteByte('\n')
+
+	if w.f != nil && w.size+int64(line.Len()) > w.MaxFileBytes {
+		w.rotate()
+	}
+	if w.f == nil {
+		w.name = filepath.Join(w.Dir, fmt.Sprintf("%d%s", now.UnixNano(), w.ext()))
+		f, err := os.OpenFile(w.name+".open", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return err
+		}
+		w.f, w.size = f, 0
+	}
+	n, err := w.f.Write(line.Bytes())
+	w.size += int64(n)
+	return err
+}
+
+// rotate closes the file being written and removes the oldest files
+// beyond MaxTotalBytes
+func (w *spoolWriter) rotate() {
+	if w.f == nil {
+		return
+	}
+	w.f.Close()
+	w.f = nil
+	os.Rename(w.name+".open", w.name)
+
+	var files []string
+	for _, ext := range []string{".json", ".lp"} {
+		matches, _ := filepath.Glob(filepath.Join(w.Dir, "*"+ext))
+		files = append(files, matches...)
+	}
+	sort.Slice(files, func(i, j int) bool { return filepath.Base(files[i]) > filepath.Base(files[j]) })
+	var total int64
+	for _, f := range files {
+		fi, err := os.Stat(f)
+		if err != nil {
+			continue
+		}
+		if total += fi.Size(); total > w.MaxTotalBytes {
+			os.Remove(f)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package agent
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func spooled(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestSpoolRotate(t *testing.T) {
+	// each sample takes 8 bytes with its newline, 2 fit in a file and 4
+	// in the spool
+	dir := t.TempDir()
+	w := &spoolWriter{Spool: Spool{Dir: dir, Format: SpoolJSON, MaxFileBytes: 16, MaxTotalBytes: 32}}
+	start := time.Unix(1600000000, 0)
+	at := func(i int) time.Time { return start.Add(time.Duration(i) * time.Second) }
+	name := func(i int) string { return fmt.Sprint(at(i).UnixNano()) }
+
+	for i := 0; i < 3; i++ {
+		if err := w.write([]byte(fmt.Sprintf(`{"n": %d}`, i)), at(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := strings.Join(spooled(t, dir), " "), name(0)+".json "+name(2)+".json.open"; got != want {
+		t.Errorf("files %s, want %s", got, want)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, name(0)+".json"))
+	if err != nil || string(b) != "{\"n\":0}\n{\"n\":1}\n" {
+		t.Errorf("rotated file %q, %v", b, err)
+	}
+
+	for i := 3; i < 7; i++ {
+		if err := w.write([]byte(fmt.Sprintf(`{"n":%d}`, i)), at(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.rotate()
+	if got, want := strings.Join(spooled(t, dir), " "), name(4)+".json "+name(6)+".json"; got != want {
+		t.Errorf("files %s, want %s", got, want)
+	}
+}
+
+func TestSpoolLine(t *testing.T) {
+	dir := t.TempDir()
+	w := &spoolWriter{Spool: Spool{Dir: dir, Format: SpoolLine, Measurement: "goruntime_m", MaxFileBytes: 1 << 20, MaxTotalBytes: 1 << 20}}
+	now := time.Unix(1600000000, 0)
+	if err := w.write([]byte(`{"serial":"edge-a","goroutineNum":12}`), now); err != nil {
+		t.Fatal(err)
+	}
+	w.rotate()
+	b, err := ioutil.ReadFile(filepath.Join(dir, fmt.Sprint(now.UnixNano())+".lp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line := string(b); !strings.HasPrefix(line, "goruntime_m,runtime=go,serial=edge-a ") || !strings.Contains(line, "cpu.goroutines=12i") || !strings.HasSuffix(line, fmt.Sprintf(" %d\n", now.UnixNano())) {
+		t.Errorf("line %q", line)
+	}
+	if err := w.write([]byte("not json"), now); err == nil {
+		t.Error("spooled an invalid sample")
+	}
+}
+
+func TestStartSpool(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := StartSpool(Spool{Dir: dir, Format: "csv"}); err == nil {
+		t.Error("started with the csv format")
+	}
+
+	// a file left open by a crash is kept
+	if err := ioutil.WriteFile(filepath.Join(dir, "1.json.open"), []byte("{}\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	stop, err := StartSpool(Spool{Dir: dir, Interval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop()
+	if _, err := os.Stat(filepath.Join(dir, "1.json")); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,66 @@
+package agent
+
+import (
+	"expvar"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/jursonmo/gomonitor/model"
+)
+
+// threadsTop is how many threads are reported, none when 0
+var threadsTop int64
+
+func init() {
+	expvar.Publish("threads", expvar.Func(func() interface{} {
+		top := int(atomic.LoadInt64(&threadsTop))
+		if top == 0 {
+			return nil
+		}
+		return busiestThreads(top)
+	}))
+}
+
+// EnableThreadCPU reports the CPU time of the top busiest OS threads of
+// the process, none when top is 0. Go names no threads, the names tell
+// the threads of cgo libraries apart.
+func EnableThreadCPU(top int) {
+	atomic.StoreInt64(&threadsTop, int64(top))
+}
+
+// busiestThreads returns the top threads by CPU time since they started,
+// read from /proc/self/task
+func busiestThreads(top int) []model.Thread {
+	tasks, _ := filepath.Glob("/proc/self/task/*")
+	threads := make([]model.Thread, 0, len(tasks))
+	for _, task := range tasks {
+		tid, err := strconv.Atoi(filepath.Base(task))
+		if err != nil {
+			continue
+		}
+		// the time on the CPU, the time waiting for it and the slices
+		b, err := os.ReadFile(task + "/schedstat")
+		if err != nil {
+			continue
+		}
+		fs := strings.Fields(string(b))
+		if len(fs) == 0 {
+			continue
+		}
+		cpu, err := strconv.ParseInt(fs[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		name, _ := os.ReadFile(task + "/comm")
+		threads = append(threads, model.Thread{TID: tid, Name: strings.TrimSpace(string(name)), CPUNs: cpu})
+	}
+	sort.Slice(threads, func(i, j int) bool { return threads[i].CPUNs > threads[j].CPUNs })
+	if len(threads) > top {
+		threads = threads[:top]
+	}
+	return threads
+}
@@ -0,0 +1,7 @@
+//go:build !linux
+// +build !linux
+
+package agent
+
+// EnableThreadCPU does nothing, the threads are only reported on linux
+func EnableThreadCPU(top int) {}
@@ -0,0 +1,128 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"expvar"
+	rtpprof "runtime/pprof"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jursonmo/gomonitor/model"
+)
+
+// sleepingRefresh is how often the goroutines are dumped to count the
+// sleeping ones, the dump stops the world
+const sleepingRefresh = 10 * time.Second
+
+// tickers are the tickers and func timers made by this package not
+// stopped yet
+var tickers int64
+
+var sleeping struct {
+	sync.Mutex
+	n  int64
+	at time.Time
+}
+
+func init() {
+	expvar.Publish("timers", expvar.Func(func() interface{} {
+		t := model.Timers{
+			Sleeping: sleepingGoroutines(),
+			Tickers:  atomic.LoadInt64(&tickers),
+		}
+		t.ActiveEstimate = t.Sleeping + t.Tickers
+		return t
+	}))
+}
+
+// Ticker is a time.Ticker counted as active until stopped
+type Ticker struct {
+	*time.Ticker
+	stopped int32
+}
+
+// NewTicker is time.NewTicker counting the ticker until it is stopped, a
+// leaked ticker is never stopped
+func NewTicker(d time.Duration) *Ticker {
+	atomic.AddInt64(&tickers, 1)
+	return &Ticker{Ticker: time.NewTicker(d)}
+}
+
+// Stop stops the ticker
+func (t *Ticker) Stop() {
+	t.Ticker.Stop()
+	if atomic.CompareAndSwapInt32(&t.stopped, 0, 1) {
+		atomic.AddInt64(&tickers, -1)
+	}
+}
+
+// Timer is a time.Timer made by AfterFunc counted as active until it
+// fires or is stopped
+type Timer struct {
+	*time.Timer
+	done int32
+}
+
+// AfterFunc is time.AfterFunc counting the timer until f runs or it is
+// stopped
+func AfterFunc(d time.Duration, f func()) *Timer {
+	atomic.AddInt64(&tickers, 1)
+	t := &Timer{}
+	t.Timer = time.AfterFunc(d, func() {
+		t.finish()
+		f()
+	})
+	return t
+}
+
+// Stop stops the timer, see time.Timer.Stop
+func (t *Timer) Stop() bool {
+	stopped := t.Timer.Stop()
+	if stopped {
+		t.finish()
+	}
+	return stopped
+}
+
+// Reset restarts the timer, counting it again if it fired or was stopped
+func (t *Timer) Reset(d time.Duration) bool {
+	if atomic.CompareAndSwapInt32(&t.done, 1, 0) {
+		atomic.AddInt64(&tickers, 1)
+	}
+	return t.Timer.Reset(d)
+}
+
+func (t *Timer) finish() {
+	if atomic.CompareAndSwapInt32(&t.done, 0, 1) {
+		atomic.AddInt64(&tickers, -1)
+	}
+}
+
+// sleepingGoroutines returns the goroutines in time.Sleep, dumped at most
+// every sleepingRefresh
+func sleepingGoroutines() int64 {
+	sleeping.Lock()
+	defer sleeping.Unlock()
+	if time.Since(sleeping.at) < sleepingRefresh {
+		return sleeping.n
+	}
+	var dump bytes.Buffer
+	if err := rtpprof.Lookup("goroutine").WriteTo(&dump, 2); err != nil {
+		return sleeping.n
+	}
+	sleeping.n = 0
+	sc := bufio.NewScanner(&dump)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		// goroutine 7 [sleep, 2 minutes]:
+		line := sc.Text()
+		if strings.HasPrefix(line, "goroutine ") && strings.Contains(line, " [sleep") {
+			sleeping.n++
+		}
+	}
+	sleeping.at = time.Now()
+	return sleeping.n
+}
@@ -0,0 +1,356 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// parseTOML parses the subset of TOML of the config files: tables,
+// arrays of tables and key/value pairs of strings, integers, floats,
+// booleans and arrays of them, which may span lines. Inline tables and
+// dates are not supported.
+func parseTOML(b []byte) (map[string]interface{}, error) {
+	root := make(map[string]interface{})
+	table := root
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		if line[0] == '[' {
+			array := strings.HasPrefix(line, "[[")
+			header, closing := line[1:], "]"
+			if array {
+				header, closing = line[2:], "]]"
+			}
+			end := strings.Index(header, closing)
+			if end < 0 || !isComment(header[end+len(closing):]) {
+				return nil, fmt.Errorf("line %d: invalid table header", lineNo)
+			}
+			keys, err := splitKey(header[:end])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s", lineNo, err)
+			}
+			if array {
+				table, err = appendTable(root, keys)
+			} else {
+				table, err = subTable(root, keys)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s", lineNo, err)
+			}
+			continue
+		}
+
+		eq := keyEnd(line)
+		if eq < 0 {
+			return nil, fmt.Errorf("line %d: expected key = value", lineNo)
+		}
+		keys, err := splitKey(line[:eq])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", lineNo, err)
+		}
+		rest := strings.TrimSpace(line[eq+1:])
+		// an array spans the lines up to its closing bracket
+		for strings.HasPrefix(rest, "[") && !arrayClosed(rest) && scanner.Scan() {
+			lineNo++
+			rest += "\n" + scanner.Text()
+		}
+		v, tail, err := parseValue(rest)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", lineNo, err)
+		}
+		if !isComment(tail) {
+			return nil, fmt.Errorf("line %d: unexpected %q after the value", lineNo, tail)
+		}
+		t, err := subTable(table, keys[:len(keys)-1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", lineNo, err)
+		}
+		k := keys[len(keys)-1]
+		if _, ok := t[k]; ok {
+			return nil, fmt.Errorf("line %d: duplicate key %q", lineNo, k)
+		}
+		t[k] = v
+	}
+	return root, scanner.Err()
+}
+
+func isComment(s string) bool {
+	s = strings.TrimSpace(s)
+	return s == "" || s[0] == '#'
+}
+
+// keyEnd returns the index of the = after the key, which may be quoted
+func keyEnd(line string) int {
+	quote := byte(0)
+	for i := 0; i < len(line); i++ {
+		switch ch := line[i]; {
+		case quote != 0:
+			if ch == '\\' && quote == '"' {
+				i++
+			} else if ch == quote {
+				quote = 0
+			}
+		case ch == '"' || ch == '\'':
+			quote = ch
+		case ch == '=':
+			return i
+		}
+	}
+	return -1
+}
+
+// splitKey splits a dotted key, of bare or quoted parts
+func splitKey(s string) ([]string, error) {
+	var keys []string
+	s = strings.TrimSpace(s)
+	for {
+		var k string
+		if s != "" && (s[0] == '"' || s[0] == '\'') {
+			v, rest, err := parseString(s)
+			if err != nil {
+				return nil, err
+			}
+			k, s = v, strings.TrimSpace(rest)
+		} else {
+			i := strings.IndexByte(s, '.')
+			if i < 0 {
+				i = len(s)
+			}
+			k, s = strings.TrimSpace(s[:i]), s[i:]
+			if k == "" || strings.IndexFunc(k, func(r rune) bool {
+				return !(r == '_' || r == '-' || '0' <= r && r <= '9' || 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z')
+			}) >= 0 {
+				return nil, fmt.Errorf("invalid key %q", k)
+			}
+		}
+		keys = append(keys, k)
+		if s == "" {
+			return keys, nil
+		}
+		if s[0] != '.' {
+			return nil, fmt.Errorf("invalid key near %q", s)
+		}
+		s = strings.TrimSpace(s[1:])
+	}
+}
+
+// subTable returns the table of the keys, made when missing. A key of an
+// array of tables is its last table.
+func subTable(t map[string]interface{}, keys []string) (map[string]interface{}, error) {
+	for _, k := range keys {
+		v, ok := t[k]
+		if !ok {
+			sub := make(map[string]interface{})
+			t[k] = sub
+			t = sub
+			continue
+		}
+		if tables, ok := v.([]interface{}); ok && len(tables) > 0 {
+			v = tables[len(tables)-1]
+		}
+		sub, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("key %q is not a table", k)
+		}
+		t = sub
+	}
+	return t, nil
+}
+
+// appendTable appends a table to the array of tables of the keys
+func appendTable(root map[string]interface{}, keys []string) (map[string]interface{}, error) {
+	t, err := subTable(root, keys[:len(keys)-1])
+	if err != nil {
+		return nil, err
+	}
+	k := keys[len(keys)-1]
+	var tables []interface{}
+	if v, ok := t[k]; ok {
+		tables, ok = v.([]interface{})
+		if ok && len(tables) > 0 {
+			_, ok = tables[0].(map[string]interface{})
+		}
+		if !ok {
+			return nil, fmt.Errorf("key %q is not an array of tables", k)
+		}
+	}
+	sub := make(map[string]interface{})
+	t[k] = append(tables, sub)
+	return sub, nil
+}
+
+// arrayClosed tells if the brackets of the array are balanced, outside
+// of its strings and comments
+func arrayClosed(s string) bool {
+	depth := 0
+	quote := byte(0)
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case quote != 0:
+			if ch == '\\' && quote == '"' {
+				i++
+			} else if ch == quote {
+				quote = 0
+			}
+		case ch == '"' || ch == '\'':
+			quote = ch
+		case ch == '#':
+			for i < len(s) && s[i] != '\n' {
+				i++
+			}
+		case ch == '[':
+			depth++
+		case ch == ']':
+			if depth--; depth == 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseValue parses the value at the start of s and returns the rest
+func parseValue(s string) (interface{}, string, error) {
+	if s == "" {
+		return nil, "", fmt.Errorf("missing value")
+	}
+	switch s[0] {
+	case '"', '\'':
+		return parseString(s)
+	case '[':
+		return parseArray(s)
+	case '{':
+		return nil, "", fmt.Errorf("inline tables are not supported")
+	}
+	end := strings.IndexAny(s, ",]# \t\n")
+	if end < 0 {
+		end = len(s)
+	}
+	tok, rest := s[:end], s[end:]
+	switch tok {
+	case "true":
+		return true, rest, nil
+	case "false":
+		return false, rest, nil
+	}
+	num := strings.Replace(tok, "_", "", -1)
+	if n, err := strconv.ParseInt(num, 0, 64); err == nil {
+		return n, rest, nil
+	}
+	if f, err := strconv.ParseFloat(num, 64); err == nil {
+		return f, rest, nil
+	}
+	return nil, "", fmt.Errorf("invalid value %q", tok)
+}
+
+func parseString(s string) (string, string, error) {
+	quote := s[0]
+	if strings.HasPrefix(s, strings.Repeat(string(quote), 3)) {
+		return "", "", fmt.Errorf("multi-line strings are not supported")
+	}
+	if quote == '\'' {
+		end := strings.IndexByte(s[1:], '\'')
+		if end < 0 {
+			return "", "", fmt.Errorf("unterminated string")
+		}
+		return s[1 : end+1], s[end+2:], nil
+	}
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		ch := s[i]
+		switch ch {
+		case '"':
+			return b.String(), s[i+1:], nil
+		case '\n':
+			return "", "", fmt.Errorf("unterminated string")
+		case '\\':
+			if i+1 >= len(s) {
+				return "", "", fmt.Errorf("unterminated string")
+			}
+			i++
+			switch s[i] {
+			case 'b':
+				b.WriteByte('\b')
+			case 't':
+				b.WriteByte('\t')
+			case 'n':
+				b.WriteByte('\n')
+			case 'f':
+				b.WriteByte('\f')
+			case 'r':
+				b.WriteByte('\r')
+			case '"', '\\':
+				b.WriteByte(s[i])
+			case 'u', 'U':
+				n := 4
+				if s[i] == 'U' {
+					n = 8
+				}
+				if i+n >= len(s) {
+					return "", "", fmt.Errorf("invalid escape")
+				}
+				r, err := strconv.ParseUint(s[i+1:i+1+n], 16, 32)
+				if err != nil || !utf8.ValidRune(rune(r)) {
+					return "", "", fmt.Errorf("invalid escape %q", s[i-1:i+1+n])
+				}
+				b.WriteRune(rune(r))
+				i += n
+			default:
+				return "", "", fmt.Errorf("invalid escape \\%c", s[i])
+			}
+		default:
+			b.WriteByte(ch)
+		}
+	}
+	return "", "", fmt.Errorf("unterminated string")
+}
+
+func parseArray(s string) ([]interface{}, string, error) {
+	values := []interface{}{}
+	s = s[1:]
+	for {
+		s = skipBlank(s)
+		if s == "" {
+			return nil, "", fmt.Errorf("unterminated array")
+		}
+		if s[0] == ']' {
+			return values, s[1:], nil
+		}
+		v, rest, err := parseValue(s)
+		if err != nil {
+			return nil, "", err
+		}
+		values = append(values, v)
+		s = skipBlank(rest)
+		if s != "" && s[0] == ',' {
+			s = s[1:]
+		} else if s == "" || s[0] != ']' {
+			return nil, "", fmt.Errorf("expected , or ] in array")
+		}
+	}
+}
+
+// skipBlank skips the spaces, newlines and comments
+func skipBlank(s string) string {
+	for {
+		s = strings.TrimLeft(s, " \t\r\n")
+		if s == "" || s[0] != '#' {
+			return s
+		}
+		if i := strings.IndexByte(s, '\n'); i >= 0 {
+			s = s[i:]
+		} else {
+			s = ""
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+)
+
+// wal buffers the payloads which could not be pushed in a file, one
+// compacted payload per line. The oldest payloads are dropped to stay
+// under max bytes.
+type wal struct {
+	path string
+	max  int64
+}
+
+func (w *wal) append(body []byte) error {
+	var line bytes.Buffer
+	if err := json.Compact(&line, body); err != nil {
+		return err
+	}
+	line.WriteByte('\n')
+
+	if fi, err := os.Stat(w.path); err == nil && fi.Size()+int64(line.Len()) > w.max {
+		if err = w.trim(w.max - int64(line.Len())); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(line.Bytes())
+	return err
+}
+
+// trim drops the oldest lines until the file fits in size bytes
+func (w *wal) trim(size int64) error {
+	lines, err := w.lines()
+	if err != nil {
+		return err
+	}
+	var total int64
+	for _, l := range lines {
+		total += int64(len(l)) + 1
+	}
+	for len(lines) > 0 && total > size {
+		total -= int64(len(lines[0])) + 1
+		lines = lines[1:]
+	}
+	return w.write(lines)
+}
+
+// replay posts the buffered payloads oldest first, the ones not posted
+// stay buffered
+func (w *wal) replay(post func([]byte) error) error {
+	lines, err := w.lines()
+	if err != nil || len(lines) == 0 {
+		return err
+	}
+	for i, l := range lines {
+		if err = post(l); err != nil {
+			w.write(lines[i:])
+			return err
+		}
+	}
+	return os.Remove(w.path)
+}
+
+func (w *wal) lines() ([][]byte, error) {
+	f, err := os.Open(w.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines [][]byte
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 16<<20)
+	for scanner.Scan() {
+		lines = append(lines, append([]byte(nil), scanner.Bytes()...))
+	}
+	return lines, scanner.Err()
+}
+
+func (w *wal) write(lines [][]byte) error {
+	var buf bytes.Buffer
+	for _, l := range lines {
+		buf.Write(l)
+		buf.WriteByte('\n')
+	}
+	tmp := w.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, buf.Bytes(), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, w.path)
+}
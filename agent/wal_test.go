@@ -0,0 +1,79 @@
+package agent
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func walLines(t *testing.T, w *wal) string {
+	t.Helper()
+	lines, err := w.lines()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s []string
+	for _, l := range lines {
+		s = append(s, string(l))
+	}
+	return strings.Join(s, " ")
+}
+
+func TestWALAppend(t *testing.T) {
+	// each payload takes 8 bytes with its newline, 3 fit
+	w := &wal{path: filepath.Join(t.TempDir(), "push.wal"), max: 24}
+	for _, body := range []string{"{\"n\": 1}", `{"n":2}`, `{"n":3}`, `{"n":4}`, `{"n":5}`} {
+		if err := w.append([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := walLines(t, w), `{"n":3} {"n":4} {"n":5}`; got != want {
+		t.Errorf("buffered %s, want %s", got, want)
+	}
+	if err := w.append([]byte("not json")); err == nil {
+		t.Error("appended an invalid payload")
+	}
+}
+
+func TestWALReplay(t *testing.T) {
+	w := &wal{path: filepath.Join(t.TempDir(), "push.wal"), max: 1 << 10}
+	if err := w.replay(func([]byte) error { return errors.New("posted without payloads") }); err != nil {
+		t.Fatal(err)
+	}
+	for _, body := range []string{`{"n":1}`, `{"n":2}`, `{"n":3}`} {
+		if err := w.append([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var posted []string
+	err := w.replay(func(b []byte) error {
+		if len(posted) == 1 {
+			return errors.New("unavailable")
+		}
+		posted = append(posted, string(b))
+		return nil
+	})
+	if err == nil || strings.Join(posted, " ") != `{"n":1}` {
+		t.Fatalf("posted %v, %v", posted, err)
+	}
+	if got, want := walLines(t, w), `{"n":2} {"n":3}`; got != want {
+		t.Errorf("after a failed replay %s, want %s", got, want)
+	}
+
+	posted = nil
+	if err := w.replay(func(b []byte) error {
+		posted = append(posted, string(b))
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(posted, " "), `{"n":2} {"n":3}`; got != want {
+		t.Errorf("posted %s, want %s", got, want)
+	}
+	if _, err := os.Stat(w.path); !os.IsNotExist(err) {
+		t.Errorf("the wal is kept after a replay: %v", err)
+	}
+}
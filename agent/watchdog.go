@@ -0,0 +1,144 @@
+package agent
+
+import (
+	"expvar"
+	"fmt"
+	"os"
+	"path/filepath"
+	rtpprof "runtime/pprof"
+	"sync"
+	"time"
+)
+
+// Watchdog detects stuck loops: a timer ticking every Interval measures
+// the scheduling lag, and registered heartbeats are checked for beats
+// missing longer than their period. When the lag exceeds DumpThreshold
+// all goroutines are dumped into DumpDir, at most once per minute.
+type Watchdog struct {
+	Interval      time.Duration
+	DumpThreshold time.Duration
+	DumpDir       string
+}
+
+var DefaultWatchdog = Watchdog{
+	Interval: time.Second,
+}
+
+type heartbeat struct {
+	every time.Duration
+	last  time.Time
+}
+
+var (
+	wdMu       sync.Mutex
+	heartbeats = make(map[string]*heartbeat)
+	maxLag     windowMax
+	wdDumps    = expvar.NewInt("watchdogDumps")
+)
+
+func init() {
+	expvar.Publish("watchdogMaxLagMs", expvar.Func(func() interface{} {
+		return maxLag.max() / int64(time.Millisecond)
+	}))
+}
+
+// RegisterHeartbeat registers a loop expected to call the returned beat
+// func at least every period
+func RegisterHeartbeat(name string, every time.Duration) (beat func()) {
+	hb := &heartbeat{every: every, last: time.Now()}
+	wdMu.Lock()
+	heartbeats[name] = hb
+	wdMu.Unlock()
+
+	return func() {
+		wdMu.Lock()
+		hb.last = time.Now()
+		wdMu.Unlock()
+	}
+}
+
+// StartWatchdog starts the watchdog, the returned func stops it. A zero
+// Interval is the one of DefaultWatchdog.
+func StartWatchdog(wd Watchdog) (stop func()) {
+	if wd.Interval <= 0 {
+		wd.Interval = DefaultWatchdog.Interval
+	}
+	done := make(chan struct{})
+	go func() {
+		var lastDump time.Time
+		expected := time.Now().Add(wd.Interval)
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(wd.Interval):
+			}
+			now := time.Now()
+			lag := now.Sub(expected)
+			expected = now.Add(wd.Interval)
+
+			wdMu.Lock()
+			for _, hb := range heartbeats {
+				if l := now.Sub(hb.last) - hb.every; l > lag {
+					lag = l
+				}
+			}
+			wdMu.Unlock()
+			maxLag.observe(int64(lag))
+
+			if wd.DumpThreshold > 0 && lag > wd.DumpThreshold && now.Sub(lastDump) > time.Minute {
+				lastDump = now
+				var err error
+				if budgeted("goroutine_dumps", func() { err = dumpGoroutines(wd.DumpDir, now) }) == nil && err == nil {
+					wdDumps.Add(1)
+				}
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+func dumpGoroutines(dir string, now time.Time) error {
+	f, err := os.Create(filepath.Join(dir, fmt.Sprintf("goroutines-%d.txt", now.Unix())))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return rtpprof.Lookup("goroutine").WriteTo(f, 2)
+}
+
+// windowMax keeps the max of the values observed in the last minute, in
+// per second buckets
+type windowMax struct {
+	mu      sync.Mutex
+	values  [rateWindow]int64
+	seconds [rateWindow]int64
+}
+
+func (w *windowMax) observe(v int64) {
+	now := time.Now().Unix()
+	i := now % rateWindow
+
+	w.mu.Lock()
+	if w.seconds[i] != now {
+		w.seconds[i] = now
+		w.values[i] = v
+	} else if v > w.values[i] {
+		w.values[i] = v
+	}
+	w.mu.Unlock()
+}
+
+func (w *windowMax) max() int64 {
+	now := time.Now().Unix()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var m int64
+	for i, s := range w.seconds {
+		if now-s < rateWindow && w.values[i] > m {
+			m = w.values[i]
+		}
+	}
+	return m
+}
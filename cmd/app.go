@@ -1,44 +1,115 @@
 package main
 
 import (
-	"expvar"
+	"encoding/hex"
+	"flag"
+	"log"
 	"net/http"
 	"os"
-	"runtime"
-	rtpprof "runtime/pprof"
+	"strings"
 	"time"
 
-	"github.com/shirou/gopsutil/process"
+	"github.com/jursonmo/gomonitor/agent"
+	"github.com/jursonmo/gomonitor/model"
 )
 
-func main() {
-	mux := http.NewServeMux()
-	mux.HandleFunc("/debug/vars", exp)
-	http.ListenAndServe(":8080", mux)
-}
-
-var h = expvar.Handler()
-var cpuNum = expvar.NewInt("cpuNum")
-var threadNum = expvar.NewInt("threadNum")
-var grNum = expvar.NewInt("goroutineNum")
-var serial = expvar.NewString("serial")
-var threadProfile = rtpprof.Lookup("threadcreate")
+var aggregate = flag.String("aggregate", "", "comma separated endpoints of sibling apps served at /debug/aggregate")
+var threadCPU = flag.Int("thread-cpu", 0, "report the CPU time of this many busiest OS threads, linux only")
+var collectHost = flag.Bool("collect_host", false, "report the load average, memory and CPU steal of the host, when no host agent runs")
+var gcEvents = flag.Bool("gc-events", false, "record an event per gc cycle")
+var allocSites = flag.Int("alloc-sites", 0, "report the allocation rate of this many functions allocating the most")
+var spool = flag.String("spool", "", "write the runtime data to files in this directory, for devices without a collector in reach")
+var channel = flag.String("channel", "", "keep a websocket channel to the collector at this ws:// or wss:// url, for devices it can't scrape")
+var config = flag.String("config", "", "set up the agent from this TOML file, or JSON when it ends in .json, reloaded when it changes or on SIGHUP")
+var ebpf = flag.Bool("ebpf", false, "count syscalls, off-CPU time and TCP retransmits with eBPF, built with -tags gomonitor_ebpf")
 
-var p, _ = process.NewProcess(int32(os.Getpid()))
-var memPercent = expvar.NewInt("memPercent")
-var cpuPercent = expvar.NewInt("cpuPercent")
-
-func exp(w http.ResponseWriter, req *http.Request) {
-	serial.Set("xxxxxxxx")
-
-	cpuNum.Set(int64(runtime.NumCPU()))
-	threadNum.Set(int64(threadProfile.Count()))
-	grNum.Set(int64(runtime.NumGoroutine()))
+func main() {
+	flag.Parse()
+	agent.SetSerialFrom(agent.MachineID, agent.Hostname)
+	agent.LabelsFromEnv("GOMONITOR_LABEL_")
+	agent.EnableThreadCPU(*threadCPU)
+	agent.CollectHost(*collectHost)
+	if *allocSites > 0 {
+		agent.StartAllocSampler(agent.AllocSampler{Top: *allocSites})
+	}
+	if *gcEvents {
+		agent.StartGCEvents()
+	}
+	if *config != "" {
+		if _, err := agent.StartConfig(*config); err != nil {
+			log.Println(err)
+		}
+	}
+	if *spool != "" {
+		if _, err := agent.StartSpool(agent.Spool{Dir: *spool}); err != nil {
+			log.Println(err)
+		}
+	}
+	if key := os.Getenv("GOMONITOR_PAYLOAD_KEY"); key != "" {
+		b, err := hex.DecodeString(key)
+		if err == nil {
+			err = agent.SetPayloadKey(os.Getenv("GOMONITOR_PAYLOAD_KEY_ID"), b)
+		}
+		if err != nil {
+			log.Println("payload key:", err)
+		}
+	}
+	if key := os.Getenv("GOMONITOR_SIGNING_KEY"); key != "" {
+		b, err := hex.DecodeString(key)
+		if err == nil {
+			alg := os.Getenv("GOMONITOR_SIGNING_ALG")
+			if alg == "" {
+				alg = model.SignHMACSHA256
+			}
+			err = agent.SetSigningKey(os.Getenv("GOMONITOR_SIGNING_KEY_ID"), alg, b)
+		}
+		if err != nil {
+			log.Println("signing key:", err)
+		}
+	}
+	if *channel != "" {
+		ch := agent.Channel{URL: *channel, Allow: []string{"gc-now", "free-os-memory"}}
+		if token := os.Getenv("GOMONITOR_CHANNEL_TOKEN"); token != "" {
+			ch.Header = http.Header{"Authorization": {"Bearer " + token}}
+		}
+		agent.StartChannel(ch)
+	}
+	if *ebpf {
+		if _, err := agent.StartEBPF(); err != nil {
+			log.Println(err)
+		}
+	}
 
-	mp, _ := p.MemoryPercent()
-	memPercent.Set(int64(mp))
-	cp, _ := p.Percent(time.Second)
-	cpuPercent.Set(int64(cp))
+	// the runtime data is served to the reader token, the control token
+	// grants everything, without either it is served to everyone
+	var auths []agent.Authenticator
+	read := os.Getenv("GOMONITOR_READ_TOKEN")
+	if read != "" {
+		auths = append(auths, agent.TokenAuth{Name: "reader", Token: read, Role: agent.RoleReader})
+	}
+	control := os.Getenv("GOMONITOR_CONTROL_TOKEN")
+	if control != "" {
+		auths = append(auths, agent.TokenAuth{Name: "control", Token: control, Role: agent.RoleAdmin})
+	}
 
-	h.ServeHTTP(w, req)
+	mux := http.NewServeMux()
+	mux.Handle("/debug/vars", agent.RequireRoleOf(agent.RoleReader, auths, agent.Handler()))
+	mux.Handle("/metrics", agent.RequireRoleOf(agent.RoleReader, auths, agent.PrometheusHandler()))
+	mux.Handle("/healthz", agent.HealthHandler(agent.DefaultHealthRules))
+	if control != "" {
+		mux.Handle("/control/", agent.ControlHandler(agent.Control{
+			Auth:  agent.FirstOf(auths...),
+			Allow: []string{"gc-now", "free-os-memory"},
+		}))
+	}
+	if *aggregate != "" {
+		// the siblings are run with the same tokens
+		token := read
+		if token == "" {
+			token = control
+		}
+		mux.Handle("/debug/aggregate", agent.RequireRoleOf(agent.RoleReader, auths,
+			agent.AggregateTokenHandler(strings.Split(*aggregate, ","), 5*time.Second, token)))
+	}
+	http.ListenAndServe(":8080", mux)
 }
@@ -0,0 +1,67 @@
+// Package fixture serves payloads of the shapes the collectors meet, to
+// check parsers against them: the runtime data of the agent, single and
+// aggregated, the plain expvar of an app without the agent, Prometheus
+// text, the runtime data of another runtime and malformed payloads.
+package fixture
+
+import (
+	"embed"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sort"
+	"strings"
+)
+
+//go:embed payloads
+var payloads embed.FS
+
+// Names returns the names of the payloads
+func Names() []string {
+	entries, _ := payloads.ReadDir("payloads")
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Payload returns the payload, nil when there is none by that name
+func Payload(name string) []byte {
+	b, err := payloads.ReadFile(path.Join("payloads", name))
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
+// ContentType returns the content type the payload is served with
+func ContentType(name string) string {
+	switch path.Ext(name) {
+	case ".json":
+		return "application/json; charset=utf-8"
+	case ".html":
+		return "text/html; charset=utf-8"
+	}
+	return "text/plain; version=0.0.4; charset=utf-8"
+}
+
+// Handler serves every payload at /<name>
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/")
+		b := Payload(name)
+		if b == nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", ContentType(name))
+		w.Write(b)
+	})
+}
+
+// NewServer starts a server of the payloads, the caller closes it
+func NewServer() *httptest.Server {
+	return httptest.NewServer(Handler())
+}
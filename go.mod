@@ -3,8 +3,10 @@ module github.com/jursonmo/gomonitor
 go 1.16
 
 require (
-	github.com/shirou/gopsutil v3.21.11+incompatible // indirect
+	github.com/shirou/gopsutil v3.21.11+incompatible
+	github.com/sirupsen/logrus v1.8.1
 	github.com/tklauser/go-sysconf v0.3.9 // indirect
 	github.com/yusufpapurcu/wmi v1.2.2 // indirect
-	golang.org/x/sys v0.0.0-20211205182925-97ca703d548d // indirect
+	go.uber.org/zap v1.21.0
+	golang.org/x/sys v0.0.0-20211205182925-97ca703d548d
 )
@@ -0,0 +1,39 @@
+package model
+
+import "encoding/json"
+
+// the types of the messages of the channel
+const (
+	ChannelHello   = "hello"
+	ChannelData    = "data"
+	ChannelCommand = "command"
+	ChannelResult  = "result"
+	ChannelConfig  = "config"
+	// ChannelRollback reverts the config to the one before
+	ChannelRollback = "rollback"
+)
+
+// ChannelMessage is a message of the channel an agent keeps to a
+// collector. The agent says hello with its serial, then sends the runtime
+// data as data, sealed and signed like a push. The collector sends
+// commands, run by the agent as the actions of its control API, each
+// answered by a result of the same id. It also sends configs, in the
+// format of the config file of the agent, also answered by a result; the
+// hello of the agent carries the version of its config.
+type ChannelMessage struct {
+	Type   string `json:"type"`
+	Serial string `json:"serial,omitempty"`
+
+	Payload     []byte `json:"payload,omitempty"`
+	ContentType string `json:"contentType,omitempty"`
+	Signature   string `json:"signature,omitempty"`
+
+	ID     string            `json:"id,omitempty"`
+	Action string            `json:"action,omitempty"`
+	Args   map[string]string `json:"args,omitempty"`
+	OK     bool              `json:"ok,omitempty"`
+	Result string            `json:"result,omitempty"`
+
+	Version int64           `json:"version,omitempty"`
+	Config  json.RawMessage `json:"config,omitempty"`
+}
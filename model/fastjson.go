@@ -0,0 +1,6 @@
+//go:build !goruntime_stdjson
+// +build !goruntime_stdjson
+
+package model
+
+const stdJSON = false
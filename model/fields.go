@@ -0,0 +1,289 @@
+package model
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+// Fields are the metrics of an app, a point of the goruntime
+// measurement. ToMap returns them under the name of their json tag, with
+// omitempty only when not empty. Every field must be tagged, "-" leaving
+// it out, and the tag fields are marked with goruntime:"tag". The fields
+// marked goruntime:"go" only exist in Go or its agent and are left out for
+// the other runtimes.
+type Fields struct {
+	//
+	Serial  string `json:"serial" goruntime:"tag"`
+	Runtime string `json:"runtime" goruntime:"tag"`
+
+	// CPU
+	NumCpu       int64 `json:"cpu.count"`
+	NumThread    int64 `json:"cpu.thread"`
+	NumGoroutine int64 `json:"cpu.goroutines" goruntime:"go"`
+	NumCgoCall   int64 `json:"cpu.cgo_calls" goruntime:"go"`
+
+	CpuPercent int64 `json:"cpu.percent"`
+	MemPercent int64 `json:"mem.percent"`
+
+	// Errors
+	Panics    int64  `json:"errors.panics"`
+	LastPanic string `json:"errors.last_panic,omitempty"`
+
+	// Watchdog
+	WatchdogMaxLagMs int64 `json:"watchdog.max_lag_ms" goruntime:"go"`
+	WatchdogDumps    int64 `json:"watchdog.dumps" goruntime:"go"`
+
+	// Path of the last diagnostics bundle
+	LastDiagnostics string `json:"diag.last_bundle,omitempty"`
+
+	// Features of the cohort rollout the app is enrolled in, comma separated
+	Cohorts string `json:"cohorts,omitempty"`
+
+	// Log
+	LogErrors    int64   `json:"log.errors"`
+	LogWarns     int64   `json:"log.warns"`
+	LogErrorRate float64 `json:"log.error_rate"`
+	LogWarnRate  float64 `json:"log.warn_rate"`
+
+	// eBPF, only when the agent runs the programs
+	EBPFSyscalls       int64  `json:"ebpf.syscalls,omitempty"`
+	EBPFOffCPUNs       int64  `json:"ebpf.off_cpu_ns,omitempty"`
+	EBPFTCPRetransmits int64  `json:"ebpf.tcp_retransmits,omitempty"`
+	EBPFError          string `json:"ebpf.error,omitempty"`
+
+	// Sockets, zero but on linux
+	SockTCPEstablished int64 `json:"net.sock.tcp.established" goruntime:"go"`
+	SockTCPSynSent     int64 `json:"net.sock.tcp.syn_sent" goruntime:"go"`
+	SockTCPSynRecv     int64 `json:"net.sock.tcp.syn_recv" goruntime:"go"`
+	SockTCPFinWait     int64 `json:"net.sock.tcp.fin_wait" goruntime:"go"`
+	SockTCPCloseWait   int64 `json:"net.sock.tcp.close_wait" goruntime:"go"`
+	SockTCPListen      int64 `json:"net.sock.tcp.listen" goruntime:"go"`
+	SockTCPOther       int64 `json:"net.sock.tcp.other" goruntime:"go"`
+	SockUDP            int64 `json:"net.sock.udp" goruntime:"go"`
+	SockListenQueue    int64 `json:"net.sock.listen_queue" goruntime:"go"`
+	SockListenDrops    int64 `json:"net.sock.listen_drops" goruntime:"go"`
+
+	// I/O, only on linux
+	ProcIOReadBytes     int64 `json:"proc.io.read_bytes,omitempty"`
+	ProcIOWriteBytes    int64 `json:"proc.io.write_bytes,omitempty"`
+	ProcIOReadSyscalls  int64 `json:"proc.io.read_syscalls,omitempty"`
+	ProcIOWriteSyscalls int64 `json:"proc.io.write_syscalls,omitempty"`
+
+	// Overhead of the agent, only when it reports it
+	OverheadCycles     int64   `json:"overhead.cycles,omitempty"`
+	OverheadCollectNs  int64   `json:"overhead.collect_ns,omitempty"`
+	OverheadAllocBytes int64   `json:"overhead.alloc_bytes,omitempty"`
+	OverheadCPUNs      int64   `json:"overhead.cpu_ns,omitempty"`
+	OverheadCPUPercent float64 `json:"overhead.cpu_percent,omitempty"`
+	OverheadBytesSent  int64   `json:"overhead.bytes_sent,omitempty"`
+
+	// Placement, only on linux
+	PlacementCPUs       string `json:"placement.cpus,omitempty"`
+	PlacementCPUCount   int64  `json:"placement.cpu_count,omitempty"`
+	PlacementMemNodes   string `json:"placement.mem_nodes,omitempty"`
+	PlacementCgroupCPUs string `json:"placement.cgroup_cpus,omitempty"`
+
+	// Paging, only on linux
+	MinorFaults   int64 `json:"mem.faults.minor,omitempty"`
+	MajorFaults   int64 `json:"mem.faults.major,omitempty"`
+	SwapBytes     int64 `json:"mem.swap,omitempty"`
+	HostSwapTotal int64 `json:"host.swap.total,omitempty"`
+	HostSwapUsed  int64 `json:"host.swap.used,omitempty"`
+	HostSwapIns   int64 `json:"host.swap.in_pages,omitempty"`
+	HostSwapOuts  int64 `json:"host.swap.out_pages,omitempty"`
+
+	// Host, only when the agent collects it
+	HostLoad1        float64 `json:"host.load1,omitempty"`
+	HostLoad5        float64 `json:"host.load5,omitempty"`
+	HostLoad15       float64 `json:"host.load15,omitempty"`
+	HostMemTotal     int64   `json:"host.mem.total,omitempty"`
+	HostMemAvailable int64   `json:"host.mem.available,omitempty"`
+	HostCPUSteal     float64 `json:"host.cpu.steal,omitempty"`
+
+	// Off heap, finalizers set with the agent and memory of cgo
+	FinalizersPending int64 `json:"mem.finalizers.pending,omitempty" goruntime:"go"`
+	FinalizersRun     int64 `json:"mem.finalizers.run,omitempty" goruntime:"go"`
+	CgoEstimated      int64 `json:"mem.cgo.estimated,omitempty" goruntime:"go"`
+
+	// Timers, a growing estimate is a leak
+	TimersActive   int64 `json:"timers.active_estimate" goruntime:"go"`
+	TimersSleeping int64 `json:"timers.sleeping" goruntime:"go"`
+	Tickers        int64 `json:"timers.tickers" goruntime:"go"`
+
+	// Resident memory accounted by the OS, only on linux
+	OSRSS     int64 `json:"mem.os.rss,omitempty"`
+	OSPSS     int64 `json:"mem.os.pss,omitempty"`
+	OSAnon    int64 `json:"mem.os.anon,omitempty"`
+	OSFile    int64 `json:"mem.os.file,omitempty"`
+	OSShared  int64 `json:"mem.os.shared,omitempty"`
+	OSPrivate int64 `json:"mem.os.private,omitempty"`
+
+	// General
+	Alloc      int64 `json:"mem.alloc"`
+	TotalAlloc int64 `json:"mem.total" goruntime:"go"`
+	Sys        int64 `json:"mem.sys" goruntime:"go"`
+	Lookups    int64 `json:"mem.lookups" goruntime:"go"`
+	Mallocs    int64 `json:"mem.malloc" goruntime:"go"`
+	Frees      int64 `json:"mem.frees" goruntime:"go"`
+
+	// Heap
+	HeapAlloc    int64 `json:"mem.heap.alloc"`
+	HeapSys      int64 `json:"mem.heap.sys"`
+	HeapIdle     int64 `json:"mem.heap.idle"`
+	HeapInuse    int64 `json:"mem.heap.inuse"`
+	HeapReleased int64 `json:"mem.heap.released" goruntime:"go"`
+	HeapObjects  int64 `json:"mem.heap.objects"`
+
+	// Stack
+	StackInuse  int64 `json:"mem.stack.inuse" goruntime:"go"`
+	StackSys    int64 `json:"mem.stack.sys" goruntime:"go"`
+	MSpanInuse  int64 `json:"mem.stack.mspan_inuse" goruntime:"go"`
+	MSpanSys    int64 `json:"mem.stack.mspan_sys" goruntime:"go"`
+	MCacheInuse int64 `json:"mem.stack.mcache_inuse" goruntime:"go"`
+	MCacheSys   int64 `json:"mem.stack.mcache_sys" goruntime:"go"`
+
+	OtherSys int64 `json:"mem.othersys" goruntime:"go"`
+
+	// FreeOSMemory forced by the agent
+	ForcedReleaseCount int64 `json:"mem.forced_release_count" goruntime:"go"`
+	LastForcedRelease  int64 `json:"mem.forced_release_last" goruntime:"go"`
+
+	// GC
+	GCSys         int64   `json:"mem.gc.sys" goruntime:"go"`
+	NextGC        int64   `json:"mem.gc.next" goruntime:"go"`
+	LastGC        int64   `json:"mem.gc.last" goruntime:"go"`
+	PauseTotalNs  int64   `json:"mem.gc.pause_total"`
+	PauseNs       int64   `json:"mem.gc.pause"`
+	NumGC         int64   `json:"mem.gc.count"`
+	GCCPUFraction float64 `json:"mem.gc.cpu_fraction"`
+	GCPercent     int64   `json:"mem.gc.percent" goruntime:"go"`
+	MemoryLimit   int64   `json:"mem.limit"`
+
+	Goarch  string `json:"-"`
+	Goos    string `json:"-"`
+	Version string `json:"-"`
+}
+
+// FromMemStats sets the memory and gc fields
+func (f *Fields) FromMemStats(m *runtime.MemStats) {
+	f.collectMemStats(m)
+	f.collectGCStats(m)
+}
+
+func (f *Fields) collectGCStats(m *runtime.MemStats) {
+	f.GCSys = int64(m.GCSys)
+	f.NextGC = int64(m.NextGC)
+	f.LastGC = int64(m.LastGC)
+	f.PauseTotalNs = int64(m.PauseTotalNs)
+	f.PauseNs = int64(m.PauseNs[(m.NumGC+255)%256])
+	f.NumGC = int64(m.NumGC)
+	f.GCCPUFraction = float64(m.GCCPUFraction)
+}
+
+func (f *Fields) collectMemStats(m *runtime.MemStats) {
+	// General
+	f.Alloc = int64(m.Alloc)
+	f.TotalAlloc = int64(m.TotalAlloc)
+	f.Sys = int64(m.Sys)
+	f.Lookups = int64(m.Lookups)
+	f.Mallocs = int64(m.Mallocs)
+	f.Frees = int64(m.Frees)
+
+	// Heap
+	f.HeapAlloc = int64(m.HeapAlloc)
+	f.HeapSys = int64(m.HeapSys)
+	f.HeapIdle = int64(m.HeapIdle)
+	f.HeapInuse = int64(m.HeapInuse)
+	f.HeapReleased = int64(m.HeapReleased)
+	f.HeapObjects = int64(m.HeapObjects)
+
+	// Stack
+	f.StackInuse = int64(m.StackInuse)
+	f.StackSys = int64(m.StackSys)
+	f.MSpanInuse = int64(m.MSpanInuse)
+	f.MSpanSys = int64(m.MSpanSys)
+	f.MCacheInuse = int64(m.MCacheInuse)
+	f.MCacheSys = int64(m.MCacheSys)
+
+	f.OtherSys = int64(m.OtherSys)
+}
+
+// Tags returns the tags of the point
+func (f *Fields) Tags() map[string]string {
+	return map[string]string{
+		// "go.os":      f.Goos,
+		// "go.arch":    f.Goarch,
+		// "go.version": f.Version,
+		"serial":  f.Serial,
+		"runtime": f.Runtime,
+	}
+}
+
+// mapSize presizes the map of the fields, leaving room for the fields a
+// collector adds to them
+const mapSize = 64
+
+type valueField struct {
+	name      string
+	index     int
+	omitEmpty bool
+	goOnly    bool
+}
+
+// valueFields are the fields returned by ToMap. A field without a tag or
+// of an unsupported type is left out and reported in errValueFields,
+// which the tests check is nil so none can be missed.
+var valueFields, errValueFields = fieldsOf(reflect.TypeOf(Fields{}))
+
+func fieldsOf(t reflect.Type) ([]valueField, error) {
+	var vfs []valueField
+	var errs []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag, ok := f.Tag.Lookup("json")
+		if !ok {
+			errs = append(errs, fmt.Sprintf("field %s has no json tag", f.Name))
+			continue
+		}
+		if tag == "-" || f.Tag.Get("goruntime") == "tag" {
+			continue
+		}
+		switch f.Type.Kind() {
+		case reflect.Int64, reflect.Float64, reflect.String, reflect.Bool:
+		default:
+			errs = append(errs, fmt.Sprintf("field %s is a %s", f.Name, f.Type))
+			continue
+		}
+		parts := strings.Split(tag, ",")
+		vfs = append(vfs, valueField{
+			name:      parts[0],
+			index:     i,
+			omitEmpty: len(parts) > 1 && parts[1] == "omitempty",
+			goOnly:    f.Tag.Get("goruntime") == "go",
+		})
+	}
+	if errs != nil {
+		return vfs, fmt.Errorf("model: %s", strings.Join(errs, ", "))
+	}
+	return vfs, nil
+}
+
+// ToMap returns the fields by name
+func (f *Fields) ToMap() map[string]interface{} {
+	values := make(map[string]interface{}, mapSize)
+	v := reflect.ValueOf(f).Elem()
+	goRuntime := f.Runtime == "" || f.Runtime == RuntimeGo
+	for _, vf := range valueFields {
+		if vf.goOnly && !goRuntime {
+			continue
+		}
+		fv := v.Field(vf.index)
+		if vf.omitEmpty && fv.IsZero() {
+			continue
+		}
+		values[vf.name] = fv.Interface()
+	}
+	return values
+}
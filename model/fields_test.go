@@ -0,0 +1,62 @@
+package model
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFieldsTagParity(t *testing.T) {
+	if errValueFields != nil {
+		t.Fatal(errValueFields)
+	}
+
+	// every tagged field set, ToMap must return exactly the tags
+	var f Fields
+	v := reflect.ValueOf(&f).Elem()
+	want := make(map[string]bool)
+	for i := 0; i < v.NumField(); i++ {
+		sf := v.Type().Field(i)
+		tag := strings.Split(sf.Tag.Get("json"), ",")[0]
+		if tag == "-" || sf.Tag.Get("goruntime") == "tag" {
+			continue
+		}
+		want[tag] = true
+		switch fv := v.Field(i); fv.Kind() {
+		case reflect.Int64:
+			fv.SetInt(1)
+		case reflect.Float64:
+			fv.SetFloat(1)
+		case reflect.String:
+			fv.SetString("x")
+		case reflect.Bool:
+			fv.SetBool(true)
+		}
+	}
+	got := f.ToMap()
+	for name := range want {
+		if _, ok := got[name]; !ok {
+			t.Errorf("field %s missing from ToMap", name)
+		}
+	}
+	for name := range got {
+		if !want[name] {
+			t.Errorf("ToMap returns %s which is no field tag", name)
+		}
+	}
+}
+
+func TestFieldsOfReportsUntagged(t *testing.T) {
+	type bad struct {
+		Tagged   int64 `json:"tagged"`
+		Untagged int64
+		Slice    []int `json:"slice"`
+	}
+	vfs, err := fieldsOf(reflect.TypeOf(bad{}))
+	if err == nil {
+		t.Fatal("no error for an untagged field and a slice")
+	}
+	if len(vfs) != 1 || vfs[0].name != "tagged" {
+		t.Errorf("fields %v, want only tagged", vfs)
+	}
+}
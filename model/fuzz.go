@@ -0,0 +1,31 @@
+//go:build gofuzz
+// +build gofuzz
+
+package model
+
+import (
+	"encoding/json"
+	"reflect"
+	"runtime"
+)
+
+// Fuzz is the go-fuzz entry point of the memstats decoder, what it decodes
+// must match encoding/json. The corpus is seeded from testdata/fuzz/corpus:
+//
+//	go-fuzz-build -tags gofuzz && go-fuzz -workdir testdata/fuzz
+func Fuzz(data []byte) int {
+	var fast MemStats
+	if err := fast.decode(data); err != nil {
+		return 0
+	}
+	var std runtime.MemStats
+	if err := json.Unmarshal(data, &std); err != nil {
+		return 0
+	}
+	// the size classes are skipped
+	std.BySize = fast.BySize
+	if !reflect.DeepEqual(runtime.MemStats(fast), std) {
+		panic("memstats decoded differently than by encoding/json")
+	}
+	return 1
+}
@@ -0,0 +1,40 @@
+package model
+
+// RuntimeGo is the runtime of the payloads without a runtime
+const RuntimeGo = "go"
+
+// Heap is the heap of the runtimes other than Go, e.g. "java" or
+// "python", which report it instead of the memstats. Used, Committed and
+// Max are in bytes, a runtime without a limit leaves Max 0.
+type Heap struct {
+	Used      int64 `json:"used"`
+	Committed int64 `json:"committed"`
+	Max       int64 `json:"max"`
+	Objects   int64 `json:"objects"`
+}
+
+// GC is the garbage collector of the runtimes other than Go, the pauses
+// in nanoseconds
+type GC struct {
+	Count        int64   `json:"count"`
+	PauseTotalNs int64   `json:"pauseTotalNs"`
+	LastPauseNs  int64   `json:"lastPauseNs"`
+	CPUFraction  float64 `json:"cpuFraction"`
+}
+
+// fromGeneric sets the memory and gc fields from the heap and the gc of
+// another runtime, under the names the Go fields have
+func (f *Fields) fromGeneric(h Heap, gc GC) {
+	f.Alloc = h.Used
+	f.HeapAlloc = h.Used
+	f.HeapSys = h.Committed
+	f.HeapInuse = h.Used
+	f.HeapIdle = h.Committed - h.Used
+	f.HeapObjects = h.Objects
+	f.MemoryLimit = h.Max
+
+	f.NumGC = gc.Count
+	f.PauseTotalNs = gc.PauseTotalNs
+	f.PauseNs = gc.LastPauseNs
+	f.GCCPUFraction = gc.CPUFraction
+}
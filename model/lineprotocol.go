@@ -0,0 +1,67 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	keyEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+	stringEscaper      = strings.NewReplacer(`"`, `\"`, `\`, `\\`)
+)
+
+// ToLineProtocol returns the fields as a point in the InfluxDB line
+// protocol, with tags and fields sorted by key
+func (f *Fields) ToLineProtocol(measurement string, t time.Time) string {
+	return LineProtocol(measurement, f.Tags(), f.ToMap(), t)
+}
+
+// LineProtocol returns a point in the InfluxDB line protocol, the values
+// being integers, floats, strings or booleans
+func LineProtocol(measurement string, tags map[string]string, values map[string]interface{}, t time.Time) string {
+	var b strings.Builder
+	b.WriteString(measurementEscaper.Replace(measurement))
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if tags[k] == "" {
+			continue
+		}
+		fmt.Fprintf(&b, ",%s=%s", keyEscaper.Replace(k), keyEscaper.Replace(tags[k]))
+	}
+
+	sep := " "
+	keys = keys[:0]
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		var v string
+		switch x := values[k].(type) {
+		case int64:
+			v = strconv.FormatInt(x, 10) + "i"
+		case int:
+			v = strconv.Itoa(x) + "i"
+		case float64:
+			v = strconv.FormatFloat(x, 'g', -1, 64)
+		case bool:
+			v = strconv.FormatBool(x)
+		case string:
+			v = `"` + stringEscaper.Replace(x) + `"`
+		default:
+			continue
+		}
+		b.WriteString(sep + keyEscaper.Replace(k) + "=" + v)
+		sep = ","
+	}
+	fmt.Fprintf(&b, " %d", t.UnixNano())
+	return b.String()
+}
@@ -0,0 +1,302 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// MemStats decodes the memstats of the payload without encoding/json,
+// which spends most of a scrape on the size classes and pause arrays
+// nobody reads. Unexpected input falls back to encoding/json, as does
+// everything when built with the goruntime_stdjson tag.
+type MemStats runtime.MemStats
+
+var errFallback = errors.New("fallback to encoding/json")
+
+func (m *MemStats) UnmarshalJSON(b []byte) error {
+	if !stdJSON {
+		*m = MemStats{}
+		if err := m.decode(b); err == nil {
+			return nil
+		}
+	}
+	*m = MemStats{}
+	return json.Unmarshal(b, (*runtime.MemStats)(m))
+}
+
+func (m *MemStats) decode(b []byte) error {
+	d := scanner{b: b}
+	if !d.consume('{') {
+		return errFallback
+	}
+	if d.consume('}') {
+		return nil
+	}
+	for {
+		key, ok := d.key()
+		if !ok {
+			return errFallback
+		}
+		var err error
+		switch string(key) {
+		case "Alloc":
+			m.Alloc, err = d.uint()
+		case "TotalAlloc":
+			m.TotalAlloc, err = d.uint()
+		case "Sys":
+			m.Sys, err = d.uint()
+		case "Lookups":
+			m.Lookups, err = d.uint()
+		case "Mallocs":
+			m.Mallocs, err = d.uint()
+		case "Frees":
+			m.Frees, err = d.uint()
+		case "HeapAlloc":
+			m.HeapAlloc, err = d.uint()
+		case "HeapSys":
+			m.HeapSys, err = d.uint()
+		case "HeapIdle":
+			m.HeapIdle, err = d.uint()
+		case "HeapInuse":
+			m.HeapInuse, err = d.uint()
+		case "HeapReleased":
+			m.HeapReleased, err = d.uint()
+		case "HeapObjects":
+			m.HeapObjects, err = d.uint()
+		case "StackInuse":
+			m.StackInuse, err = d.uint()
+		case "StackSys":
+			m.StackSys, err = d.uint()
+		case "MSpanInuse":
+			m.MSpanInuse, err = d.uint()
+		case "MSpanSys":
+			m.MSpanSys, err = d.uint()
+		case "MCacheInuse":
+			m.MCacheInuse, err = d.uint()
+		case "MCacheSys":
+			m.MCacheSys, err = d.uint()
+		case "BuckHashSys":
+			m.BuckHashSys, err = d.uint()
+		case "GCSys":
+			m.GCSys, err = d.uint()
+		case "OtherSys":
+			m.OtherSys, err = d.uint()
+		case "NextGC":
+			m.NextGC, err = d.uint()
+		case "LastGC":
+			m.LastGC, err = d.uint()
+		case "PauseTotalNs":
+			m.PauseTotalNs, err = d.uint()
+		case "PauseNs":
+			err = d.uints(m.PauseNs[:])
+		case "PauseEnd":
+			err = d.uints(m.PauseEnd[:])
+		case "NumGC":
+			var n uint64
+			n, err = d.uint()
+			m.NumGC = uint32(n)
+		case "NumForcedGC":
+			var n uint64
+			n, err = d.uint()
+			m.NumForcedGC = uint32(n)
+		case "GCCPUFraction":
+			m.GCCPUFraction, err = d.float()
+		case "EnableGC":
+			m.EnableGC, err = d.bool()
+		case "DebugGC":
+			m.DebugGC, err = d.bool()
+		default:
+			// encoding/json matches keys case insensitively
+			if caseFolded(key) {
+				return errFallback
+			}
+			err = d.skip()
+		}
+		if err != nil {
+			return err
+		}
+		if d.consume('}') {
+			return nil
+		}
+		if !d.consume(',') {
+			return errFallback
+		}
+	}
+}
+
+var memStatsNames = func() []string {
+	t := reflect.TypeOf(runtime.MemStats{})
+	names := make([]string, t.NumField())
+	for i := range names {
+		names[i] = t.Field(i).Name
+	}
+	return names
+}()
+
+// caseFolded tells if the key is a field name in another case
+func caseFolded(key []byte) bool {
+	k := string(key)
+	for _, name := range memStatsNames {
+		if k != name && strings.EqualFold(k, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// scanner reads the JSON values the agent writes, giving up on anything
+// else, e.g. escapes in keys
+type scanner struct {
+	b []byte
+	i int
+}
+
+func (d *scanner) ws() {
+	for d.i < len(d.b) {
+		switch d.b[d.i] {
+		case ' ', '\t', '\r', '\n':
+			d.i++
+		default:
+			return
+		}
+	}
+}
+
+func (d *scanner) consume(c byte) bool {
+	d.ws()
+	if d.i < len(d.b) && d.b[d.i] == c {
+		d.i++
+		return true
+	}
+	return false
+}
+
+// key reads a key and its colon
+func (d *scanner) key() ([]byte, bool) {
+	if !d.consume('"') {
+		return nil, false
+	}
+	start := d.i
+	for d.i < len(d.b) && d.b[d.i] != '"' {
+		if d.b[d.i] == '\\' {
+			return nil, false
+		}
+		d.i++
+	}
+	if d.i == len(d.b) {
+		return nil, false
+	}
+	key := d.b[start:d.i]
+	d.i++
+	return key, d.consume(':')
+}
+
+func (d *scanner) uint() (uint64, error) {
+	d.ws()
+	start := d.i
+	var n uint64
+	for d.i < len(d.b) && d.b[d.i] >= '0' && d.b[d.i] <= '9' {
+		digit := uint64(d.b[d.i] - '0')
+		if n > (math.MaxUint64-digit)/10 {
+			return 0, errFallback
+		}
+		n = n*10 + digit
+		d.i++
+	}
+	if d.i == start || d.i < len(d.b) && (d.b[d.i] == '.' || d.b[d.i] == 'e' || d.b[d.i] == 'E') {
+		return 0, errFallback
+	}
+	return n, nil
+}
+
+func (d *scanner) uints(a []uint64) error {
+	if !d.consume('[') {
+		return errFallback
+	}
+	if d.consume(']') {
+		return nil
+	}
+	for i := 0; ; i++ {
+		n, err := d.uint()
+		if err != nil {
+			return err
+		}
+		if i < len(a) {
+			a[i] = n
+		}
+		if d.consume(']') {
+			return nil
+		}
+		if !d.consume(',') {
+			return errFallback
+		}
+	}
+}
+
+func (d *scanner) float() (float64, error) {
+	d.ws()
+	start := d.i
+	for d.i < len(d.b) && isNumberByte(d.b[d.i]) {
+		d.i++
+	}
+	f, err := strconv.ParseFloat(string(d.b[start:d.i]), 64)
+	if err != nil {
+		return 0, errFallback
+	}
+	return f, nil
+}
+
+func isNumberByte(c byte) bool {
+	return c >= '0' && c <= '9' || c == '-' || c == '+' || c == '.' || c == 'e' || c == 'E'
+}
+
+func (d *scanner) bool() (bool, error) {
+	d.ws()
+	switch {
+	case hasPrefix(d.b[d.i:], "true"):
+		d.i += 4
+		return true, nil
+	case hasPrefix(d.b[d.i:], "false"):
+		d.i += 5
+		return false, nil
+	}
+	return false, errFallback
+}
+
+func hasPrefix(b []byte, s string) bool {
+	return len(b) >= len(s) && string(b[:len(s)]) == s
+}
+
+// skip skips a value
+func (d *scanner) skip() error {
+	d.ws()
+	depth := 0
+	for d.i < len(d.b) {
+		switch d.b[d.i] {
+		case '{', '[':
+			depth++
+		case '}', ']':
+			if depth == 0 {
+				return nil
+			}
+			depth--
+		case ',':
+			if depth == 0 {
+				return nil
+			}
+		case '"':
+			for d.i++; d.i < len(d.b) && d.b[d.i] != '"'; d.i++ {
+				if d.b[d.i] == '\\' {
+					d.i++
+				}
+			}
+		}
+		d.i++
+	}
+	return errFallback
+}
@@ -0,0 +1,66 @@
+package model
+
+import (
+	"encoding/json"
+	"runtime"
+	"testing"
+)
+
+func memStatsPayload(tb testing.TB) []byte {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	b, err := json.Marshal(&m)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return b
+}
+
+func TestMemStatsMatchesEncodingJSON(t *testing.T) {
+	for _, payload := range []string{
+		string(memStatsPayload(t)),
+		`{"Alloc": 18446744073709551615}`,
+		`{"Alloc": 18446744073709551616}`,
+		`{"Alloc": 27670116110564327420}`,
+		`{"alloc": 1, "Alloc": 2}`,
+		`{"HeapSys": 1.5}`,
+	} {
+		var fast MemStats
+		fastErr := fast.UnmarshalJSON([]byte(payload))
+		var std runtime.MemStats
+		stdErr := json.Unmarshal([]byte(payload), &std)
+		if (fastErr == nil) != (stdErr == nil) {
+			t.Errorf("%.40s: error %v, encoding/json %v", payload, fastErr, stdErr)
+			continue
+		}
+		// the size classes are skipped
+		std.BySize = fast.BySize
+		if fastErr == nil && runtime.MemStats(fast) != std {
+			t.Errorf("%.40s: decoded differently from encoding/json", payload)
+		}
+	}
+}
+
+func BenchmarkMemStats(b *testing.B) {
+	payload := memStatsPayload(b)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(payload)))
+	for i := 0; i < b.N; i++ {
+		var m MemStats
+		if err := m.UnmarshalJSON(payload); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMemStatsEncodingJSON(b *testing.B) {
+	payload := memStatsPayload(b)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(payload)))
+	for i := 0; i < b.N; i++ {
+		var m runtime.MemStats
+		if err := json.Unmarshal(payload, &m); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,11 @@
+// Package model is the data model shared by the agent and the collectors:
+// the payload served by the agent, RuntimeData, and the metrics derived
+// from it, Fields.
+//
+// The json tags of both are stable. The model follows semantic versioning:
+// renaming or removing a field or a tag is a major version, adding one a
+// minor version.
+package model
+
+// Version is the version of the model
+const Version = "1.27.0"
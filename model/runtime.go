@@ -0,0 +1,603 @@
+package model
+
+import (
+	"runtime"
+	"strings"
+)
+
+// RuntimeData is the payload the agent serves, the expvar vars of the app.
+// Agents of other runtimes name it in Runtime and report Heap and GC
+// instead of Memstats.
+type RuntimeData struct {
+	Serial       string   `json:"serial"`
+	Runtime      string   `json:"runtime"`
+	CPUNum       int      `json:"cpuNum"`
+	ThreadNum    int      `json:"threadNum"`
+	GoRoutineNum int      `json:"goroutineNum"`
+	CgoCalls     int64    `json:"cgoCalls"`
+	CpuPercent   int      `json:"cpuPercent"`
+	MemPercent   int      `json:"memPercent"`
+	Memstats     MemStats `json:"memstats"`
+	Heap         Heap     `json:"heap"`
+	GC           GC       `json:"gc"`
+	GCPercent    int64    `json:"gcPercent"`
+	MemoryLimit  int64    `json:"memoryLimit"`
+
+	ForcedReleaseCount int64 `json:"forcedReleaseCount"`
+	LastForcedRelease  int64 `json:"lastForcedRelease"`
+
+	WatchdogMaxLagMs int64 `json:"watchdogMaxLagMs"`
+	WatchdogDumps    int64 `json:"watchdogDumps"`
+
+	LastDiagnostics string `json:"lastDiagnostics"`
+
+	// Cohorts are the features of the cohort policy the app is enrolled in
+	Cohorts []string `json:"cohorts"`
+
+	// Events are the recent events of the app, e.g. control actions
+	Events []Event `json:"events"`
+
+	// Clock is the wall clock of the agent in unix nanoseconds, Monotonic
+	// the nanoseconds since the agent started
+	Clock     int64 `json:"clock"`
+	Monotonic int64 `json:"monotonic"`
+
+	// StartTime is the process creation in unix seconds, Uptime the
+	// seconds since then
+	StartTime int64 `json:"startTime"`
+	Uptime    int64 `json:"uptime"`
+
+	// Seq numbers the samples delivered by the agent, gaps are lost samples
+	Seq int64 `json:"seq"`
+
+	// SchemaVersion is the version of the layout of the payload
+	SchemaVersion int64 `json:"schemaVersion"`
+
+	Panics    int64  `json:"panics"`
+	LastPanic string `json:"lastPanic"`
+
+	Log struct {
+		Errors    int64   `json:"errors"`
+		Warns     int64   `json:"warns"`
+		ErrorRate float64 `json:"errorRate"`
+		WarnRate  float64 `json:"warnRate"`
+	} `json:"log"`
+
+	// Labels are tags of the app
+	Labels map[string]string `json:"labels"`
+
+	// EBPF are the counters of the eBPF programs, null when not started
+	EBPF struct {
+		Syscalls       int64  `json:"syscalls"`
+		OffCPUNs       int64  `json:"offCpuNs"`
+		TCPRetransmits int64  `json:"tcpRetransmits"`
+		Error          string `json:"error"`
+	} `json:"ebpf"`
+
+	// Sockets are the sockets of the process, null but on linux
+	Sockets Sockets `json:"sockets"`
+
+	// ProcIO are the I/O counters of the process, null but on linux
+	ProcIO ProcIO `json:"procIO"`
+
+	// Threads are the busiest OS threads, null unless enabled on linux
+	Threads []Thread `json:"threads"`
+
+	// Placement is where the process runs, null but on linux
+	Placement Placement `json:"placement"`
+
+	// Paging are the page faults and the swap, null but on linux
+	Paging Paging `json:"paging"`
+
+	// Overhead is the cost of the agent itself
+	Overhead Overhead `json:"overhead"`
+
+	// Pressure is the pressure stall information by resource, e.g. "cpu"
+	// for the host and "cgroup.cpu" for the cgroup, null but on linux
+	Pressure map[string]PSI `json:"pressure"`
+
+	// Host are the metrics of the host, null unless the agent collects them
+	Host Host `json:"host"`
+
+	// Hardware are the temperatures and CPU clocks, null but on linux
+	Hardware Hardware `json:"hw"`
+
+	// GCEvents are the recent gc cycles, null unless the agent records them
+	GCEvents []GCEvent `json:"gcEvents"`
+
+	// AllocSites are the functions allocating the most, null unless the
+	// agent samples them
+	AllocSites []AllocSite `json:"allocSites"`
+
+	// OffHeap is the memory outside of the Go heap
+	OffHeap OffHeap `json:"offHeap"`
+
+	// Timers estimate the timers active, a growing count is a leak
+	Timers Timers `json:"timers"`
+
+	// Queues are the channels and queues registered with the agent by
+	// name, null unless the app registers some
+	Queues map[string]Queue `json:"queues"`
+
+	// Pools are the worker pools of the agent by name, null unless the app
+	// starts some
+	Pools map[string]Pool `json:"pools"`
+
+	// Collectors are the results of the collectors registered by the app
+	// by name, null unless it registers some
+	Collectors map[string]CollectorResult `json:"collectors"`
+
+	// Sinks are the sinks the agent fans the runtime data out to by name,
+	// null unless the app starts some
+	Sinks map[string]Sink `json:"sinks"`
+
+	// Budget is the spend of the expensive collectors by name, null until
+	// one runs
+	Budget map[string]CollectorBudget `json:"budget"`
+
+	// MemOS is the resident memory of the process, null but on linux
+	MemOS MemOS `json:"memOS"`
+
+	// SLO are the burn rates of the error budget of the requests, null
+	// unless the app sets an SLO
+	SLO struct {
+		Target        float64 `json:"target"`
+		ShortBurnRate float64 `json:"shortBurnRate"`
+		LongBurnRate  float64 `json:"longBurnRate"`
+	} `json:"slo"`
+}
+
+// Hardware are the temperatures of the thermal zones in degrees Celsius
+// by zone type, and the average current clock, limit and maximum clock of
+// the CPU frequency policies. The thermal throttling lowers the limit
+// below the maximum, ThrottleCount counts the throttling events where the
+// CPUs do.
+type Hardware struct {
+	Temps         map[string]float64 `json:"temps"`
+	CPUs          int                `json:"cpus"`
+	CPUFreqMHz    float64            `json:"cpuFreqMHz"`
+	CPULimitMHz   float64            `json:"cpuLimitMHz"`
+	CPUMaxFreqMHz float64            `json:"cpuMaxFreqMHz"`
+	ThrottleCount int64              `json:"throttleCount"`
+}
+
+// HardwareFields returns the hardware as hw.temp.<zone type>,
+// hw.cpu.freq_mhz, hw.cpu.limit_mhz, hw.cpu.max_freq_mhz, hw.cpu.throttled
+// and hw.cpu.throttle_count fields, none of what is absent
+func (rd *RuntimeData) HardwareFields() map[string]interface{} {
+	hw := rd.Hardware
+	fields := make(map[string]interface{}, len(hw.Temps)+4)
+	for zone, c := range hw.Temps {
+		fields["hw.temp."+zone] = c
+	}
+	if hw.CPUs > 0 {
+		fields["hw.cpu.freq_mhz"] = hw.CPUFreqMHz
+		fields["hw.cpu.limit_mhz"] = hw.CPULimitMHz
+		fields["hw.cpu.max_freq_mhz"] = hw.CPUMaxFreqMHz
+		fields["hw.cpu.throttled"] = hw.CPULimitMHz < hw.CPUMaxFreqMHz
+	}
+	if hw.ThrottleCount > 0 {
+		fields["hw.cpu.throttle_count"] = hw.ThrottleCount
+	}
+	return fields
+}
+
+// Host are the load averages, the memory in bytes and the CPU steal in
+// seconds since boot of a host
+type Host struct {
+	Load1        float64 `json:"load1"`
+	Load5        float64 `json:"load5"`
+	Load15       float64 `json:"load15"`
+	MemTotal     int64   `json:"memTotal"`
+	MemAvailable int64   `json:"memAvailable"`
+	CPUSteal     float64 `json:"cpuSteal"`
+}
+
+// PSI is the pressure stall information of a resource: the share of time
+// some or all tasks stalled on it in percent, over 10s, 60s and 300s, and
+// the total stall time in microseconds
+type PSI struct {
+	Some PSILine `json:"some"`
+	Full PSILine `json:"full"`
+}
+
+type PSILine struct {
+	Avg10  float64 `json:"avg10"`
+	Avg60  float64 `json:"avg60"`
+	Avg300 float64 `json:"avg300"`
+	Total  int64   `json:"total"`
+}
+
+// SLOFields returns the slo.target, slo.burn_rate.short and
+// slo.burn_rate.long fields, none when the app sets no SLO
+func (rd *RuntimeData) SLOFields() map[string]interface{} {
+	if rd.SLO.Target == 0 {
+		return nil
+	}
+	return map[string]interface{}{
+		"slo.target":          rd.SLO.Target,
+		"slo.burn_rate.short": rd.SLO.ShortBurnRate,
+		"slo.burn_rate.long":  rd.SLO.LongBurnRate,
+	}
+}
+
+// QueueFields returns the queues as queue.<name>.<len, cap or
+// utilization> fields, the utilization is 0 for unbuffered channels
+func (rd *RuntimeData) QueueFields() map[string]interface{} {
+	fields := make(map[string]interface{}, len(rd.Queues)*3)
+	for name, q := range rd.Queues {
+		prefix := "queue." + name + "."
+		fields[prefix+"len"] = int64(q.Len)
+		fields[prefix+"cap"] = int64(q.Cap)
+		utilization := 0.0
+		if q.Cap > 0 {
+			utilization = float64(q.Len) / float64(q.Cap)
+		}
+		fields[prefix+"utilization"] = utilization
+	}
+	return fields
+}
+
+// PoolFields returns the worker pools as pool.<name>.<stat> fields
+func (rd *RuntimeData) PoolFields() map[string]interface{} {
+	fields := make(map[string]interface{}, len(rd.Pools)*8)
+	for name, p := range rd.Pools {
+		prefix := "pool." + name + "."
+		fields[prefix+"workers"] = int64(p.Workers)
+		fields[prefix+"busy"] = p.Busy
+		fields[prefix+"queued"] = int64(p.Queued)
+		fields[prefix+"queue_cap"] = int64(p.QueueCap)
+		fields[prefix+"completed"] = p.Completed
+		fields[prefix+"latency_p50_ms"] = p.LatencyP50Ms
+		fields[prefix+"latency_p90_ms"] = p.LatencyP90Ms
+		fields[prefix+"latency_p99_ms"] = p.LatencyP99Ms
+	}
+	return fields
+}
+
+// CollectorFields returns the fields of the collectors as
+// collector.<name>.<field>, with their run time, errors, timeouts and
+// panics, and the error of the last run when it failed. Fields which are
+// not numbers, strings or booleans are left out.
+func (rd *RuntimeData) CollectorFields() map[string]interface{} {
+	fields := make(map[string]interface{})
+	for name, c := range rd.Collectors {
+		prefix := "collector." + name + "."
+		for k, v := range c.Fields {
+			switch v.(type) {
+			case float64, string, bool:
+				fields[prefix+k] = v
+			}
+		}
+		fields[prefix+"duration_ms"] = c.DurationMs
+		fields[prefix+"errors"] = c.Errors
+		fields[prefix+"timeouts"] = c.Timeouts
+		fields[prefix+"panics"] = c.Panics
+		if c.Error != "" {
+			fields[prefix+"error"] = c.Error
+		}
+	}
+	return fields
+}
+
+// SinkFields returns the sinks as sink.<name>.<stat> fields, with the
+// error of the last failed send
+func (rd *RuntimeData) SinkFields() map[string]interface{} {
+	fields := make(map[string]interface{}, len(rd.Sinks)*5)
+	for name, s := range rd.Sinks {
+		prefix := "sink." + name + "."
+		fields[prefix+"sent"] = s.Sent
+		fields[prefix+"errors"] = s.Errors
+		fields[prefix+"dropped"] = s.Dropped
+		fields[prefix+"queued"] = int64(s.Queued)
+		if s.LastError != "" {
+			fields[prefix+"last_error"] = s.LastError
+		}
+	}
+	return fields
+}
+
+// BudgetFields returns the spend of the collectors as budget.<name>.<stat>
+// fields, with the reason of the throttling while throttled
+func (rd *RuntimeData) BudgetFields() map[string]interface{} {
+	fields := make(map[string]interface{}, len(rd.Budget)*5)
+	for name, b := range rd.Budget {
+		prefix := "budget." + name + "."
+		fields[prefix+"cpu_percent"] = b.CPUPercent
+		fields[prefix+"alloc_rate"] = b.AllocRate
+		fields[prefix+"throttled"] = b.Throttled
+		fields[prefix+"skipped"] = b.Skipped
+		if b.Throttled {
+			fields[prefix+"reason"] = b.Reason
+		}
+	}
+	return fields
+}
+
+// PressureFields returns the pressure as pressure.<resource>.<some or
+// full>.<avg10, avg60, avg300 or total> fields, Fields has a fixed set
+func (rd *RuntimeData) PressureFields() map[string]interface{} {
+	fields := make(map[string]interface{}, len(rd.Pressure)*8)
+	for r, p := range rd.Pressure {
+		for kind, l := range map[string]PSILine{"some": p.Some, "full": p.Full} {
+			prefix := "pressure." + r + "." + kind + "."
+			fields[prefix+"avg10"] = l.Avg10
+			fields[prefix+"avg60"] = l.Avg60
+			fields[prefix+"avg300"] = l.Avg300
+			fields[prefix+"total"] = l.Total
+		}
+	}
+	return fields
+}
+
+// Paging are the page faults and the swapped bytes of a process, and the
+// swap of its host with the pages swapped in and out since boot
+type Paging struct {
+	MinorFaults   int64 `json:"minorFaults"`
+	MajorFaults   int64 `json:"majorFaults"`
+	SwapBytes     int64 `json:"swapBytes"`
+	HostSwapTotal int64 `json:"hostSwapTotal"`
+	HostSwapUsed  int64 `json:"hostSwapUsed"`
+	HostSwapIns   int64 `json:"hostSwapIns"`
+	HostSwapOuts  int64 `json:"hostSwapOuts"`
+}
+
+// Overhead is the cost of an agent: the collection cycles, the wall time
+// and the bytes allocated of the last one, the CPU time of all and its
+// percent of the CPU time of the process, and the payload bytes sent. The
+// CPU time is only measured on linux, the bytes allocated are the ones of
+// the process during the cycle.
+type Overhead struct {
+	Cycles     int64   `json:"cycles"`
+	CollectNs  int64   `json:"collectNs"`
+	AllocBytes int64   `json:"allocBytes"`
+	CPUNs      int64   `json:"cpuNs"`
+	CPUPercent float64 `json:"cpuPercent"`
+	BytesSent  int64   `json:"bytesSent"`
+}
+
+// Placement is where a process may run and where its memory is
+type Placement struct {
+	// CPUs and MemNodes are the lists of the CPUs and memory nodes the
+	// process may use, e.g. "0-3,8"
+	CPUs     string `json:"cpus"`
+	CPUCount int    `json:"cpuCount"`
+	MemNodes string `json:"memNodes"`
+	// CgroupCPUs is the CPU list of the cpuset cgroup
+	CgroupCPUs string `json:"cgroupCpus"`
+	// NUMA are the bytes of the process per NUMA node
+	NUMA map[string]int64 `json:"numa"`
+}
+
+// Thread is an OS thread of the process and its CPU time since it started
+type Thread struct {
+	TID   int    `json:"tid"`
+	Name  string `json:"name"`
+	CPUNs int64  `json:"cpuNs"`
+}
+
+// ProcIO counts the I/O of a process, the bytes read from and written to
+// the storage and the read and write syscalls
+type ProcIO struct {
+	ReadBytes     int64 `json:"readBytes"`
+	WriteBytes    int64 `json:"writeBytes"`
+	ReadSyscalls  int64 `json:"readSyscalls"`
+	WriteSyscalls int64 `json:"writeSyscalls"`
+}
+
+// Sockets counts the sockets of a process, the TCP ones by state
+type Sockets struct {
+	TCP struct {
+		Established int64 `json:"established"`
+		SynSent     int64 `json:"synSent"`
+		SynRecv     int64 `json:"synRecv"`
+		FinWait     int64 `json:"finWait"`
+		CloseWait   int64 `json:"closeWait"`
+		Listen      int64 `json:"listen"`
+		Other       int64 `json:"other"`
+	} `json:"tcp"`
+	UDP int64 `json:"udp"`
+	// ListenQueue are the connections waiting to be accepted, ListenDrops
+	// those dropped by full accept queues in the network namespace
+	ListenQueue int64 `json:"listenQueue"`
+	ListenDrops int64 `json:"listenDrops"`
+}
+
+// GCEvent is a gc cycle: when its pause ended in unix nanoseconds and how
+// long it was, the heap goal which triggered it, the heap allocated after
+// it and whether the app forced it. The heap and the reason are zero for
+// the cycles the agent did not see end.
+type GCEvent struct {
+	Cycle     int64 `json:"cycle"`
+	End       int64 `json:"end"`
+	PauseNs   int64 `json:"pauseNs"`
+	HeapGoal  int64 `json:"heapGoal"`
+	HeapAfter int64 `json:"heapAfter"`
+	Forced    bool  `json:"forced"`
+}
+
+// AllocSite is a function allocating and its estimated allocation rate
+type AllocSite struct {
+	Function      string  `json:"function"`
+	BytesPerSec   float64 `json:"bytesPerSec"`
+	ObjectsPerSec float64 `json:"objectsPerSec"`
+}
+
+// OffHeap are the finalizers set with the agent which are pending and
+// run, and the bytes allocated by C, reported by the app or estimated
+type OffHeap struct {
+	FinalizersPending int64 `json:"finalizersPending"`
+	FinalizersRun     int64 `json:"finalizersRun"`
+	CgoEstimated      int64 `json:"cgoEstimated"`
+}
+
+// MemOS is the resident memory of a process in bytes, the anonymous and
+// file backed parts, the parts shared with and private from other
+// processes, and its proportional share
+type MemOS struct {
+	RSS     int64 `json:"rss"`
+	PSS     int64 `json:"pss"`
+	Anon    int64 `json:"anon"`
+	File    int64 `json:"file"`
+	Shared  int64 `json:"shared"`
+	Private int64 `json:"private"`
+}
+
+// Queue is the length and capacity of a channel or queue
+type Queue struct {
+	Len int `json:"len"`
+	Cap int `json:"cap"`
+}
+
+// Pool is a worker pool: its workers and the ones busy, the tasks queued
+// and done, and the percentiles of the run time of its last tasks
+type Pool struct {
+	Workers      int     `json:"workers"`
+	Busy         int64   `json:"busy"`
+	Queued       int     `json:"queued"`
+	QueueCap     int     `json:"queueCap"`
+	Completed    int64   `json:"completed"`
+	LatencyP50Ms float64 `json:"latencyP50Ms"`
+	LatencyP90Ms float64 `json:"latencyP90Ms"`
+	LatencyP99Ms float64 `json:"latencyP99Ms"`
+}
+
+// CollectorResult is the last run of a collector: its fields, or the
+// error when it failed, when it started in unix seconds and how long it
+// took, and the runs failed, timed out and panicked since the start
+type CollectorResult struct {
+	Fields     map[string]interface{} `json:"fields"`
+	Error      string                 `json:"error"`
+	Time       int64                  `json:"time"`
+	DurationMs float64                `json:"durationMs"`
+	Errors     int64                  `json:"errors"`
+	Timeouts   int64                  `json:"timeouts"`
+	Panics     int64                  `json:"panics"`
+}
+
+// Sink is a sink of an agent: the payloads sent, failed and dropped from
+// its full buffer, the ones buffered, and the error of the last failure
+type Sink struct {
+	Sent      int64  `json:"sent"`
+	Errors    int64  `json:"errors"`
+	Dropped   int64  `json:"dropped"`
+	Queued    int    `json:"queued"`
+	LastError string `json:"lastError"`
+}
+
+// CollectorBudget is the spend of an expensive collector over the window
+// of the budget, the percent of a CPU and the bytes allocated per second,
+// whether it is throttled and why, and the runs skipped since the start
+type CollectorBudget struct {
+	CPUPercent float64 `json:"cpuPercent"`
+	AllocRate  float64 `json:"allocRate"`
+	Throttled  bool    `json:"throttled"`
+	Reason     string  `json:"reason"`
+	Skipped    int64   `json:"skipped"`
+}
+
+// Timers are the goroutines sleeping in time.Sleep and the tickers and
+// func timers made with the agent not stopped, and their sum
+type Timers struct {
+	ActiveEstimate int64 `json:"activeEstimate"`
+	Sleeping       int64 `json:"sleeping"`
+	Tickers        int64 `json:"tickers"`
+}
+
+// Event is something done to the app, e.g. a control action
+type Event struct {
+	Time   int64  `json:"time"`
+	Who    string `json:"who"`
+	Action string `json:"action"`
+	Result string `json:"result"`
+	OK     bool   `json:"ok"`
+}
+
+// Fields returns the fields of the runtime data
+func (rd *RuntimeData) Fields() Fields {
+	f := Fields{}
+	f.Serial = rd.Serial
+	f.NumCpu = int64(rd.CPUNum)
+	f.NumGoroutine = int64(rd.GoRoutineNum)
+	f.NumThread = int64(rd.ThreadNum)
+	f.NumCgoCall = rd.CgoCalls
+	f.CpuPercent = int64(rd.CpuPercent)
+	f.MemPercent = int64(rd.MemPercent)
+	f.GCPercent = rd.GCPercent
+	f.MemoryLimit = rd.MemoryLimit
+	f.ForcedReleaseCount = rd.ForcedReleaseCount
+	f.LastForcedRelease = rd.LastForcedRelease
+	f.WatchdogMaxLagMs = rd.WatchdogMaxLagMs
+	f.WatchdogDumps = rd.WatchdogDumps
+	f.LastDiagnostics = rd.LastDiagnostics
+	f.Cohorts = strings.Join(rd.Cohorts, ",")
+	f.Panics = rd.Panics
+	f.LastPanic = rd.LastPanic
+	f.LogErrors = rd.Log.Errors
+	f.LogWarns = rd.Log.Warns
+	f.LogErrorRate = rd.Log.ErrorRate
+	f.LogWarnRate = rd.Log.WarnRate
+	f.EBPFSyscalls = rd.EBPF.Syscalls
+	f.EBPFOffCPUNs = rd.EBPF.OffCPUNs
+	f.EBPFTCPRetransmits = rd.EBPF.TCPRetransmits
+	f.EBPFError = rd.EBPF.Error
+	f.SockTCPEstablished = rd.Sockets.TCP.Established
+	f.SockTCPSynSent = rd.Sockets.TCP.SynSent
+	f.SockTCPSynRecv = rd.Sockets.TCP.SynRecv
+	f.SockTCPFinWait = rd.Sockets.TCP.FinWait
+	f.SockTCPCloseWait = rd.Sockets.TCP.CloseWait
+	f.SockTCPListen = rd.Sockets.TCP.Listen
+	f.SockTCPOther = rd.Sockets.TCP.Other
+	f.SockUDP = rd.Sockets.UDP
+	f.SockListenQueue = rd.Sockets.ListenQueue
+	f.SockListenDrops = rd.Sockets.ListenDrops
+	f.ProcIOReadBytes = rd.ProcIO.ReadBytes
+	f.ProcIOWriteBytes = rd.ProcIO.WriteBytes
+	f.ProcIOReadSyscalls = rd.ProcIO.ReadSyscalls
+	f.ProcIOWriteSyscalls = rd.ProcIO.WriteSyscalls
+	f.OverheadCycles = rd.Overhead.Cycles
+	f.OverheadCollectNs = rd.Overhead.CollectNs
+	f.OverheadAllocBytes = rd.Overhead.AllocBytes
+	f.OverheadCPUNs = rd.Overhead.CPUNs
+	f.OverheadCPUPercent = rd.Overhead.CPUPercent
+	f.OverheadBytesSent = rd.Overhead.BytesSent
+	f.PlacementCPUs = rd.Placement.CPUs
+	f.PlacementCPUCount = int64(rd.Placement.CPUCount)
+	f.PlacementMemNodes = rd.Placement.MemNodes
+	f.PlacementCgroupCPUs = rd.Placement.CgroupCPUs
+	f.MinorFaults = rd.Paging.MinorFaults
+	f.MajorFaults = rd.Paging.MajorFaults
+	f.SwapBytes = rd.Paging.SwapBytes
+	f.HostSwapTotal = rd.Paging.HostSwapTotal
+	f.HostSwapUsed = rd.Paging.HostSwapUsed
+	f.HostSwapIns = rd.Paging.HostSwapIns
+	f.HostSwapOuts = rd.Paging.HostSwapOuts
+	f.HostLoad1 = rd.Host.Load1
+	f.HostLoad5 = rd.Host.Load5
+	f.HostLoad15 = rd.Host.Load15
+	f.HostMemTotal = rd.Host.MemTotal
+	f.HostMemAvailable = rd.Host.MemAvailable
+	f.HostCPUSteal = rd.Host.CPUSteal
+	f.FinalizersPending = rd.OffHeap.FinalizersPending
+	f.FinalizersRun = rd.OffHeap.FinalizersRun
+	f.CgoEstimated = rd.OffHeap.CgoEstimated
+	f.TimersActive = rd.Timers.ActiveEstimate
+	f.TimersSleeping = rd.Timers.Sleeping
+	f.Tickers = rd.Timers.Tickers
+	f.OSRSS = rd.MemOS.RSS
+	f.OSPSS = rd.MemOS.PSS
+	f.OSAnon = rd.MemOS.Anon
+	f.OSFile = rd.MemOS.File
+	f.OSShared = rd.MemOS.Shared
+	f.OSPrivate = rd.MemOS.Private
+	f.Runtime = rd.Runtime
+	if f.Runtime == "" {
+		f.Runtime = RuntimeGo
+	}
+	if f.Runtime == RuntimeGo {
+		f.FromMemStats((*runtime.MemStats)(&rd.Memstats))
+	} else {
+		f.fromGeneric(rd.Heap, rd.GC)
+	}
+	return f
+}
@@ -0,0 +1,80 @@
+package model
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+// SealedContentType is the content type of a sealed payload
+const SealedContentType = "application/vnd.gomonitor.sealed"
+
+// sealMagic starts a sealed payload, its version is the last byte
+var sealMagic = []byte("GMS1")
+
+// Seal encrypts the payload with AES-GCM under the key, of 16, 24 or 32
+// bytes. The sealed payload is the magic, the length of the key id and
+// the key id, which the reader picks the key by, the nonce and the
+// ciphertext. The header is authenticated along with the payload.
+func Seal(keyID string, key, payload []byte) ([]byte, error) {
+	if len(keyID) == 0 || len(keyID) > 255 {
+		return nil, errors.New("seal: the key id must have 1 to 255 bytes")
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	header := append(append(append([]byte(nil), sealMagic...), byte(len(keyID))), keyID...)
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	sealed := append(header, nonce...)
+	return aead.Seal(sealed, nonce, payload, header), nil
+}
+
+// IsSealed tells if the payload is sealed
+func IsSealed(b []byte) bool {
+	return bytes.HasPrefix(b, sealMagic)
+}
+
+// Open decrypts a sealed payload with the key of its key id
+func Open(sealed []byte, key func(keyID string) ([]byte, error)) ([]byte, error) {
+	if !IsSealed(sealed) || len(sealed) < len(sealMagic)+1 {
+		return nil, errors.New("open: not a sealed payload")
+	}
+	n := int(sealed[len(sealMagic)])
+	headerLen := len(sealMagic) + 1 + n
+	if len(sealed) < headerLen {
+		return nil, errors.New("open: truncated header")
+	}
+	keyID := string(sealed[len(sealMagic)+1 : headerLen])
+	k, err := key(keyID)
+	if err != nil {
+		return nil, fmt.Errorf("open: key %q: %s", keyID, err)
+	}
+	aead, err := newAEAD(k)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < headerLen+aead.NonceSize() {
+		return nil, errors.New("open: truncated nonce")
+	}
+	nonce := sealed[headerLen : headerLen+aead.NonceSize()]
+	payload, err := aead.Open(nil, nonce, sealed[headerLen+aead.NonceSize():], sealed[:headerLen])
+	if err != nil {
+		return nil, fmt.Errorf("open: key %q: %s", keyID, err)
+	}
+	return payload, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("seal: %s", err)
+	}
+	return cipher.NewGCM(block)
+}
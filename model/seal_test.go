@@ -0,0 +1,51 @@
+package model
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestSealOpen(t *testing.T) {
+	keys := map[string][]byte{
+		"old": bytes.Repeat([]byte{1}, 32),
+		"new": bytes.Repeat([]byte{2}, 16),
+	}
+	// the same key under another id
+	keys["wen"] = keys["new"]
+	key := func(id string) ([]byte, error) {
+		if k, ok := keys[id]; ok {
+			return k, nil
+		}
+		return nil, errors.New("unknown")
+	}
+	payload := []byte(`{"serial":"a"}`)
+	for _, id := range []string{"old", "new"} {
+		sealed, err := Seal(id, keys[id], payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !IsSealed(sealed) || bytes.Contains(sealed, payload) {
+			t.Fatalf("%s: not sealed: %q", id, sealed)
+		}
+		opened, err := Open(sealed, key)
+		if err != nil || !bytes.Equal(opened, payload) {
+			t.Fatalf("%s: opened %q, %v", id, opened, err)
+		}
+
+		// the key id is authenticated
+		if id == "new" {
+			tampered := append([]byte(nil), sealed...)
+			copy(tampered[len(sealMagic)+1:], "wen")
+			if _, err = Open(tampered, key); err == nil {
+				t.Errorf("%s: opened with a tampered key id", id)
+			}
+		}
+		if _, err = Open(sealed[:len(sealed)-1], key); err == nil {
+			t.Errorf("%s: opened a truncated payload", id)
+		}
+	}
+	if _, err := Seal("x", []byte("short"), payload); err == nil {
+		t.Error("sealed with a 5 bytes key")
+	}
+}
@@ -0,0 +1,143 @@
+package model
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SignatureHeader is the HTTP header of the signature of a payload
+const SignatureHeader = "X-Gomonitor-Signature"
+
+// the signing algorithms
+const (
+	SignHMACSHA256 = "hmac-sha256"
+	SignEd25519    = "ed25519"
+)
+
+// Signature signs a payload as sent, sealed or not, along with when it
+// was signed and a random nonce, so a reader can refuse the payloads
+// replayed. It is sent as
+// keyid=<id>,alg=<alg>,t=<unix nanos>,nonce=<hex>,sig=<base64>.
+type Signature struct {
+	KeyID string
+	Alg   string
+	Time  int64
+	Nonce string
+	Sig   []byte
+}
+
+// Sign signs the payload with alg under the key, the HMAC secret or the
+// Ed25519 private key or seed
+func Sign(keyID, alg string, key, payload []byte, now time.Time) (Signature, error) {
+	nonce := make([]byte, 12)
+	if _, err := rand.Read(nonce); err != nil {
+		return Signature{}, err
+	}
+	s := Signature{KeyID: keyID, Alg: alg, Time: now.UnixNano(), Nonce: hex.EncodeToString(nonce)}
+	if strings.ContainsAny(keyID, ",= ") {
+		return s, fmt.Errorf("sign: invalid key id %q", keyID)
+	}
+	switch alg {
+	case SignHMACSHA256:
+		if len(key) == 0 {
+			return s, errors.New("sign: empty key")
+		}
+		s.Sig = s.hmac(key, payload)
+	case SignEd25519:
+		switch len(key) {
+		case ed25519.SeedSize:
+			key = ed25519.NewKeyFromSeed(key)
+		case ed25519.PrivateKeySize:
+		default:
+			return s, fmt.Errorf("sign: ed25519 key of %d bytes, must be a seed or private key", len(key))
+		}
+		s.Sig = ed25519.Sign(ed25519.PrivateKey(key), s.signed(payload))
+	default:
+		return s, fmt.Errorf("sign: unknown alg %q", alg)
+	}
+	return s, nil
+}
+
+// Verify checks the signature of the payload with the key, the HMAC
+// secret or the Ed25519 public key, of the alg the key is for: the alg
+// of the signature isn't trusted
+func (s Signature) Verify(alg string, key, payload []byte) error {
+	if s.Alg != alg {
+		return fmt.Errorf("key %q: signed with %s, not %s", s.KeyID, s.Alg, alg)
+	}
+	switch alg {
+	case SignHMACSHA256:
+		if !hmac.Equal(s.Sig, s.hmac(key, payload)) {
+			return fmt.Errorf("key %q: signature mismatch", s.KeyID)
+		}
+	case SignEd25519:
+		if len(key) != ed25519.PublicKeySize {
+			return fmt.Errorf("key %q: ed25519 public key of %d bytes", s.KeyID, len(key))
+		}
+		if !ed25519.Verify(ed25519.PublicKey(key), s.signed(payload), s.Sig) {
+			return fmt.Errorf("key %q: signature mismatch", s.KeyID)
+		}
+	default:
+		return fmt.Errorf("unknown alg %q", alg)
+	}
+	return nil
+}
+
+func (s Signature) hmac(key, payload []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write(s.signed(payload))
+	return h.Sum(nil)
+}
+
+// signed is what is signed: the key id, alg, time and nonce and the
+// payload
+func (s Signature) signed(payload []byte) []byte {
+	head := s.KeyID + "\n" + s.Alg + "\n" + strconv.FormatInt(s.Time, 10) + "\n" + s.Nonce + "\n"
+	return append([]byte(head), payload...)
+}
+
+func (s Signature) String() string {
+	return fmt.Sprintf("keyid=%s,alg=%s,t=%d,nonce=%s,sig=%s",
+		s.KeyID, s.Alg, s.Time, s.Nonce, base64.StdEncoding.EncodeToString(s.Sig))
+}
+
+// ParseSignature parses the value of SignatureHeader
+func ParseSignature(v string) (Signature, error) {
+	var s Signature
+	var err error
+	for _, kv := range strings.Split(v, ",") {
+		i := strings.IndexByte(kv, '=')
+		if i < 0 {
+			return s, fmt.Errorf("invalid signature %q", v)
+		}
+		k, v := strings.TrimSpace(kv[:i]), strings.TrimSpace(kv[i+1:])
+		switch k {
+		case "keyid":
+			s.KeyID = v
+		case "alg":
+			s.Alg = v
+		case "t":
+			s.Time, err = strconv.ParseInt(v, 10, 64)
+		case "nonce":
+			s.Nonce = v
+		case "sig":
+			s.Sig, err = base64.StdEncoding.DecodeString(v)
+		}
+		if err != nil {
+			return s, fmt.Errorf("invalid signature %s: %s", k, err)
+		}
+	}
+	if s.KeyID == "" || s.Alg == "" || s.Time == 0 || s.Nonce == "" || len(s.Sig) == 0 {
+		return s, fmt.Errorf("incomplete signature %q", v)
+	}
+	return s, nil
+}
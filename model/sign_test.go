@@ -0,0 +1,59 @@
+package model
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"testing"
+	"time"
+)
+
+func TestSignVerify(t *testing.T) {
+	seed := bytes.Repeat([]byte{3}, ed25519.SeedSize)
+	public := ed25519.NewKeyFromSeed(seed).Public().(ed25519.PublicKey)
+	secret := []byte("secret")
+	payload := []byte(`{"serial":"a"}`)
+
+	for _, tc := range []struct {
+		alg       string
+		sign, ver []byte
+	}{
+		{SignHMACSHA256, secret, secret},
+		{SignEd25519, seed, public},
+	} {
+		s, err := Sign("k1", tc.alg, tc.sign, payload, time.Unix(0, 42))
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed, err := ParseSignature(s.String())
+		if err != nil {
+			t.Fatalf("%s: %s", tc.alg, err)
+		}
+		if err = parsed.Verify(tc.alg, tc.ver, payload); err != nil {
+			t.Errorf("%s: %s", tc.alg, err)
+		}
+		if parsed.Time != 42 {
+			t.Errorf("%s: time %d, want 42", tc.alg, parsed.Time)
+		}
+		if err = parsed.Verify(tc.alg, tc.ver, []byte(`{"serial":"b"}`)); err == nil {
+			t.Errorf("%s: verified a tampered payload", tc.alg)
+		}
+		replayed := parsed
+		replayed.Time++
+		if err = replayed.Verify(tc.alg, tc.ver, payload); err == nil {
+			t.Errorf("%s: verified a tampered time", tc.alg)
+		}
+	}
+
+	// an HMAC signature made with the public key is refused for the
+	// Ed25519 key
+	s, _ := Sign("k1", SignHMACSHA256, public, payload, time.Now())
+	if err := s.Verify(SignEd25519, public, payload); err == nil {
+		t.Error("verified an HMAC signature with an ed25519 key")
+	}
+
+	for _, v := range []string{"", "keyid=k1", "keyid=k1,alg=x,t=a,nonce=n,sig=AA=="} {
+		if _, err := ParseSignature(v); err == nil {
+			t.Errorf("parsed %q", v)
+		}
+	}
+}
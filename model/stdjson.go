@@ -0,0 +1,7 @@
+//go:build goruntime_stdjson
+// +build goruntime_stdjson
+
+package model
+
+// stdJSON decodes the memstats with encoding/json only
+const stdJSON = true
@@ -0,0 +1,278 @@
+// Package monitortest helps testing the collectors, sinks and processors
+// written against the model package: an in-memory Accumulator of points
+// with assertions, and golden files of its points in line protocol.
+package monitortest
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jursonmo/gomonitor/model"
+	"github.com/jursonmo/gomonitor/processor"
+)
+
+// Point is a point added to the Accumulator
+type Point struct {
+	Measurement string
+	Tags        map[string]string
+	Fields      map[string]interface{}
+	Time        time.Time
+}
+
+// Flat returns the point as a record of the processors, which transform
+// its fields and tags in place
+func (p *Point) Flat() processor.Flat {
+	return processor.Flat{Fields: p.Fields, Tags: p.Tags}
+}
+
+// Accumulator keeps the points and errors added to it, it may be used
+// from several goroutines
+type Accumulator struct {
+	sync.Mutex
+	Points []*Point
+	Errors []error
+}
+
+// AddFields adds a point, timestamped now unless t is given. The fields
+// and tags are copied.
+func (a *Accumulator) AddFields(measurement string, fields map[string]interface{}, tags map[string]string, t ...time.Time) {
+	p := &Point{
+		Measurement: measurement,
+		Tags:        make(map[string]string, len(tags)),
+		Fields:      make(map[string]interface{}, len(fields)),
+		Time:        time.Now(),
+	}
+	for k, v := range tags {
+		p.Tags[k] = v
+	}
+	for k, v := range fields {
+		p.Fields[k] = v
+	}
+	if len(t) > 0 {
+		p.Time = t[0]
+	}
+	a.Lock()
+	defer a.Unlock()
+	a.Points = append(a.Points, p)
+}
+
+// AddRuntimeData adds the runtime data as a point of the measurement,
+// with the fields and tags the goruntime input emits for it before its
+// options apply
+func (a *Accumulator) AddRuntimeData(measurement string, rd *model.RuntimeData) {
+	fields := rd.Fields()
+	values := fields.ToMap()
+	for _, section := range []map[string]interface{}{
+		rd.PressureFields(),
+		rd.HardwareFields(),
+		rd.SLOFields(),
+		rd.QueueFields(),
+		rd.PoolFields(),
+		rd.CollectorFields(),
+		rd.SinkFields(),
+		rd.BudgetFields(),
+	} {
+		for k, v := range section {
+			values[k] = v
+		}
+	}
+	tags := fields.Tags()
+	for k, v := range rd.Labels {
+		if _, ok := tags[k]; !ok {
+			tags[k] = v
+		}
+	}
+	a.AddFields(measurement, values, tags)
+}
+
+// AddError adds an error
+func (a *Accumulator) AddError(err error) {
+	if err == nil {
+		return
+	}
+	a.Lock()
+	defer a.Unlock()
+	a.Errors = append(a.Errors, err)
+}
+
+// Get returns the first point of the measurement
+func (a *Accumulator) Get(measurement string) (*Point, bool) {
+	a.Lock()
+	defer a.Unlock()
+	for _, p := range a.Points {
+		if p.Measurement == measurement {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+// Reset drops the points and errors
+func (a *Accumulator) Reset() {
+	a.Lock()
+	defer a.Unlock()
+	a.Points, a.Errors = nil, nil
+}
+
+// AssertHasField fails the test unless a point of the measurement has the
+// field, equal to want unless it is nil. Numbers of different types are
+// equal when their values are.
+func (a *Accumulator) AssertHasField(t testing.TB, measurement, field string, want interface{}) {
+	t.Helper()
+	a.Lock()
+	defer a.Unlock()
+	var got []string
+	for _, p := range a.Points {
+		if p.Measurement != measurement {
+			continue
+		}
+		v, ok := p.Fields[field]
+		if ok && (want == nil || equal(v, want)) {
+			return
+		}
+		if ok {
+			got = append(got, fmt.Sprintf("%v (%T)", v, v))
+		}
+	}
+	switch {
+	case len(got) > 0:
+		t.Errorf("%s: field %s = %s, want %v (%T)", measurement, field, strings.Join(got, ", "), want, want)
+	case a.has(measurement):
+		t.Errorf("%s: no field %s", measurement, field)
+	default:
+		t.Errorf("no %s point", measurement)
+	}
+}
+
+// AssertNoField fails the test when a point of the measurement has the
+// field
+func (a *Accumulator) AssertNoField(t testing.TB, measurement, field string) {
+	t.Helper()
+	a.Lock()
+	defer a.Unlock()
+	for _, p := range a.Points {
+		if v, ok := p.Fields[field]; ok && p.Measurement == measurement {
+			t.Errorf("%s: unexpected field %s = %v", measurement, field, v)
+			return
+		}
+	}
+}
+
+// AssertTag fails the test unless a point of the measurement has the tag
+// key with the value
+func (a *Accumulator) AssertTag(t testing.TB, measurement, key, value string) {
+	t.Helper()
+	a.Lock()
+	defer a.Unlock()
+	var got []string
+	for _, p := range a.Points {
+		if p.Measurement != measurement {
+			continue
+		}
+		v, ok := p.Tags[key]
+		if ok && v == value {
+			return
+		}
+		if ok {
+			got = append(got, v)
+		}
+	}
+	switch {
+	case len(got) > 0:
+		t.Errorf("%s: tag %s = %s, want %s", measurement, key, strings.Join(got, ", "), value)
+	case a.has(measurement):
+		t.Errorf("%s: no tag %s", measurement, key)
+	default:
+		t.Errorf("no %s point", measurement)
+	}
+}
+
+// AssertNoErrors fails the test when errors were added
+func (a *Accumulator) AssertNoErrors(t testing.TB) {
+	t.Helper()
+	a.Lock()
+	defer a.Unlock()
+	for _, err := range a.Errors {
+		t.Errorf("error: %s", err)
+	}
+}
+
+func (a *Accumulator) has(measurement string) bool {
+	for _, p := range a.Points {
+		if p.Measurement == measurement {
+			return true
+		}
+	}
+	return false
+}
+
+// equal compares the values, numbers by value
+func equal(got, want interface{}) bool {
+	if reflect.DeepEqual(got, want) {
+		return true
+	}
+	g, ok := processor.Number(got)
+	w, wok := processor.Number(want)
+	return ok && wok && g == w
+}
+
+// Render returns the points in line protocol, sorted and without their
+// time, less the ignored fields, e.g. the ones depending on when the
+// points were added, followed by the errors
+func (a *Accumulator) Render(ignore ...string) []byte {
+	ignored := make(map[string]bool, len(ignore))
+	for _, f := range ignore {
+		ignored[f] = true
+	}
+	a.Lock()
+	defer a.Unlock()
+	var lines []string
+	for _, p := range a.Points {
+		fields := make(map[string]interface{}, len(p.Fields))
+		for k, v := range p.Fields {
+			if !ignored[k] {
+				fields[k] = v
+			}
+		}
+		line := model.LineProtocol(p.Measurement, p.Tags, fields, time.Unix(0, 0))
+		lines = append(lines, strings.TrimSuffix(line, " 0"))
+	}
+	sort.Strings(lines)
+	for _, err := range a.Errors {
+		lines = append(lines, "E! "+err.Error())
+	}
+	var b bytes.Buffer
+	for _, l := range lines {
+		b.WriteString(l + "\n")
+	}
+	return b.Bytes()
+}
+
+// AssertGolden fails the test unless Render of the points, less the
+// ignored fields, is the content of the golden file at path, update
+// rewrites the file instead, e.g. from a -update flag of the test
+func (a *Accumulator) AssertGolden(t testing.TB, path string, update bool, ignore ...string) {
+	t.Helper()
+	got := a.Render(ignore...)
+	if update {
+		if err := ioutil.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s mismatch, run with update to rewrite it:\n--- want\n%s--- got\n%s", path, want, got)
+	}
+}
@@ -0,0 +1,75 @@
+package monitortest
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"testing"
+
+	"github.com/jursonmo/gomonitor/fixture"
+	"github.com/jursonmo/gomonitor/model"
+	"github.com/jursonmo/gomonitor/processor"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+func TestAccumulator(t *testing.T) {
+	var rd model.RuntimeData
+	if err := json.Unmarshal(fixture.Payload("runtime_v1.json"), &rd); err != nil {
+		t.Fatal(err)
+	}
+	var acc Accumulator
+	acc.AddRuntimeData("goruntime_m", &rd)
+
+	acc.AssertHasField(t, "goruntime_m", "mem.heap.alloc", 323456)
+	acc.AssertHasField(t, "goruntime_m", "cpu.percent", nil)
+	acc.AssertNoField(t, "goruntime_m", "nope")
+	acc.AssertTag(t, "goruntime_m", "serial", "fixture-1")
+	acc.AssertNoErrors(t)
+	acc.AssertGolden(t, "testdata/runtime_v1.golden", *update)
+
+	p, _ := acc.Get("goruntime_m")
+	chain, err := processor.New([]processor.Config{{Type: processor.TypeTag, Tag: "site", Value: "edge"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain.Process(p.Flat())
+	acc.AssertTag(t, "goruntime_m", "site", "edge")
+}
+
+// recorder records the failures of the assertions
+type recorder struct {
+	testing.TB
+	failures []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.failures = append(r.failures, fmt.Sprintf(format, args...))
+}
+
+func TestAssertFailures(t *testing.T) {
+	var acc Accumulator
+	acc.AddFields("m", map[string]interface{}{"a": int64(1)}, map[string]string{"k": "v"})
+	acc.AddError(fmt.Errorf("boom"))
+
+	r := &recorder{TB: t}
+	acc.AssertHasField(r, "m", "a", 2)
+	acc.AssertHasField(r, "m", "b", nil)
+	acc.AssertHasField(r, "x", "a", nil)
+	acc.AssertNoField(r, "m", "a")
+	acc.AssertTag(r, "m", "k", "w")
+	acc.AssertNoErrors(r)
+	want := []string{
+		"m: field a = 1 (int64), want 2 (int)",
+		"m: no field b",
+		"no x point",
+		"m: unexpected field a = 1",
+		"m: tag k = v, want w",
+		"error: boom",
+	}
+	if fmt.Sprint(r.failures) != fmt.Sprint(want) {
+		t.Errorf("failures %q, want %q", r.failures, want)
+	}
+}
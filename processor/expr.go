@@ -0,0 +1,280 @@
+package processor
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Expr is an arithmetic expression of fields, e.g.
+//
+//	mem.heap.inuse / mem.sys * 100
+//
+// of numbers, fields named by their dotted path or between backquotes
+// when they hold other characters, + - * / %, parentheses and the
+// functions abs, min and max. It has no value when a field is missing or
+// not a number, or on a division by zero.
+type Expr struct {
+	src  string
+	eval evalFunc
+}
+
+type evalFunc func(get func(name string) (float64, bool)) (float64, bool)
+
+// Compile parses the expression
+func Compile(src string) (*Expr, error) {
+	p := &exprParser{src: src}
+	p.next()
+	eval, err := p.expr()
+	if err == nil && p.err != nil {
+		err = p.err
+	}
+	if err == nil && p.tok != tokEOF {
+		err = p.errorf("unexpected %q", p.text)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("expression %q: %s", src, err)
+	}
+	return &Expr{src: src, eval: eval}, nil
+}
+
+// Eval evaluates the expression with the fields of get
+func (e *Expr) Eval(get func(name string) (float64, bool)) (float64, bool) {
+	v, ok := e.eval(get)
+	if !ok || math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, false
+	}
+	return v, true
+}
+
+func (e *Expr) String() string { return e.src }
+
+// the tokens of the expressions
+const (
+	tokEOF = iota
+	tokNumber
+	tokField
+	tokOp
+)
+
+type exprParser struct {
+	src  string
+	pos  int
+	tok  int
+	text string
+	num  float64
+	err  error
+}
+
+func (p *exprParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("at %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+// next scans the next token
+func (p *exprParser) next() {
+	for p.pos < len(p.src) && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t') {
+		p.pos++
+	}
+	if p.pos >= len(p.src) {
+		p.tok, p.text = tokEOF, ""
+		return
+	}
+	start := p.pos
+	c := rune(p.src[p.pos])
+	switch {
+	case c >= '0' && c <= '9' || c == '.':
+		for p.pos < len(p.src) && (isDigit(p.src[p.pos]) || p.src[p.pos] == '.' ||
+			p.src[p.pos] == 'e' || p.src[p.pos] == 'E' ||
+			(p.src[p.pos] == '-' || p.src[p.pos] == '+') && (p.src[p.pos-1] == 'e' || p.src[p.pos-1] == 'E')) {
+			p.pos++
+		}
+		p.tok, p.text = tokNumber, p.src[start:p.pos]
+		n, err := strconv.ParseFloat(p.text, 64)
+		if err != nil && p.err == nil {
+			p.err = p.errorf("invalid number %q", p.text)
+		}
+		p.num = n
+	case c == '_' || unicode.IsLetter(c):
+		for p.pos < len(p.src) && (isDigit(p.src[p.pos]) || p.src[p.pos] == '_' || p.src[p.pos] == '.' || unicode.IsLetter(rune(p.src[p.pos]))) {
+			p.pos++
+		}
+		p.tok, p.text = tokField, p.src[start:p.pos]
+	case c == '`':
+		end := strings.IndexByte(p.src[p.pos+1:], '`')
+		if end < 0 {
+			if p.err == nil {
+				p.err = p.errorf("unterminated field")
+			}
+			p.pos = len(p.src)
+			p.tok, p.text = tokEOF, ""
+			return
+		}
+		p.tok, p.text = tokField, p.src[p.pos+1:p.pos+1+end]
+		p.pos += end + 2
+	default:
+		p.pos++
+		p.tok, p.text = tokOp, string(c)
+	}
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+// expr := term (('+' | '-') term)*
+func (p *exprParser) expr() (evalFunc, error) {
+	left, err := p.term()
+	for err == nil && p.tok == tokOp && (p.text == "+" || p.text == "-") {
+		op := p.text
+		p.next()
+		var right evalFunc
+		if right, err = p.term(); err == nil {
+			left = binary(op, left, right)
+		}
+	}
+	return left, err
+}
+
+// term := unary (('*' | '/' | '%') unary)*
+func (p *exprParser) term() (evalFunc, error) {
+	left, err := p.unary()
+	for err == nil && p.tok == tokOp && (p.text == "*" || p.text == "/" || p.text == "%") {
+		op := p.text
+		p.next()
+		var right evalFunc
+		if right, err = p.unary(); err == nil {
+			left = binary(op, left, right)
+		}
+	}
+	return left, err
+}
+
+// unary := '-' unary | primary
+func (p *exprParser) unary() (evalFunc, error) {
+	if p.tok == tokOp && p.text == "-" {
+		p.next()
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return func(get func(string) (float64, bool)) (float64, bool) {
+			v, ok := x(get)
+			return -v, ok
+		}, nil
+	}
+	return p.primary()
+}
+
+// primary := number | field | function '(' expr (',' expr)* ')' | '(' expr ')'
+func (p *exprParser) primary() (evalFunc, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	switch p.tok {
+	case tokNumber:
+		n := p.num
+		p.next()
+		return func(func(string) (float64, bool)) (float64, bool) { return n, true }, nil
+	case tokField:
+		name := p.text
+		p.next()
+		if p.tok == tokOp && p.text == "(" {
+			return p.call(name)
+		}
+		return func(get func(string) (float64, bool)) (float64, bool) { return get(name) }, nil
+	case tokOp:
+		if p.text == "(" {
+			p.next()
+			x, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			if p.tok != tokOp || p.text != ")" {
+				return nil, p.errorf("missing )")
+			}
+			p.next()
+			return x, nil
+		}
+		return nil, p.errorf("unexpected %q", p.text)
+	}
+	return nil, p.errorf("unexpected end")
+}
+
+func (p *exprParser) call(name string) (evalFunc, error) {
+	p.next()
+	var args []evalFunc
+	for {
+		x, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, x)
+		if p.tok == tokOp && p.text == "," {
+			p.next()
+			continue
+		}
+		if p.tok != tokOp || p.text != ")" {
+			return nil, p.errorf("missing ) of %s", name)
+		}
+		p.next()
+		break
+	}
+
+	var f func(vs []float64) float64
+	switch name {
+	case "abs":
+		if len(args) != 1 {
+			return nil, p.errorf("abs takes 1 argument")
+		}
+		f = func(vs []float64) float64 { return math.Abs(vs[0]) }
+	case "min", "max":
+		m := math.Min
+		if name == "max" {
+			m = math.Max
+		}
+		f = func(vs []float64) float64 {
+			r := vs[0]
+			for _, v := range vs[1:] {
+				r = m(r, v)
+			}
+			return r
+		}
+	default:
+		return nil, p.errorf("unknown function %s", name)
+	}
+	return func(get func(string) (float64, bool)) (float64, bool) {
+		vs := make([]float64, len(args))
+		for i, a := range args {
+			v, ok := a(get)
+			if !ok {
+				return 0, false
+			}
+			vs[i] = v
+		}
+		return f(vs), true
+	}, nil
+}
+
+func binary(op string, left, right evalFunc) evalFunc {
+	return func(get func(string) (float64, bool)) (float64, bool) {
+		a, ok := left(get)
+		if !ok {
+			return 0, false
+		}
+		b, ok := right(get)
+		if !ok {
+			return 0, false
+		}
+		switch op {
+		case "+":
+			return a + b, true
+		case "-":
+			return a - b, true
+		case "*":
+			return a * b, true
+		case "/":
+			return a / b, b != 0
+		}
+		return math.Mod(a, b), b != 0
+	}
+}
@@ -0,0 +1,48 @@
+package processor
+
+import "testing"
+
+func TestExpr(t *testing.T) {
+	fields := map[string]float64{
+		"mem.heap.inuse":   25,
+		"mem.sys":          200,
+		"sink.push-a.sent": 3,
+		"zero":             0,
+	}
+	get := func(name string) (float64, bool) {
+		v, ok := fields[name]
+		return v, ok
+	}
+	for _, tc := range []struct {
+		src  string
+		want float64
+		ok   bool
+	}{
+		{"mem.heap.inuse / mem.sys * 100", 12.5, true},
+		{"1 + 2 * 3", 7, true},
+		{"(1 + 2) * 3", 9, true},
+		{"-mem.heap.inuse + 5", -20, true},
+		{"7 % 4", 3, true},
+		{"2.5e1 - 1e-1*10", 24, true},
+		{"max(1, mem.heap.inuse, 3) + abs(-1) + min(4, 2)", 28, true},
+		{"`sink.push-a.sent` * 2", 6, true},
+		{"mem.missing + 1", 0, false},
+		{"1 / zero", 0, false},
+	} {
+		e, err := Compile(tc.src)
+		if err != nil {
+			t.Errorf("%s: %s", tc.src, err)
+			continue
+		}
+		got, ok := e.Eval(get)
+		if ok != tc.ok || got != tc.want {
+			t.Errorf("%s = %v %v, want %v %v", tc.src, got, ok, tc.want, tc.ok)
+		}
+	}
+
+	for _, src := range []string{"", "1 +", "(1", "1 2", "foo(1)", "abs(1, 2)", "`a", "1..2", "a $ b"} {
+		if _, err := Compile(src); err == nil {
+			t.Errorf("%q compiled", src)
+		}
+	}
+}
@@ -0,0 +1,318 @@
+// Package processor transforms the metrics between their collection and
+// their emission, in the agent and in the goruntime input: a chain of
+// rename, scale, derive, filter and tag processors configured
+// declaratively, like the processors of telegraf.
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// the types of the processors
+const (
+	TypeRename = "rename"
+	TypeScale  = "scale"
+	TypeDerive = "derive"
+	TypeFilter = "filter"
+	TypeTag    = "tag"
+)
+
+// Config is a processor:
+//
+//	rename: Field to To
+//	scale:  the numbers of the Field glob to value*Factor+Offset
+//	derive: To as the Expr, or Fields[0] Op Fields[1] with Op one of
+//	        + - * /
+//	filter: drops the fields matching a Drop glob, and the ones matching
+//	        no Keep glob when set
+//	tag:    sets the Tag to Value
+type Config struct {
+	Type   string   `json:"type" toml:"type"`
+	Field  string   `json:"field" toml:"field"`
+	To     string   `json:"to" toml:"to"`
+	Factor float64  `json:"factor" toml:"factor"`
+	Offset float64  `json:"offset" toml:"offset"`
+	Op     string   `json:"op" toml:"op"`
+	Expr   string   `json:"expr" toml:"expr"`
+	Fields []string `json:"fields" toml:"fields"`
+	Drop   []string `json:"drop" toml:"drop"`
+	Keep   []string `json:"keep" toml:"keep"`
+	Tag    string   `json:"tag" toml:"tag"`
+	Value  string   `json:"value" toml:"value"`
+}
+
+// Record is what the processors transform: the fields by name and the
+// tags
+type Record interface {
+	Get(name string) (interface{}, bool)
+	Set(name string, v interface{})
+	Delete(name string)
+	// Names are the names of the fields
+	Names() []string
+	SetTag(key, value string)
+}
+
+// Chain runs processors in order
+type Chain []func(r Record)
+
+// New returns the chain of the configs, validated
+func New(cfgs []Config) (Chain, error) {
+	chain := make(Chain, 0, len(cfgs))
+	for i, cfg := range cfgs {
+		p, err := cfg.processor()
+		if err != nil {
+			return nil, fmt.Errorf("processor %d (%s): %s", i+1, cfg.Type, err)
+		}
+		chain = append(chain, p)
+	}
+	return chain, nil
+}
+
+// Process runs the chain on the record
+func (c Chain) Process(r Record) {
+	for _, p := range c {
+		p(r)
+	}
+}
+
+func (cfg Config) processor() (func(Record), error) {
+	switch cfg.Type {
+	case TypeRename:
+		if cfg.Field == "" || cfg.To == "" {
+			return nil, fmt.Errorf("field and to are required")
+		}
+		return func(r Record) {
+			if v, ok := r.Get(cfg.Field); ok {
+				r.Delete(cfg.Field)
+				r.Set(cfg.To, v)
+			}
+		}, nil
+
+	case TypeScale:
+		if cfg.Field == "" || cfg.Factor == 0 {
+			return nil, fmt.Errorf("field and a non zero factor are required")
+		}
+		if _, err := path.Match(cfg.Field, ""); err != nil {
+			return nil, fmt.Errorf("invalid field %q: %s", cfg.Field, err)
+		}
+		return func(r Record) {
+			for _, name := range r.Names() {
+				if ok, _ := path.Match(cfg.Field, name); !ok {
+					continue
+				}
+				v, _ := r.Get(name)
+				if f, ok := Number(v); ok {
+					r.Set(name, f*cfg.Factor+cfg.Offset)
+				}
+			}
+		}, nil
+
+	case TypeDerive:
+		src := cfg.Expr
+		if src == "" {
+			if len(cfg.Fields) != 2 {
+				return nil, fmt.Errorf("expr or two fields are required")
+			}
+			switch cfg.Op {
+			case "+", "-", "*", "/":
+			default:
+				return nil, fmt.Errorf("invalid op %q: must be one of + - * /", cfg.Op)
+			}
+			src = "`" + cfg.Fields[0] + "` " + cfg.Op + " `" + cfg.Fields[1] + "`"
+		}
+		if cfg.To == "" {
+			return nil, fmt.Errorf("to is required")
+		}
+		e, err := Compile(src)
+		if err != nil {
+			return nil, err
+		}
+		return func(r Record) {
+			get := func(name string) (float64, bool) {
+				v, _ := r.Get(name)
+				return Number(v)
+			}
+			if v, ok := e.Eval(get); ok {
+				r.Set(cfg.To, v)
+			}
+		}, nil
+
+	case TypeFilter:
+		if len(cfg.Drop) == 0 && len(cfg.Keep) == 0 {
+			return nil, fmt.Errorf("drop or keep is required")
+		}
+		for _, g := range append(append([]string{}, cfg.Drop...), cfg.Keep...) {
+			if _, err := path.Match(g, ""); err != nil {
+				return nil, fmt.Errorf("invalid glob %q: %s", g, err)
+			}
+		}
+		return func(r Record) {
+			for _, name := range r.Names() {
+				if matchAny(cfg.Drop, name) || len(cfg.Keep) > 0 && !matchAny(cfg.Keep, name) {
+					r.Delete(name)
+				}
+			}
+		}, nil
+
+	case TypeTag:
+		if cfg.Tag == "" {
+			return nil, fmt.Errorf("tag is required")
+		}
+		return func(r Record) { r.SetTag(cfg.Tag, cfg.Value) }, nil
+	}
+	return nil, fmt.Errorf("invalid type: must be one of %s, %s, %s, %s or %s", TypeRename, TypeScale, TypeDerive, TypeFilter, TypeTag)
+}
+
+func matchAny(globs []string, name string) bool {
+	for _, g := range globs {
+		if ok, _ := path.Match(g, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Number returns the value of a number of any type, json.Number included
+func Number(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case json.Number:
+		f, err := strconv.ParseFloat(string(v), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// Flat is a record of flat fields and tags, e.g. a telegraf metric
+type Flat struct {
+	Fields map[string]interface{}
+	Tags   map[string]string
+}
+
+func (f Flat) Get(name string) (interface{}, bool) {
+	v, ok := f.Fields[name]
+	return v, ok
+}
+
+func (f Flat) Set(name string, v interface{}) { f.Fields[name] = v }
+
+func (f Flat) Delete(name string) { delete(f.Fields, name) }
+
+func (f Flat) Names() []string {
+	names := make([]string, 0, len(f.Fields))
+	for k := range f.Fields {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (f Flat) SetTag(key, value string) { f.Tags[key] = value }
+
+// Tree is a record of nested objects, e.g. the runtime data, whose
+// fields are named by their dotted path, e.g. memstats.HeapAlloc. Only
+// the objects are descended, an array is a field. The tags are the
+// object under TagsKey.
+type Tree struct {
+	Root    map[string]interface{}
+	TagsKey string
+}
+
+// lookup returns the object holding the field and its key in it, a key
+// may contain dots, e.g. the cgroup.cpu of the pressure. With create the
+// missing objects of the path are made.
+func (t Tree) lookup(name string, create bool) (map[string]interface{}, string) {
+	m, rest := t.Root, name
+	for {
+		if _, ok := m[rest]; ok {
+			return m, rest
+		}
+		descended := false
+		// the longest key first
+		for i := strings.LastIndexByte(rest, '.'); i > 0; i = strings.LastIndexByte(rest[:i], '.') {
+			if sub, ok := m[rest[:i]].(map[string]interface{}); ok {
+				m, rest, descended = sub, rest[i+1:], true
+				break
+			}
+		}
+		if descended {
+			continue
+		}
+		i := strings.IndexByte(rest, '.')
+		if !create || i <= 0 {
+			return m, rest
+		}
+		if _, ok := m[rest[:i]]; ok {
+			return m, rest
+		}
+		sub := make(map[string]interface{})
+		m[rest[:i]] = sub
+		m, rest = sub, rest[i+1:]
+	}
+}
+
+func (t Tree) Get(name string) (interface{}, bool) {
+	m, key := t.lookup(name, false)
+	v, ok := m[key]
+	if _, isObject := v.(map[string]interface{}); isObject {
+		return nil, false
+	}
+	return v, ok
+}
+
+func (t Tree) Set(name string, v interface{}) {
+	m, key := t.lookup(name, true)
+	m[key] = v
+}
+
+func (t Tree) Delete(name string) {
+	m, key := t.lookup(name, false)
+	delete(m, key)
+}
+
+func (t Tree) Names() []string {
+	var names []string
+	var walk func(prefix string, m map[string]interface{})
+	walk = func(prefix string, m map[string]interface{}) {
+		for k, v := range m {
+			if prefix == "" && k == t.TagsKey {
+				continue
+			}
+			if sub, ok := v.(map[string]interface{}); ok {
+				walk(prefix+k+".", sub)
+				continue
+			}
+			names = append(names, prefix+k)
+		}
+	}
+	walk("", t.Root)
+	sort.Strings(names)
+	return names
+}
+
+func (t Tree) SetTag(key, value string) {
+	tags, ok := t.Root[t.TagsKey].(map[string]interface{})
+	if !ok {
+		tags = make(map[string]interface{})
+		t.Root[t.TagsKey] = tags
+	}
+	tags[key] = value
+}
@@ -0,0 +1,90 @@
+package processor
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var testChain = []Config{
+	{Type: TypeRename, Field: "cpu.percent", To: "cpu.pct"},
+	{Type: TypeScale, Field: "mem.*", Factor: 1.0 / 1024},
+	{Type: TypeDerive, To: "mem.ratio", Op: "/", Fields: []string{"mem.used", "mem.total"}},
+	{Type: TypeFilter, Drop: []string{"debug.*"}},
+	{Type: TypeTag, Tag: "site", Value: "edge"},
+}
+
+func TestFlat(t *testing.T) {
+	chain, err := New(testChain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := Flat{
+		Fields: map[string]interface{}{
+			"cpu.percent": int64(12),
+			"mem.used":    int64(1024),
+			"mem.total":   4096.0,
+			"debug.x":     true,
+		},
+		Tags: map[string]string{"serial": "a"},
+	}
+	chain.Process(r)
+	want := map[string]interface{}{
+		"cpu.pct":   int64(12),
+		"mem.used":  1.0,
+		"mem.total": 4.0,
+		"mem.ratio": 0.25,
+	}
+	if !reflect.DeepEqual(r.Fields, want) {
+		t.Errorf("fields %v, want %v", r.Fields, want)
+	}
+	if r.Tags["site"] != "edge" || r.Tags["serial"] != "a" {
+		t.Errorf("tags %v", r.Tags)
+	}
+}
+
+func TestTree(t *testing.T) {
+	chain, err := New(testChain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var root map[string]interface{}
+	dec := json.NewDecoder(strings.NewReader(`{
+		"cpu": {"percent": 12},
+		"mem": {"used": 1024, "total": 4096},
+		"debug": {"x": [1, 2]},
+		"pressure": {"cgroup.cpu": {"avg10": 1}},
+		"labels": {"team": "core"}
+	}`))
+	dec.UseNumber()
+	if err = dec.Decode(&root); err != nil {
+		t.Fatal(err)
+	}
+	tree := Tree{Root: root, TagsKey: "labels"}
+	chain.Process(tree)
+	b, _ := json.Marshal(root)
+	want := `{"cpu":{"pct":12},"debug":{},"labels":{"site":"edge","team":"core"},"mem":{"ratio":0.25,"total":4,"used":1},"pressure":{"cgroup.cpu":{"avg10":1}}}`
+	if string(b) != want {
+		t.Errorf("got %s, want %s", b, want)
+	}
+	if v, ok := tree.Get("pressure.cgroup.cpu.avg10"); !ok || v != json.Number("1") {
+		t.Errorf("dotted key: %v %v", v, ok)
+	}
+}
+
+func TestInvalid(t *testing.T) {
+	for _, cfg := range []Config{
+		{Type: "nope"},
+		{Type: TypeRename, Field: "a"},
+		{Type: TypeScale, Field: "a"},
+		{Type: TypeDerive, To: "c", Op: "%", Fields: []string{"a", "b"}},
+		{Type: TypeFilter},
+		{Type: TypeFilter, Drop: []string{"["}},
+		{Type: TypeTag},
+	} {
+		if _, err := New([]Config{cfg}); err == nil {
+			t.Errorf("%+v: no error", cfg)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package goruntime
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// archiveRow is a point of the main measurement kept for the archive
+type archiveRow struct {
+	time   time.Time
+	tags   map[string]string
+	values map[string]interface{}
+}
+
+// archive buffers the points by partition, day and serial, and writes a
+// partition to a Parquet file once it has rows points. The files are laid
+// out as <dir>/day=2006-01-02/serial=<serial>/<first point nanos>.parquet,
+// the hive partitioning of Spark and DuckDB.
+type archive struct {
+	dir  string
+	rows int
+
+	mu    sync.Mutex
+	parts map[string][]archiveRow
+}
+
+func (a *archive) add(t time.Time, tags map[string]string, values map[string]interface{}) error {
+	row := archiveRow{time: t, tags: make(map[string]string, len(tags)), values: make(map[string]interface{}, len(values))}
+	for k, v := range tags {
+		row.tags[k] = v
+	}
+	for k, v := range values {
+		row.values[k] = v
+	}
+	part := filepath.Join("day="+t.UTC().Format("2006-01-02"), "serial="+url.PathEscape(tags["serial"]))
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.parts == nil {
+		a.parts = make(map[string][]archiveRow)
+	}
+	a.parts[part] = append(a.parts[part], row)
+	if len(a.parts[part]) < a.rows {
+		return nil
+	}
+	return a.flushLocked(part)
+}
+
+// flush writes every partition
+func (a *archive) flush() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var err error
+	for part := range a.parts {
+		if ferr := a.flushLocked(part); ferr != nil {
+			err = ferr
+		}
+	}
+	return err
+}
+
+// flushLocked writes the partition to a new file, the rows are dropped
+// when the file can't be written so a broken archive doesn't grow the
+// memory
+func (a *archive) flushLocked(part string) error {
+	rows := a.parts[part]
+	delete(a.parts, part)
+	if len(rows) == 0 {
+		return nil
+	}
+	dir := filepath.Join(a.dir, part)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%d.parquet", rows[0].time.UnixNano()))
+	f, err := os.OpenFile(path+".tmp", os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	err = writeParquet(f, rows)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(path+".tmp", path)
+	}
+	if err != nil {
+		os.Remove(path + ".tmp")
+		return fmt.Errorf("archiving %d points to %s: %s", len(rows), path, err)
+	}
+	return nil
+}
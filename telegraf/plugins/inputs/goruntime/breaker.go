@@ -0,0 +1,31 @@
+package goruntime
+
+import "time"
+
+// breaker stops scraping a target after consecutive failures: it opens
+// for a cooldown, then lets one probe through, half open, which closes it
+// on success or opens it again on failure
+type breaker struct {
+	failures int
+	openedAt time.Time
+	open     bool
+}
+
+// allow tells if the target may be scraped
+func (b *breaker) allow(now time.Time, cooldown time.Duration) bool {
+	return !b.open || now.Sub(b.openedAt) >= cooldown
+}
+
+// record counts the result of a scrape, max <= 0 never opens the breaker
+func (b *breaker) record(ok bool, now time.Time, max int) {
+	if ok {
+		b.failures = 0
+		b.open = false
+		return
+	}
+	b.failures++
+	if max > 0 && (b.open || b.failures >= max) {
+		b.open = true
+		b.openedAt = now
+	}
+}
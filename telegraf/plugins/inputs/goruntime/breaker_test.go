@@ -0,0 +1,74 @@
+package goruntime
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	const cooldown = time.Minute
+	// a step records a scrape at the second when ok is set, then checks
+	// if a scrape is allowed
+	type step struct {
+		at    time.Duration
+		ok    *bool
+		allow bool
+	}
+	success, failure := true, false
+	tests := []struct {
+		name  string
+		max   int
+		steps []step
+	}{
+		{"closed below max", 3, []step{
+			{0, &failure, true},
+			{time.Second, &failure, true},
+			{2 * time.Second, &success, true},
+			{3 * time.Second, &failure, true},
+			{4 * time.Second, &failure, true},
+		}},
+		{"opens at max", 2, []step{
+			{0, &failure, true},
+			{time.Second, &failure, false},
+			{30 * time.Second, nil, false},
+		}},
+		{"half open after cooldown", 2, []step{
+			{0, &failure, true},
+			{time.Second, &failure, false},
+			{time.Second + cooldown, nil, true},
+		}},
+		{"probe success closes", 2, []step{
+			{0, &failure, true},
+			{time.Second, &failure, false},
+			{time.Second + cooldown, &success, true},
+			{time.Second + cooldown + time.Second, &failure, true},
+		}},
+		{"probe failure opens for another cooldown", 2, []step{
+			{0, &failure, true},
+			{time.Second, &failure, false},
+			{time.Second + cooldown, &failure, false},
+			{time.Second + 2*cooldown - time.Second, nil, false},
+			{time.Second + 2*cooldown, nil, true},
+		}},
+		{"never opens without max", 0, []step{
+			{0, &failure, true},
+			{time.Second, &failure, true},
+			{2 * time.Second, &failure, true},
+		}},
+	}
+	start := time.Unix(1600000000, 0)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b breaker
+			for i, s := range tt.steps {
+				now := start.Add(s.at)
+				if s.ok != nil {
+					b.record(*s.ok, now, tt.max)
+				}
+				if got := b.allow(now, cooldown); got != s.allow {
+					t.Errorf("step %d: allow = %v, want %v", i+1, got, s.allow)
+				}
+			}
+		})
+	}
+}
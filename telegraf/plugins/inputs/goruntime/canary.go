@@ -0,0 +1,234 @@
+package goruntime
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+)
+
+// canaryMaxSamples is how many samples of a field of a version are kept
+// over the window, the oldest dropped beyond
+const canaryMaxSamples = 10000
+
+// canary compares the agents of a canary version to the ones of the
+// baseline version, by the values of their tag, over a sliding window of
+// their samples: the means and p95 of the fields and their deltas, and
+// the p-value of the Mann-Whitney U test of the two. Without a baseline
+// the version of the most agents is the baseline, without a canary all
+// the other versions are, so a deploy needs no config change.
+type canary struct {
+	tag      string
+	baseline string
+	version  string
+	fields   []string
+	window   time.Duration
+	alpha    float64
+
+	mu sync.Mutex
+	// by version
+	samples map[string]map[string][]canarySample
+	agents  map[string]map[string]time.Time
+}
+
+type canarySample struct {
+	at time.Time
+	v  float64
+}
+
+func newCanary(tag, baseline, version string, fields []string, window time.Duration, alpha float64) *canary {
+	return &canary{
+		tag:      tag,
+		baseline: baseline,
+		version:  version,
+		fields:   fields,
+		window:   window,
+		alpha:    alpha,
+		samples:  make(map[string]map[string][]canarySample),
+		agents:   make(map[string]map[string]time.Time),
+	}
+}
+
+// add records the point of the agent of the serial tag
+func (c *canary) add(tags map[string]string, values map[string]interface{}) {
+	serial, version := tags["serial"], tags[c.tag]
+	if serial == "" || serial == invalidSerial || version == "" {
+		return
+	}
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.agents[version] == nil {
+		c.agents[version] = make(map[string]time.Time)
+		c.samples[version] = make(map[string][]canarySample)
+	}
+	c.agents[version][serial] = now
+	for _, k := range c.fields {
+		if v, ok := toFloat(values[k]); ok {
+			s := append(c.samples[version][k], canarySample{now, v})
+			if len(s) > canaryMaxSamples {
+				s = s[len(s)-canaryMaxSamples:]
+			}
+			c.samples[version][k] = s
+		}
+	}
+}
+
+// report emits the comparison into <measurement>_canary, tagged with the
+// baseline and canary versions, "*" for all the others
+func (c *canary) report(acc telegraf.Accumulator, measurement string, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.expire(now)
+
+	baseline := c.baseline
+	if baseline == "" {
+		for v, agents := range c.agents {
+			if n := len(agents); n > len(c.agents[baseline]) || n == len(c.agents[baseline]) && v < baseline {
+				baseline = v
+			}
+		}
+	}
+	isCanary := func(v string) bool {
+		if c.version != "" {
+			return v == c.version
+		}
+		return v != baseline
+	}
+	var canaryAgents int64
+	for v, agents := range c.agents {
+		if isCanary(v) {
+			canaryAgents += int64(len(agents))
+		}
+	}
+	if baseline == "" || len(c.agents[baseline]) == 0 || canaryAgents == 0 {
+		return
+	}
+
+	fields := map[string]interface{}{
+		"baseline.agents": int64(len(c.agents[baseline])),
+		"canary.agents":   canaryAgents,
+	}
+	regressed := false
+	for _, k := range c.fields {
+		var base, cand []float64
+		for v, samples := range c.samples {
+			for _, s := range samples[k] {
+				if v == baseline {
+					base = append(base, s.v)
+				} else if isCanary(v) {
+					cand = append(cand, s.v)
+				}
+			}
+		}
+		if len(base) == 0 || len(cand) == 0 {
+			continue
+		}
+		sort.Float64s(base)
+		sort.Float64s(cand)
+		bm, cm := mean(base), mean(cand)
+		bp, cp := base[int(0.95*float64(len(base)-1))], cand[int(0.95*float64(len(cand)-1))]
+		fields[k+".baseline_mean"] = bm
+		fields[k+".canary_mean"] = cm
+		fields[k+".baseline_p95"] = bp
+		fields[k+".canary_p95"] = cp
+		if bm != 0 {
+			fields[k+".mean_delta_pct"] = (cm - bm) / math.Abs(bm) * 100
+		}
+		if bp != 0 {
+			fields[k+".p95_delta_pct"] = (cp - bp) / math.Abs(bp) * 100
+		}
+		if p, ok := mannWhitney(base, cand); ok {
+			fields[k+".p_value"] = p
+			// the fields compared are better lower
+			r := p < c.alpha && median(cand) > median(base)
+			fields[k+".regressed"] = r
+			regressed = regressed || r
+		}
+	}
+	fields["regressed"] = regressed
+	version := c.version
+	if version == "" {
+		version = "*"
+	}
+	acc.AddFields(measurement+"_canary", fields, map[string]string{"baseline": baseline, "canary": version}, now)
+}
+
+// expire drops the samples and agents older than the window
+func (c *canary) expire(now time.Time) {
+	for version, agents := range c.agents {
+		for serial, at := range agents {
+			if now.Sub(at) > c.window {
+				delete(agents, serial)
+			}
+		}
+		if len(agents) == 0 {
+			delete(c.agents, version)
+			delete(c.samples, version)
+			continue
+		}
+		for k, s := range c.samples[version] {
+			i := sort.Search(len(s), func(i int) bool { return now.Sub(s[i].at) <= c.window })
+			c.samples[version][k] = s[i:]
+		}
+	}
+}
+
+func mean(vs []float64) float64 {
+	var sum float64
+	for _, v := range vs {
+		sum += v
+	}
+	return sum / float64(len(vs))
+}
+
+// mannWhitney returns the two-sided p-value of the Mann-Whitney U test of
+// a and b, by the normal approximation with the tie correction, not
+// reliable under 8 samples each
+func mannWhitney(a, b []float64) (float64, bool) {
+	n1, n2 := float64(len(a)), float64(len(b))
+	if len(a) < 8 || len(b) < 8 {
+		return 0, false
+	}
+	type ranked struct {
+		v     float64
+		first bool
+	}
+	all := make([]ranked, 0, len(a)+len(b))
+	for _, v := range a {
+		all = append(all, ranked{v, true})
+	}
+	for _, v := range b {
+		all = append(all, ranked{v, false})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].v < all[j].v })
+
+	var r1, ties float64
+	for i := 0; i < len(all); {
+		j := i
+		for j < len(all) && all[j].v == all[i].v {
+			j++
+		}
+		// the average rank of the ties, ranks starting at 1
+		rank := float64(i+j+1) / 2
+		for k := i; k < j; k++ {
+			if all[k].first {
+				r1 += rank
+			}
+		}
+		t := float64(j - i)
+		ties += t*t*t - t
+		i = j
+	}
+	n := n1 + n2
+	u := r1 - n1*(n1+1)/2
+	mu := n1 * n2 / 2
+	sigma := math.Sqrt(n1 * n2 / 12 * ((n + 1) - ties/(n*(n-1))))
+	if sigma == 0 {
+		return 1, true
+	}
+	z := math.Max(math.Abs(u-mu)-0.5, 0) / sigma
+	return math.Erfc(z / math.Sqrt2), true
+}
@@ -0,0 +1,112 @@
+package goruntime
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+)
+
+// the actions on a tag value beyond the limit of its key
+const (
+	tagLimitHash = "hash"
+	tagLimitDrop = "drop"
+)
+
+// cardinalityGuard limits the distinct values of tag keys. The values
+// seen first are kept, the later ones are replaced by one of buckets
+// hashed values, e.g. "overflow-17", or their points dropped. The values
+// seen are forgotten every window, so the values of a normal churn, e.g.
+// of pods, don't add up.
+type cardinalityGuard struct {
+	limits  map[string]int
+	action  string
+	buckets int
+	window  time.Duration
+
+	mu       sync.Mutex
+	since    time.Time
+	seen     map[string]map[string]bool
+	overflow map[string]int64
+}
+
+func newCardinalityGuard(limits map[string]int, action string, buckets int, window time.Duration) (*cardinalityGuard, error) {
+	for k, n := range limits {
+		if n < 1 {
+			return nil, fmt.Errorf("invalid tag_limits %q = %d: must be positive", k, n)
+		}
+	}
+	switch action {
+	case tagLimitHash:
+		if buckets < 1 {
+			return nil, fmt.Errorf("invalid tag_limit_buckets %d: must be positive", buckets)
+		}
+	case tagLimitDrop:
+	default:
+		return nil, fmt.Errorf("invalid tag_limit_action %q: must be %q or %q", action, tagLimitHash, tagLimitDrop)
+	}
+	if window <= 0 {
+		return nil, fmt.Errorf("invalid tag_limit_window %s: must be positive", window)
+	}
+	return &cardinalityGuard{
+		limits:   limits,
+		action:   action,
+		buckets:  buckets,
+		window:   window,
+		seen:     make(map[string]map[string]bool),
+		overflow: make(map[string]int64),
+	}, nil
+}
+
+// check applies the limits to the tags, replacing the values beyond the
+// limits, and tells if the point is kept
+func (g *cardinalityGuard) check(tags map[string]string, now time.Time) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if now.Sub(g.since) >= g.window {
+		g.seen = make(map[string]map[string]bool)
+		g.since = now
+	}
+	for k, limit := range g.limits {
+		v, ok := tags[k]
+		if !ok {
+			continue
+		}
+		seen := g.seen[k]
+		if seen == nil {
+			seen = make(map[string]bool)
+			g.seen[k] = seen
+		}
+		if seen[v] {
+			continue
+		}
+		if len(seen) < limit {
+			seen[v] = true
+			continue
+		}
+		g.overflow[k]++
+		if g.action == tagLimitDrop {
+			return false
+		}
+		h := fnv.New32a()
+		h.Write([]byte(v))
+		tags[k] = fmt.Sprintf("overflow-%d", h.Sum32()%uint32(g.buckets))
+	}
+	return true
+}
+
+// report emits per limited key the distinct values seen in the window
+// and the values hashed or dropped since the start
+func (g *cardinalityGuard) report(acc telegraf.Accumulator, measurement string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for k, limit := range g.limits {
+		acc.AddFields(measurement+"_cardinality", map[string]interface{}{
+			"values":   int64(len(g.seen[k])),
+			"limit":    int64(limit),
+			"overflow": g.overflow[k],
+		}, map[string]string{"key": k, "action": g.action})
+	}
+}
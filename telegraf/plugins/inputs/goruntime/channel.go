@@ -0,0 +1,170 @@
+package goruntime
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jursonmo/gomonitor/model"
+	"github.com/jursonmo/gomonitor/websocket"
+)
+
+// channelIdle is how long a channel may stay silent, the agents send
+// their runtime data every few seconds
+const channelIdle = 5 * time.Minute
+
+// channel is the WebSocket connection an agent keeps to the listener
+type channel struct {
+	conn   *websocket.Conn
+	serial string
+
+	mu      sync.Mutex
+	pending map[string]chan model.ChannelMessage
+}
+
+var commandID int64
+
+// serveChannel receives the runtime data of the channel of an agent and
+// the results of the commands sent over it, until it breaks
+func (c *GoRuntime) serveChannel(w http.ResponseWriter, req *http.Request) {
+	conn, err := websocket.Accept(w, req)
+	if err != nil {
+		c.Log.Debugf("[channel=%s] %s", req.RemoteAddr, err)
+		return
+	}
+	conn.ReadLimit = c.ListenMaxBody
+	ch := &channel{conn: conn, pending: make(map[string]chan model.ChannelMessage)}
+	defer func() {
+		conn.Close()
+		c.listener.channelsMu.Lock()
+		if c.listener.channels[ch.serial] == ch {
+			delete(c.listener.channels, ch.serial)
+		}
+		c.listener.channelsMu.Unlock()
+	}()
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(channelIdle))
+		b, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var m model.ChannelMessage
+		if err = json.Unmarshal(b, &m); err != nil {
+			c.Log.Debugf("[channel=%s] %s", req.RemoteAddr, err)
+			continue
+		}
+		switch m.Type {
+		case model.ChannelHello:
+			if ch.serial != "" || m.Serial == "" {
+				continue
+			}
+			ch.serial = m.Serial
+			c.listener.channelsMu.Lock()
+			if c.listener.channels == nil {
+				c.listener.channels = make(map[string]*channel)
+			}
+			// a reconnecting agent replaces its broken channel
+			c.listener.channels[ch.serial] = ch
+			cfg, ok := c.listener.configs[ch.serial]
+			if !ok {
+				cfg, ok = c.listener.configs["*"]
+			}
+			c.listener.channelsMu.Unlock()
+			c.Log.Debugf("[channel=%s] serial %s connected with config version %d", req.RemoteAddr, ch.serial, m.Version)
+			if ok && cfg.Version != m.Version {
+				go c.sendConfig(ch, cfg)
+			}
+		case model.ChannelData:
+			c.receivePayload(req.RemoteAddr, m.Signature, m.ContentType, m.Payload)
+		case model.ChannelResult:
+			ch.mu.Lock()
+			if res, ok := ch.pending[m.ID]; ok {
+				res <- m
+				delete(ch.pending, m.ID)
+			}
+			ch.mu.Unlock()
+		}
+	}
+}
+
+// command sends the action of POST /control/<serial>/<action>, with the
+// form values as args, over the channel of the agent and answers its
+// result
+func (c *GoRuntime) command(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	parts := strings.SplitN(strings.TrimPrefix(req.URL.Path, "/control/"), "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		http.Error(w, "the path must be /control/<serial>/<action>", http.StatusNotFound)
+		return
+	}
+	c.listener.channelsMu.Lock()
+	ch := c.listener.channels[parts[0]]
+	c.listener.channelsMu.Unlock()
+	if ch == nil {
+		http.Error(w, fmt.Sprintf("no channel of serial %q", parts[0]), http.StatusNotFound)
+		return
+	}
+
+	req.ParseForm()
+	m := model.ChannelMessage{
+		Type:   model.ChannelCommand,
+		ID:     strconv.FormatInt(atomic.AddInt64(&commandID, 1), 10),
+		Action: parts[1],
+		Args:   make(map[string]string),
+	}
+	for k := range req.Form {
+		m.Args[k] = req.Form.Get(k)
+	}
+	res, err := ch.send(m, c.Timeout.Duration)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	c.Log.Infof("[channel=%s] %s by %s: %s", ch.serial, m.Action, req.RemoteAddr, res.Result)
+	if !res.OK {
+		http.Error(w, res.Result, http.StatusBadRequest)
+		return
+	}
+	fmt.Fprintln(w, res.Result)
+}
+
+// send sends the command and waits for its result
+func (ch *channel) send(m model.ChannelMessage, timeout time.Duration) (model.ChannelMessage, error) {
+	res := make(chan model.ChannelMessage, 1)
+	ch.mu.Lock()
+	ch.pending[m.ID] = res
+	ch.mu.Unlock()
+	defer func() {
+		ch.mu.Lock()
+		delete(ch.pending, m.ID)
+		ch.mu.Unlock()
+	}()
+
+	b, err := json.Marshal(m)
+	if err != nil {
+		return model.ChannelMessage{}, err
+	}
+	if err = ch.conn.WriteMessage(b); err != nil {
+		return model.ChannelMessage{}, err
+	}
+	select {
+	case r := <-res:
+		return r, nil
+	case <-time.After(timeout):
+		what := m.Action
+		if what == "" {
+			what = m.Type
+		}
+		return model.ChannelMessage{}, fmt.Errorf("no result of %s within %s", what, timeout)
+	}
+}
@@ -0,0 +1,122 @@
+package goruntime
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	dualStack  = "dual_stack"
+	preferIPv4 = "prefer_ipv4"
+	preferIPv6 = "prefer_ipv6"
+)
+
+type cachedAddrs struct {
+	ips     []net.IP
+	expires time.Time
+}
+
+// dialer resolves through an optional custom nameserver and cache, and
+// orders the addresses by the configured ip preference
+type dialer struct {
+	net.Dialer
+	preference string
+	cacheTTL   time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cachedAddrs
+}
+
+func newDialer(preference, dnsServer string, cacheTTL, timeout time.Duration) (*dialer, error) {
+	switch preference {
+	case "", dualStack, preferIPv4, preferIPv6:
+	default:
+		return nil, fmt.Errorf("invalid ip_preference %q", preference)
+	}
+
+	d := &dialer{
+		Dialer:     net.Dialer{Timeout: timeout},
+		preference: preference,
+		cacheTTL:   cacheTTL,
+		cache:      make(map[string]cachedAddrs),
+	}
+	if dnsServer != "" {
+		if _, _, err := net.SplitHostPort(dnsServer); err != nil {
+			return nil, fmt.Errorf("invalid dns_server %q: %s", dnsServer, err)
+		}
+		var nd net.Dialer
+		d.Resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return nd.DialContext(ctx, network, dnsServer)
+			},
+		}
+	}
+	return d, nil
+}
+
+func (d *dialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	// the default dialer already races ipv4 and ipv6 (happy eyeballs)
+	if net.ParseIP(host) != nil || (d.preference == "" || d.preference == dualStack) && d.cacheTTL <= 0 {
+		return d.Dialer.DialContext(ctx, network, addr)
+	}
+
+	ips, err := d.lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	var firstErr error
+	for _, ip := range ips {
+		conn, err := d.Dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return nil, firstErr
+}
+
+func (d *dialer) lookup(ctx context.Context, host string) ([]net.IP, error) {
+	d.mu.Lock()
+	c, ok := d.cache[host]
+	d.mu.Unlock()
+	if ok && time.Now().Before(c.expires) {
+		return c.ips, nil
+	}
+
+	resolver := d.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	addrs, err := resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	ips := make([]net.IP, len(addrs))
+	for i, a := range addrs {
+		ips[i] = a.IP
+	}
+	if d.preference != "" && d.preference != dualStack {
+		v4First := d.preference == preferIPv4
+		sort.SliceStable(ips, func(i, j int) bool {
+			return (ips[i].To4() != nil) == v4First && (ips[j].To4() != nil) != v4First
+		})
+	}
+
+	if d.cacheTTL > 0 {
+		d.mu.Lock()
+		d.cache[host] = cachedAddrs{ips: ips, expires: time.Now().Add(d.cacheTTL)}
+		d.mu.Unlock()
+	}
+	return ips, nil
+}
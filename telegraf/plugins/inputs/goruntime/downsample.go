@@ -0,0 +1,152 @@
+package goruntime
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+)
+
+// downsampler aggregates the numeric fields of the points of every
+// series into windows, emitted with the min, max and mean of each field
+// as <measurement>_<window>, e.g. goruntime_m_5m, at the start of the
+// window. Every window is aggregated from the raw points.
+type downsampler struct {
+	windows []downsampleWindow
+
+	mu     sync.Mutex
+	series map[string]*downsampleSeries
+}
+
+type downsampleWindow struct {
+	name string
+	d    time.Duration
+}
+
+type downsampleSeries struct {
+	window downsampleWindow
+	start  time.Time
+	tags   map[string]string
+	stats  map[string]*downsampleStat
+}
+
+type downsampleStat struct {
+	min, max, sum float64
+	n             int64
+}
+
+// newDownsampler parses the windows, e.g. ["1m", "5m"]
+func newDownsampler(windows []string) (*downsampler, error) {
+	ds := &downsampler{series: make(map[string]*downsampleSeries)}
+	for _, w := range windows {
+		d, err := time.ParseDuration(w)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid downsample window %q: must be a positive duration", w)
+		}
+		ds.windows = append(ds.windows, downsampleWindow{name: w, d: d})
+	}
+	return ds, nil
+}
+
+// add aggregates the point, emitting the windows of its series it closes
+func (ds *downsampler) add(acc telegraf.Accumulator, measurement string, t time.Time, tags map[string]string, values map[string]interface{}) {
+	key := seriesKey(tags)
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	for _, w := range ds.windows {
+		start := t.Truncate(w.d)
+		s := ds.series[w.name+"|"+key]
+		if s != nil && !s.start.Equal(start) {
+			s.emit(acc, measurement)
+			s = nil
+		}
+		if s == nil {
+			s = &downsampleSeries{window: w, start: start, tags: copyTags(tags), stats: make(map[string]*downsampleStat)}
+			ds.series[w.name+"|"+key] = s
+		}
+		for k, v := range values {
+			f, ok := toFloat(v)
+			if !ok {
+				continue
+			}
+			st := s.stats[k]
+			if st == nil {
+				st = &downsampleStat{min: math.Inf(1), max: math.Inf(-1)}
+				s.stats[k] = st
+			}
+			st.min = math.Min(st.min, f)
+			st.max = math.Max(st.max, f)
+			st.sum += f
+			st.n++
+		}
+	}
+}
+
+// flush emits the windows ended before now, of series which stopped
+// reporting
+func (ds *downsampler) flush(acc telegraf.Accumulator, measurement string, now time.Time) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	for k, s := range ds.series {
+		if !s.start.Add(s.window.d).After(now) {
+			s.emit(acc, measurement)
+			delete(ds.series, k)
+		}
+	}
+}
+
+func (s *downsampleSeries) emit(acc telegraf.Accumulator, measurement string) {
+	if len(s.stats) == 0 {
+		return
+	}
+	fields := make(map[string]interface{}, len(s.stats)*3)
+	for k, st := range s.stats {
+		fields[k+"_min"] = st.min
+		fields[k+"_max"] = st.max
+		fields[k+"_mean"] = st.sum / float64(st.n)
+	}
+	acc.AddFields(measurement+"_"+s.window.name, fields, s.tags, s.start)
+}
+
+// seriesKey identifies the series of the tags
+func seriesKey(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString(k + "=" + tags[k] + ",")
+	}
+	return b.String()
+}
+
+func copyTags(tags map[string]string) map[string]string {
+	c := make(map[string]string, len(tags))
+	for k, v := range tags {
+		c[k] = v
+	}
+	return c
+}
+
+// toFloat returns the numeric values as float, booleans and strings are
+// not aggregated
+func toFloat(v interface{}) (float64, bool) {
+	switch x := v.(type) {
+	case int64:
+		return float64(x), true
+	case int:
+		return float64(x), true
+	case uint64:
+		return float64(x), true
+	case float64:
+		return x, true
+	}
+	return 0, false
+}
@@ -0,0 +1,208 @@
+package goruntime
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// enricher caches the metadata of the serials, looked up from the enrich
+// url or read from the enrich file
+type enricher struct {
+	mu sync.Mutex
+	// by serial, from the url
+	entries map[string]enrichment
+
+	// the rows of the file by serial, read again when it changed, checked
+	// every ttl
+	rows      map[string]map[string]string
+	modTime   time.Time
+	checkedAt time.Time
+}
+
+type enrichment struct {
+	tags map[string]string
+	at   time.Time
+}
+
+// enrich adds the metadata of the serial to the tags, the tags set
+// already are kept
+func (c *GoRuntime) enrich(serial string, tags map[string]string) {
+	if serial == "" || c.EnrichURL == "" && c.EnrichFile == "" {
+		return
+	}
+	var meta map[string]string
+	var err error
+	if c.EnrichFile != "" {
+		meta, err = c.enrichFromFile(serial)
+	} else {
+		meta, err = c.enrichFromURL(serial)
+	}
+	if err != nil {
+		c.Log.Warnf("[serial=%s] enrich: %s", serial, err)
+	}
+	for k, v := range meta {
+		if _, ok := tags[k]; !ok && v != "" && c.enrichTag(k) {
+			tags[k] = v
+		}
+	}
+}
+
+func (c *GoRuntime) enrichTag(k string) bool {
+	if len(c.EnrichTags) == 0 {
+		return true
+	}
+	for _, t := range c.EnrichTags {
+		if t == k {
+			return true
+		}
+	}
+	return false
+}
+
+// enrichFromURL returns the cached metadata of the serial, looked up again
+// after the ttl. When the lookup fails the metadata cached before is kept
+// until the next one.
+func (c *GoRuntime) enrichFromURL(serial string) (map[string]string, error) {
+	e := &c.enricher
+	e.mu.Lock()
+	cached, ok := e.entries[serial]
+	e.mu.Unlock()
+	if ok && time.Since(cached.at) < c.EnrichTTL.Duration {
+		return cached.tags, nil
+	}
+
+	// the lock is not held during the lookup, a serial looked up twice at
+	// once is harmless
+	tags, err := c.lookupMetadata(serial)
+	if err != nil {
+		tags = cached.tags
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.entries == nil {
+		e.entries = make(map[string]enrichment)
+	}
+	e.entries[serial] = enrichment{tags: tags, at: time.Now()}
+	return tags, err
+}
+
+// lookupMetadata gets the JSON object of the serial from the enrich url,
+// its strings, numbers and booleans are the metadata. Not found is no
+// metadata.
+func (c *GoRuntime) lookupMetadata(serial string) (map[string]string, error) {
+	u := strings.Replace(c.EnrichURL, "{serial}", url.PathEscape(serial), -1)
+	req, err := http.NewRequestWithContext(c.requestContext(), http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.EnrichToken != "" {
+		token, err := c.secret(c.EnrichToken)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	client := http.Client{Timeout: c.Timeout.Duration}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("%s: status code %d", u, resp.StatusCode)
+	}
+	var obj map[string]interface{}
+	if err = json.NewDecoder(resp.Body).Decode(&obj); err != nil {
+		return nil, fmt.Errorf("%s: %s", u, err)
+	}
+	tags := make(map[string]string, len(obj))
+	for k, v := range obj {
+		switch v := v.(type) {
+		case string:
+			tags[k] = v
+		case float64, bool:
+			tags[k] = fmt.Sprint(v)
+		}
+	}
+	return tags, nil
+}
+
+// enrichFromFile returns the row of the serial in the enrich file, a CSV
+// file with a header whose serial column is the serial and the other
+// columns the metadata
+func (c *GoRuntime) enrichFromFile(serial string) (map[string]string, error) {
+	e := &c.enricher
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var err error
+	if e.rows == nil || time.Since(e.checkedAt) >= c.EnrichTTL.Duration {
+		e.checkedAt = time.Now()
+		err = e.readFile(c.EnrichFile)
+	}
+	return e.rows[serial], err
+}
+
+// readFile reads the file when it changed, an invalid file keeps the rows
+// read before
+func (e *enricher) readFile(path string) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if e.rows != nil && fi.ModTime().Equal(e.modTime) {
+		return nil
+	}
+	rows, err := readEnrichFile(path)
+	if err != nil {
+		return err
+	}
+	e.rows, e.modTime = rows, fi.ModTime()
+	return nil
+}
+
+func readEnrichFile(path string) (map[string]map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("%s: no header", path)
+	}
+	header, key := records[0], -1
+	for i, h := range header {
+		if strings.TrimSpace(h) == "serial" {
+			key = i
+		}
+	}
+	if key < 0 {
+		return nil, fmt.Errorf("%s: no serial column", path)
+	}
+	rows := make(map[string]map[string]string, len(records)-1)
+	for _, r := range records[1:] {
+		row := make(map[string]string, len(header)-1)
+		for i, v := range r {
+			if i != key {
+				row[strings.TrimSpace(header[i])] = strings.TrimSpace(v)
+			}
+		}
+		rows[strings.TrimSpace(r[key])] = row
+	}
+	return rows, nil
+}
@@ -0,0 +1,55 @@
+package goruntime
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// kinds of scrape failures, emitted as the "scrape.failure" field
+const (
+	failureRequest   = "request"
+	failureStatus    = "status"
+	failureEmpty     = "empty"
+	failureHTML      = "html"
+	failureNotJSON   = "not_json"
+	failureDecode    = "decode"
+	failureSchema    = "schema"
+	failureSerial    = "serial"
+	failureDecrypt   = "decrypt"
+	failureSignature = "signature"
+	failureReplay    = "replay"
+	failureQuality   = "data_quality"
+)
+
+type scrapeError struct {
+	Kind string
+	Err  error
+}
+
+func (e *scrapeError) Error() string {
+	return e.Kind + ": " + e.Err.Error()
+}
+
+// checkPayload looks at the start of the body to tell a proxy error page,
+// login redirect or other non JSON answer apart from a broken payload
+func checkPayload(contentType string, body []byte) error {
+	head := bytes.TrimLeft(body, " \t\r\n")
+	if len(head) == 0 {
+		return &scrapeError{failureEmpty, fmt.Errorf("empty body, content-type %q", contentType)}
+	}
+
+	switch head[0] {
+	case '{', '[':
+		return nil
+	case '<':
+		return &scrapeError{failureHTML, fmt.Errorf("html or xml body, content-type %q: %q", contentType, snippet(head))}
+	}
+	return &scrapeError{failureNotJSON, fmt.Errorf("non json body, content-type %q: %q", contentType, snippet(head))}
+}
+
+func snippet(b []byte) []byte {
+	if len(b) > 64 {
+		return b[:64]
+	}
+	return b
+}
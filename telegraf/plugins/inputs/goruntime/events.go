@@ -0,0 +1,100 @@
+package goruntime
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/jursonmo/gomonitor/model"
+)
+
+// Event is something done to the app, e.g. a control action
+type Event = model.Event
+
+// addEvents emits the events newer than the ones already emitted, at the
+// time they happened
+func (c *GoRuntime) addEvents(acc telegraf.Accumulator, st *appState, events []Event, tags map[string]string) {
+	last := st.lastEvent
+	for _, e := range events {
+		if e.Time <= st.lastEvent {
+			continue
+		}
+		acc.AddFields(c.measurement()+"_events", map[string]interface{}{
+			"who":    e.Who,
+			"action": e.Action,
+			"result": e.Result,
+			"ok":     e.OK,
+		}, tags, time.Unix(0, e.Time))
+		if e.Time > last {
+			last = e.Time
+		}
+	}
+	st.lastEvent = last
+}
+
+// addGCEvents emits the gc cycles newer than the ones already emitted, at
+// the end of their pause
+func (c *GoRuntime) addGCEvents(acc telegraf.Accumulator, st *appState, events []model.GCEvent, tags map[string]string) {
+	last := st.lastGCCycle
+	for _, e := range events {
+		if e.Cycle <= st.lastGCCycle {
+			continue
+		}
+		fields := map[string]interface{}{
+			"cycle":    e.Cycle,
+			"pause_ns": e.PauseNs,
+		}
+		if e.HeapGoal != 0 || e.HeapAfter != 0 {
+			fields["heap_goal"] = e.HeapGoal
+			fields["heap_after"] = e.HeapAfter
+			fields["forced"] = e.Forced
+		}
+		acc.AddFields(c.measurement()+"_gc_events", fields, tags, time.Unix(0, e.End))
+		if e.Cycle > last {
+			last = e.Cycle
+		}
+	}
+	st.lastGCCycle = last
+}
+
+// addThreads emits the CPU time of the busiest threads reported by the
+// agent, tagged by thread
+func (c *GoRuntime) addThreads(acc telegraf.Accumulator, threads []model.Thread, tags map[string]string, ts ...time.Time) {
+	for _, th := range threads {
+		t := make(map[string]string, len(tags)+2)
+		for k, v := range tags {
+			t[k] = v
+		}
+		t["tid"] = strconv.Itoa(th.TID)
+		t["thread"] = th.Name
+		acc.AddCounter(c.measurement()+"_threads", map[string]interface{}{"cpu_ns": th.CPUNs}, t, ts...)
+	}
+}
+
+// addAllocSites emits the allocation rates of the functions allocating the
+// most, tagged by function
+func (c *GoRuntime) addAllocSites(acc telegraf.Accumulator, sites []model.AllocSite, tags map[string]string, ts ...time.Time) {
+	for _, s := range sites {
+		t := make(map[string]string, len(tags)+1)
+		for k, v := range tags {
+			t[k] = v
+		}
+		t["function"] = s.Function
+		acc.AddGauge(c.measurement()+"_alloc_sites", map[string]interface{}{
+			"bytes_per_sec":   s.BytesPerSec,
+			"objects_per_sec": s.ObjectsPerSec,
+		}, t, ts...)
+	}
+}
+
+// addNUMA emits the memory of the app per NUMA node, tagged by node
+func (c *GoRuntime) addNUMA(acc telegraf.Accumulator, nodes map[string]int64, tags map[string]string, ts ...time.Time) {
+	for node, bytes := range nodes {
+		t := make(map[string]string, len(tags)+1)
+		for k, v := range tags {
+			t[k] = v
+		}
+		t["node"] = node
+		acc.AddGauge(c.measurement()+"_numa", map[string]interface{}{"bytes": bytes}, t, ts...)
+	}
+}
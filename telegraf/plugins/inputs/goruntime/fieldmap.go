@@ -0,0 +1,70 @@
+package goruntime
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// remap moves the values of the payload from the keys of the app to the
+// keys of RuntimeData, as given by field_map, before the payload is
+// decoded. Both are dotted paths, e.g. "memstats.HeapAlloc" = "heap_bytes".
+func (c *GoRuntime) remap(body []byte) ([]byte, error) {
+	if len(c.FieldMap) == 0 {
+		return body, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	switch v := v.(type) {
+	case []interface{}:
+		for _, e := range v {
+			if m, ok := e.(map[string]interface{}); ok {
+				c.remapObject(m)
+			}
+		}
+	case map[string]interface{}:
+		c.remapObject(v)
+	}
+	return json.Marshal(v)
+}
+
+func (c *GoRuntime) remapObject(m map[string]interface{}) {
+	for to, from := range c.FieldMap {
+		if v, ok := take(m, strings.Split(from, ".")); ok {
+			put(m, strings.Split(to, "."), v)
+		}
+	}
+}
+
+// take removes and returns the value at path
+func take(m map[string]interface{}, path []string) (interface{}, bool) {
+	for _, k := range path[:len(path)-1] {
+		next, ok := m[k].(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		m = next
+	}
+	k := path[len(path)-1]
+	v, ok := m[k]
+	delete(m, k)
+	return v, ok
+}
+
+// put sets the value at path, creating the missing objects
+func put(m map[string]interface{}, path []string, v interface{}) {
+	for _, k := range path[:len(path)-1] {
+		next, ok := m[k].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			m[k] = next
+		}
+		m = next
+	}
+	m[path[len(path)-1]] = v
+}
@@ -0,0 +1,107 @@
+package goruntime
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/influxdata/telegraf"
+)
+
+// addExtraJSON fetches the extra_json_paths of the url and adds their
+// flattened payloads to the extra fields of the scrape, a failing path is
+// reported without failing the scrape
+func (c *GoRuntime) addExtraJSON(acc telegraf.Accumulator, s *scrape) {
+	if len(c.ExtraJSONPaths) == 0 {
+		return
+	}
+	if s.extra == nil {
+		s.extra = make(map[string]interface{})
+	}
+
+	paths := make([]string, 0, len(c.ExtraJSONPaths))
+	for p := range c.ExtraJSONPaths {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		es := &scrape{url: withPath(s.url, p)}
+		body, err := c.fetch(es)
+		if err == nil {
+			err = flatten(s.extra, c.ExtraJSONPaths[p], body)
+		}
+		es.release()
+		if err != nil {
+			acc.AddError(fmt.Errorf("[url=%s]: extra json: %s", es.url, err))
+		}
+	}
+}
+
+// flatten adds the leaves of the JSON document to fields, named by their
+// dotted path under prefix. Numbers written as integers become integers,
+// others floats, so 1.0 stays a float and a field keeps its type across
+// scrapes. Strings holding a JSON number are parsed like numbers, numbers
+// out of the float range are dropped, booleans and other strings are
+// kept, nulls are dropped and array items are named by their index.
+func flatten(fields map[string]interface{}, prefix string, body []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return err
+	}
+	flattenValue(fields, prefix, v)
+	return nil
+}
+
+func flattenValue(fields map[string]interface{}, name string, v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			flattenValue(fields, join(name, k), e)
+		}
+	case []interface{}:
+		for i, e := range v {
+			flattenValue(fields, join(name, strconv.Itoa(i)), e)
+		}
+	case json.Number:
+		if n, ok := number(string(v)); ok {
+			fields[name] = n
+		}
+	case string:
+		if !jsonNumber.MatchString(v) {
+			fields[name] = v
+		} else if n, ok := number(v); ok {
+			fields[name] = n
+		}
+	case bool:
+		fields[name] = v
+	}
+}
+
+// jsonNumber is the syntax of a JSON number, strconv also parses NaN, Inf
+// and hex floats
+var jsonNumber = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][-+]?[0-9]+)?$`)
+
+// number parses a JSON number, false when it is out of the float range
+func number(s string) (interface{}, bool) {
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i, true
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+		return nil, false
+	}
+	return f, true
+}
+
+func join(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
@@ -0,0 +1,134 @@
+package goruntime
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+)
+
+// fleet summarizes the agents which reported over every window into
+// <measurement>_fleet, timestamped at the start of the window: how many
+// agents, how many by version, the percentiles of fields across them
+// and how many breach the thresholds. The last value of an agent in the
+// window is the one summarized.
+type fleet struct {
+	every      time.Duration
+	versionTag string
+	fields     []string
+	thresholds map[string]float64
+
+	mu     sync.Mutex
+	start  time.Time
+	agents map[string]*fleetAgent
+}
+
+type fleetAgent struct {
+	version string
+	values  map[string]float64
+}
+
+func newFleet(every time.Duration, versionTag string, fields []string, thresholds map[string]float64) *fleet {
+	return &fleet{
+		every:      every,
+		versionTag: versionTag,
+		fields:     fields,
+		thresholds: thresholds,
+		agents:     make(map[string]*fleetAgent),
+	}
+}
+
+// add records the point of the agent of the serial tag
+func (f *fleet) add(tags map[string]string, values map[string]interface{}) {
+	serial := tags["serial"]
+	if serial == "" || serial == invalidSerial {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	a := f.agents[serial]
+	if a == nil {
+		a = &fleetAgent{values: make(map[string]float64)}
+		f.agents[serial] = a
+	}
+	if v, ok := tags[f.versionTag]; ok {
+		a.version = v
+	}
+	for _, k := range f.fields {
+		if v, ok := toFloat(values[k]); ok {
+			a.values[k] = v
+		}
+	}
+	for k := range f.thresholds {
+		if v, ok := toFloat(values[k]); ok {
+			a.values[k] = v
+		}
+	}
+}
+
+// report emits the summary of the window when it ended before now, even
+// when no agent reported
+func (f *fleet) report(acc telegraf.Accumulator, measurement string, now time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.start.IsZero() {
+		f.start = now.Truncate(f.every)
+	}
+	if now.Before(f.start.Add(f.every)) {
+		return
+	}
+
+	fields := map[string]interface{}{"agents": int64(len(f.agents))}
+	versions := make(map[string]int64)
+	for _, a := range f.agents {
+		v := a.version
+		if v == "" {
+			v = "unknown"
+		}
+		versions[v]++
+	}
+	for _, k := range f.fields {
+		var vs []float64
+		for _, a := range f.agents {
+			if v, ok := a.values[k]; ok {
+				vs = append(vs, v)
+			}
+		}
+		if len(vs) == 0 {
+			continue
+		}
+		sort.Float64s(vs)
+		percentile := func(q float64) float64 { return vs[int(q*float64(len(vs)-1))] }
+		fields[k+".p50"] = percentile(0.5)
+		fields[k+".p95"] = percentile(0.95)
+		fields[k+".max"] = vs[len(vs)-1]
+	}
+	if len(f.thresholds) > 0 {
+		var breaching int64
+		counts := make(map[string]int64, len(f.thresholds))
+		for _, a := range f.agents {
+			breached := false
+			for k, limit := range f.thresholds {
+				if v, ok := a.values[k]; ok && v > limit {
+					counts[k]++
+					breached = true
+				}
+			}
+			if breached {
+				breaching++
+			}
+		}
+		fields["breaching"] = breaching
+		for k := range f.thresholds {
+			fields["breaching."+k] = counts[k]
+		}
+	}
+	acc.AddFields(measurement+"_fleet", fields, nil, f.start)
+	for v, n := range versions {
+		acc.AddFields(measurement+"_fleet", map[string]interface{}{"agents": n}, map[string]string{f.versionTag: v}, f.start)
+	}
+
+	f.start = now.Truncate(f.every)
+	f.agents = make(map[string]*fleetAgent)
+}
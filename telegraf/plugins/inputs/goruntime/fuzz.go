@@ -0,0 +1,28 @@
+//go:build gofuzz
+// +build gofuzz
+
+package goruntime
+
+import (
+	"github.com/influxdata/telegraf/testutil"
+)
+
+// Fuzz is the go-fuzz entry point of the payload parsing, the corpus is
+// seeded from testdata/fuzz/corpus:
+//
+//	go-fuzz-build -tags gofuzz && go-fuzz -workdir testdata/fuzz
+func Fuzz(data []byte) int {
+	checkPayload("application/json", data)
+	validate(data)
+	flatten(make(map[string]interface{}), "app", data)
+
+	c := &GoRuntime{
+		Log:       testutil.Logger{},
+		FieldMap:  map[string]string{"memstats.HeapAlloc": "heap_bytes", "goroutineNum": "runtime.goroutines"},
+		AgentTime: true,
+	}
+	if err := c.decode(&testutil.Accumulator{}, data, &scrape{url: "http://fuzz/debug/vars"}); err != nil {
+		return 0
+	}
+	return 1
+}
@@ -0,0 +1,198 @@
+package goruntime
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// geoipTTL is how long the addresses of the hosts and the database file
+// are trusted before being resolved or checked again
+const geoipTTL = 10 * time.Minute
+
+// geoipCached is how many addresses the tags are cached for
+const geoipCached = 100000
+
+// defaultGeoIPTags are the tags of the GeoIP2 and GeoLite2 City databases
+var defaultGeoIPTags = map[string]string{
+	"country": "country.iso_code",
+	"region":  "subdivisions.0.iso_code",
+	"city":    "city.names.en",
+}
+
+// geoip tags the points with the location of an address, looked up in a
+// MaxMind DB
+type geoip struct {
+	mu        sync.Mutex
+	db        *mmdb
+	modTime   time.Time
+	checkedAt time.Time
+	// the tags of the addresses, cleared when the database changes
+	tags  map[string]map[string]string
+	hosts map[string]resolved
+}
+
+type resolved struct {
+	ip net.IP
+	at time.Time
+}
+
+// open reads the database when it changed, a database failing to open
+// keeps the one read before
+func (g *geoip) open(path string) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if g.db != nil && fi.ModTime().Equal(g.modTime) {
+		return nil
+	}
+	db, err := openMMDB(path)
+	if err != nil {
+		return fmt.Errorf("%s: %s", path, err)
+	}
+	g.db, g.modTime, g.tags = db, fi.ModTime(), nil
+	return nil
+}
+
+// geoTag adds the location of the address of the point to the tags: the
+// GeoIPField of the point when set, else the host of the url or the
+// address of the agent which pushed it. The tags set already are kept.
+func (c *GoRuntime) geoTag(s *scrape, values map[string]interface{}, tags map[string]string) {
+	if c.GeoIPDB == "" {
+		return
+	}
+	var ip net.IP
+	if c.GeoIPField != "" {
+		v, ok := tags[c.GeoIPField]
+		if !ok {
+			v, _ = values[c.GeoIPField].(string)
+		}
+		if ip = net.ParseIP(v); ip == nil {
+			return
+		}
+	} else {
+		var err error
+		if ip, err = c.scrapeIP(s); err != nil {
+			c.Log.Debugf("[url=%s] geoip: %s", s.url, err)
+			return
+		}
+	}
+	if ip == nil {
+		return
+	}
+
+	g := &c.geoip
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if time.Since(g.checkedAt) >= geoipTTL {
+		g.checkedAt = time.Now()
+		if err := g.open(c.GeoIPDB); err != nil {
+			c.Log.Warnf("geoip_db: %s", err)
+		}
+	}
+	if g.db == nil {
+		return
+	}
+	geo, ok := g.tags[ip.String()]
+	if !ok {
+		record, err := g.db.lookup(ip)
+		if err != nil {
+			c.Log.Warnf("geoip %s: %s", ip, err)
+		}
+		geo = make(map[string]string, len(c.GeoIPTags))
+		for tag, path := range c.GeoIPTags {
+			if v := mmdbPath(record, path); v != "" {
+				geo[tag] = v
+			}
+		}
+		// the addresses of the pushes are not bounded
+		if g.tags == nil || len(g.tags) >= geoipCached {
+			g.tags = make(map[string]map[string]string)
+		}
+		g.tags[ip.String()] = geo
+	}
+	for k, v := range geo {
+		if _, ok := tags[k]; !ok {
+			tags[k] = v
+		}
+	}
+}
+
+// scrapeIP returns the address the payload came from: the host of the url,
+// resolved, or the address of the agent which pushed it
+func (c *GoRuntime) scrapeIP(s *scrape) (net.IP, error) {
+	if s.remote != "" {
+		host, _, err := net.SplitHostPort(s.remote)
+		if err != nil {
+			host = s.remote
+		}
+		return net.ParseIP(host), nil
+	}
+	u, err := url.Parse(s.url)
+	if err != nil || u.Scheme != "http" && u.Scheme != "https" {
+		return nil, nil
+	}
+	host := u.Hostname()
+	if ip := net.ParseIP(host); ip != nil {
+		return ip, nil
+	}
+
+	g := &c.geoip
+	g.mu.Lock()
+	r, ok := g.hosts[host]
+	g.mu.Unlock()
+	if ok && time.Since(r.at) < geoipTTL {
+		return r.ip, nil
+	}
+	ctx, cancel := context.WithTimeout(c.requestContext(), c.Timeout.Duration)
+	defer cancel()
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	r = resolved{at: time.Now()}
+	if len(ips) > 0 {
+		r.ip = ips[0].IP
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.hosts == nil {
+		g.hosts = make(map[string]resolved)
+	}
+	g.hosts[host] = r
+	return r.ip, nil
+}
+
+// mmdbPath returns the value at the dotted path of the record, e.g.
+// subdivisions.0.iso_code, as a string
+func mmdbPath(record interface{}, path string) string {
+	v := record
+	for _, k := range strings.Split(path, ".") {
+		switch e := v.(type) {
+		case map[string]interface{}:
+			v = e[k]
+		case []interface{}:
+			i, err := strconv.Atoi(k)
+			if err != nil || i < 0 || i >= len(e) {
+				return ""
+			}
+			v = e[i]
+		default:
+			return ""
+		}
+	}
+	switch v := v.(type) {
+	case string:
+		return v
+	case uint64, int64, float64, bool:
+		return fmt.Sprint(v)
+	}
+	return ""
+}
@@ -0,0 +1,157 @@
+// Package harness runs the goruntime input against the payloads of the
+// fixture package and compares what it emits with golden files, so a
+// parser change shows as a diff of the golden files.
+package harness
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/plugins/inputs/goruntime"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/jursonmo/gomonitor/fixture"
+	"github.com/jursonmo/gomonitor/model"
+)
+
+// fixtureURL replaces the address of the fixture server in the output
+const fixtureURL = "http://fixture"
+
+// volatile fields depend on when the payload is gathered
+var volatile = map[string]bool{
+	"clock.skew_ms": true,
+}
+
+// Gather runs a new input configured by setup, which may be nil, against
+// the payload and returns the accumulator
+func Gather(name string, setup func(*goruntime.GoRuntime)) (*testutil.Accumulator, error) {
+	srv := fixture.NewServer()
+	defer srv.Close()
+
+	c := &goruntime.GoRuntime{
+		Urls:    []string{srv.URL + "/" + name},
+		Method:  "GET",
+		Timeout: internal.Duration{Duration: 5 * time.Second},
+		Log:     testutil.Logger{Name: "goruntime"},
+	}
+	if setup != nil {
+		setup(c)
+	}
+	if err := c.Init(); err != nil {
+		return nil, err
+	}
+	acc := &testutil.Accumulator{}
+	if err := c.Gather(acc); err != nil {
+		return nil, err
+	}
+	replaceURL(acc, srv.URL)
+	return acc, nil
+}
+
+// Golden gathers every payload and compares the output with the
+// <payload>.golden file of dir, update rewrites the files instead
+func Golden(dir string, update bool) error {
+	var failed []string
+	for _, name := range fixture.Names() {
+		acc, err := Gather(name, nil)
+		if err != nil {
+			return fmt.Errorf("%s: %s", name, err)
+		}
+		got := Render(acc)
+		path := filepath.Join(dir, name+".golden")
+		if update {
+			if err = ioutil.WriteFile(path, got, 0644); err != nil {
+				return err
+			}
+			continue
+		}
+		want, err := ioutil.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if !bytes.Equal(got, want) {
+			failed = append(failed, fmt.Sprintf("%s:\n--- want\n%s--- got\n%s", name, want, got))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("golden mismatch:\n%s", strings.Join(failed, "\n"))
+	}
+	return nil
+}
+
+// Render returns the metrics of the accumulator in line protocol, sorted
+// and without time and volatile fields, followed by the errors
+func Render(acc *testutil.Accumulator) []byte {
+	acc.Lock()
+	defer acc.Unlock()
+
+	var lines []string
+	for _, m := range acc.Metrics {
+		fields := make(map[string]interface{}, len(m.Fields))
+		for k, v := range m.Fields {
+			if !volatile[k] {
+				fields[k] = v
+			}
+		}
+		line := model.LineProtocol(m.Measurement, m.Tags, fields, time.Unix(0, 0))
+		lines = append(lines, strings.TrimSuffix(line, " 0"))
+	}
+	sort.Strings(lines)
+	for _, err := range acc.Errors {
+		lines = append(lines, "E! "+err.Error())
+	}
+
+	var b bytes.Buffer
+	for _, l := range lines {
+		b.WriteString(l + "\n")
+	}
+	return b.Bytes()
+}
+
+// HasFields checks that a metric of the measurement has the fields, with
+// the given values unless nil
+func HasFields(acc *testutil.Accumulator, measurement string, fields map[string]interface{}) error {
+	acc.Lock()
+	defer acc.Unlock()
+
+	var missing string
+	for _, m := range acc.Metrics {
+		if m.Measurement != measurement {
+			continue
+		}
+		missing = ""
+		for k, want := range fields {
+			got, ok := m.Fields[k]
+			if !ok || want != nil && got != want {
+				missing = fmt.Sprintf("field %s = %v (%T), want %v (%T)", k, got, got, want, want)
+				break
+			}
+		}
+		if missing == "" {
+			return nil
+		}
+	}
+	if missing == "" {
+		return fmt.Errorf("no %s metric", measurement)
+	}
+	return fmt.Errorf("%s: %s", measurement, missing)
+}
+
+func replaceURL(acc *testutil.Accumulator, url string) {
+	acc.Lock()
+	defer acc.Unlock()
+	for _, m := range acc.Metrics {
+		for k, v := range m.Tags {
+			m.Tags[k] = strings.Replace(v, url, fixtureURL, -1)
+		}
+	}
+	for i, err := range acc.Errors {
+		acc.Errors[i] = fmt.Errorf("%s", strings.Replace(err.Error(), url, fixtureURL, -1))
+	}
+}
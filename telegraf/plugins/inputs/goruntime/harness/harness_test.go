@@ -0,0 +1,53 @@
+package harness
+
+import (
+	"flag"
+	"testing"
+
+	"github.com/influxdata/telegraf/plugins/inputs/goruntime"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+func TestGolden(t *testing.T) {
+	if err := Golden("testdata", *update); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHasFields(t *testing.T) {
+	acc, err := Gather("runtime_v1.json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := HasFields(acc, "goruntime_m", map[string]interface{}{
+		"cpu.count":  int64(1),
+		"mem.alloc":  nil,
+		"cpu.thread": int64(6),
+	}); err != nil {
+		t.Error(err)
+	}
+	if err := HasFields(acc, "goruntime_m", map[string]interface{}{"cpu.count": int64(2)}); err == nil {
+		t.Error("HasFields accepts a wrong value")
+	}
+}
+
+func TestDerivedFiltered(t *testing.T) {
+	acc, err := Gather("runtime_v1.json", func(c *goruntime.GoRuntime) {
+		c.Fields = []string{"cpu.count"}
+		c.Derived = map[string]string{"alloc_per_cpu": "mem.alloc / cpu.count"}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// mem.alloc is filtered out after alloc_per_cpu is derived from it
+	if err := HasFields(acc, "goruntime_m", map[string]interface{}{
+		"cpu.count":     int64(1),
+		"alloc_per_cpu": nil,
+	}); err != nil {
+		t.Error(err)
+	}
+	if err := HasFields(acc, "goruntime_m", map[string]interface{}{"mem.alloc": nil}); err == nil {
+		t.Error("mem.alloc is not filtered out")
+	}
+}
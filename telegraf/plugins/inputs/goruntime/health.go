@@ -0,0 +1,87 @@
+package goruntime
+
+import "github.com/influxdata/telegraf"
+
+// health of a target, a failure degrades it, DownAfter consecutive
+// failures take it down and only RecoverAfter consecutive successes bring
+// it back to healthy, so a flapping target does not flap between up and
+// down
+type health int
+
+const (
+	healthy health = iota
+	degraded
+	down
+)
+
+func (h health) String() string {
+	switch h {
+	case degraded:
+		return "degraded"
+	case down:
+		return "down"
+	}
+	return "healthy"
+}
+
+type healthState struct {
+	health    health
+	failures  int
+	successes int
+}
+
+func (h *healthState) record(ok bool, downAfter, recoverAfter int) {
+	if ok {
+		h.failures = 0
+		h.successes++
+		if h.successes >= recoverAfter {
+			h.health = healthy
+		} else if h.health == down {
+			h.health = degraded
+		}
+		return
+	}
+	h.successes = 0
+	h.failures++
+	if h.failures >= downAfter {
+		h.health = down
+	} else if h.health == healthy {
+		h.health = degraded
+	}
+}
+
+// addTargetHealth emits the health of every url into the
+// <measurement>_targets measurement, and how many are in each state
+func (c *GoRuntime) addTargetHealth(acc telegraf.Accumulator, urls []string) {
+	var counts [down + 1]int64
+	for _, u := range urls {
+		h := c.targetState(u).health.health
+		counts[h]++
+		acc.AddFields(c.measurement()+"_targets", map[string]interface{}{
+			"health": h.String(),
+		}, map[string]string{"url": u, "health": h.String()})
+	}
+	acc.AddFields(c.measurement()+"_targets", map[string]interface{}{
+		"targets.healthy":  counts[healthy],
+		"targets.degraded": counts[degraded],
+		"targets.down":     counts[down],
+	}, nil)
+}
+
+// heartbeatMeasurement does not follow the measurement, so the absence
+// alerts do not depend on it
+const heartbeatMeasurement = "goruntime_heartbeat"
+
+// addHeartbeat emits the outcome of the scrape of the url into the
+// goruntime_heartbeat measurement. The maintenance is a field, a tag
+// would break the series the alerts watch.
+func (c *GoRuntime) addHeartbeat(acc telegraf.Accumulator, url string, success, maintenance bool) {
+	if !c.Heartbeat {
+		return
+	}
+	fields := map[string]interface{}{"success": success}
+	if maintenance {
+		fields["maintenance"] = true
+	}
+	acc.AddFields(heartbeatMeasurement, fields, map[string]string{"url": url})
+}
@@ -0,0 +1,38 @@
+package goruntime
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHealthHysteresis(t *testing.T) {
+	// the results are + for a success and - for a failure, the states
+	// are the health after each, with down after 3 failures and healthy
+	// after 2 successes
+	tests := []struct {
+		name    string
+		results string
+		states  string
+	}{
+		{"degraded by a failure", "-++", "degraded degraded healthy"},
+		{"down after 3 failures", "---", "degraded degraded down"},
+		{"a success restarts the count to down", "--+--", "degraded degraded degraded degraded degraded"},
+		{"down recovers through degraded", "---++", "degraded degraded down degraded healthy"},
+		{"a failure restarts the count to healthy", "---+-+", "degraded degraded down degraded degraded degraded"},
+		{"flapping stays degraded", "-+-+-+", "degraded degraded degraded degraded degraded degraded"},
+		{"flapping while down", "---+-+-", "degraded degraded down degraded degraded degraded degraded"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var h healthState
+			var got []string
+			for _, r := range tt.results {
+				h.record(r == '+', 3, 2)
+				got = append(got, h.health.String())
+			}
+			if s := strings.Join(got, " "); s != tt.states {
+				t.Errorf("%s: %s, want %s", tt.results, s, tt.states)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package goruntime
+
+import (
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/influxdata/telegraf"
+)
+
+var (
+	defaultGCPauseBuckets        = []float64{0.00001, 0.00005, 0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05}
+	defaultScrapeDurationBuckets = []float64{0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}
+)
+
+// histogram is cumulative over the life of the plugin, like a prometheus
+// histogram, the observations are in seconds
+type histogram struct {
+	bounds []float64
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds))}
+}
+
+func (h *histogram) observe(v float64) {
+	for i, b := range h.bounds {
+		if v <= b {
+			h.counts[i]++
+			break
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+// fields returns the cumulative bucket counts keyed by upper bound plus
+// count and sum, the layout telegraf uses for histogram metrics
+func (h *histogram) fields() map[string]interface{} {
+	fields := make(map[string]interface{}, len(h.bounds)+3)
+	var cum uint64
+	for i, b := range h.bounds {
+		cum += h.counts[i]
+		fields[strconv.FormatFloat(b, 'g', -1, 64)] = cum
+	}
+	fields["+Inf"] = h.count
+	fields["count"] = h.count
+	fields["sum"] = h.sum
+	return fields
+}
+
+// observeGCPauses adds the pauses of the gc cycles since the last gather,
+// the runtime keeps the last 256 only
+func (st *appState) observeGCPauses(m *runtime.MemStats) {
+	last := st.lastNumGC
+	if m.NumGC < last {
+		last = 0
+	}
+	n := m.NumGC - last
+	if n > uint32(len(m.PauseNs)) {
+		n = uint32(len(m.PauseNs))
+	}
+	for i := uint32(0); i < n; i++ {
+		pause := m.PauseNs[(m.NumGC-1-i)%uint32(len(m.PauseNs))]
+		st.gcPause.observe(float64(pause) / 1e9)
+	}
+	st.lastNumGC = m.NumGC
+}
+
+func (c *GoRuntime) addHistograms(acc telegraf.Accumulator, st *appState, rd *RuntimeData, s *scrape, tags map[string]string, t ...time.Time) {
+	if st.gcPause == nil {
+		st.gcPause = newHistogram(c.GCPauseBuckets)
+		st.scrapeDuration = newHistogram(c.ScrapeDurationBuckets)
+	}
+	st.observeGCPauses((*runtime.MemStats)(&rd.Memstats))
+	st.scrapeDuration.observe(s.duration.Seconds())
+
+	acc.AddHistogram(c.measurement()+"_gc_pause_seconds", st.gcPause.fields(), tags, t...)
+	acc.AddHistogram(c.measurement()+"_scrape_duration_seconds", st.scrapeDuration.fields(), tags, t...)
+}
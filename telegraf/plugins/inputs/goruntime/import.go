@@ -0,0 +1,85 @@
+package goruntime
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/influxdata/telegraf"
+)
+
+// importDir emits the payloads saved in the files of ImportDir with
+// their original timestamps, oldest first, and renames each file to
+// .imported, or .failed when it is not runtime data
+func (c *GoRuntime) importDir(acc telegraf.Accumulator) {
+	paths, err := filepath.Glob(filepath.Join(c.ImportDir, "*.json"))
+	if err != nil {
+		acc.AddError(fmt.Errorf("import_dir %q: %s", c.ImportDir, err))
+		return
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if c.requestContext().Err() != nil {
+			return
+		}
+		suffix := ".imported"
+		if err = c.importFile(acc, path); err != nil {
+			acc.AddError(fmt.Errorf("[import=%s]: %s", path, err))
+			suffix = ".failed"
+		}
+		if err = os.Rename(path, path+suffix); err != nil {
+			acc.AddError(fmt.Errorf("[import=%s]: %s", path, err))
+			return
+		}
+	}
+}
+
+// importFile emits the payloads of a file, one or a payload per line as
+// written by the spool of the agent, timestamped with the clock of the
+// agent or else the time in the name of the file, e.g.
+// 1700000000000000000.json, or else its modification time
+func (c *GoRuntime) importFile(acc telegraf.Accumulator, path string) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	body, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	s := &scrape{url: "file://" + filepath.ToSlash(c.ImportDir), at: fi.ModTime(), backfill: true}
+	name := strings.TrimSuffix(filepath.Base(path), ".json")
+	if i := strings.IndexFunc(name, func(r rune) bool { return r < '0' || r > '9' }); i >= 0 {
+		name = name[:i]
+	}
+	if nanos, err := strconv.ParseInt(name, 10, 64); err == nil {
+		s.at = time.Unix(0, nanos)
+	}
+	return c.decodeAll(acc, body, s)
+}
+
+// decodeAll emits the payloads of the body, one or a payload per line
+func (c *GoRuntime) decodeAll(acc telegraf.Accumulator, body []byte, s *scrape) error {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	for {
+		var payload json.RawMessage
+		err := dec.Decode(&payload)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return &scrapeError{failureDecode, err}
+		}
+		if err = c.decode(acc, payload, s); err != nil {
+			return err
+		}
+	}
+}
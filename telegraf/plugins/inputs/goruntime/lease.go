@@ -0,0 +1,89 @@
+package goruntime
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// lease is the content of the lease file: the input gathering until the
+// lease expires
+type lease struct {
+	Owner   string `json:"owner"`
+	Expires int64  `json:"expires"`
+}
+
+// readLease returns the lease in the file, the zero lease when there is
+// none or it is unreadable
+func readLease(path string) lease {
+	var l lease
+	if b, err := ioutil.ReadFile(path); err == nil {
+		json.Unmarshal(b, &l)
+	}
+	return l
+}
+
+// writeLease replaces the lease file atomically
+func writeLease(path string, l lease) error {
+	b, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(b)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// holdLease tells if the input is the active one of the inputs sharing
+// the lease file. The active input renews the lease on every gather, a
+// standby takes it over once it expired; the write is read back, so of
+// standbys taking it over at once only the last one writing gathers.
+func (c *GoRuntime) holdLease(now time.Time) bool {
+	l := readLease(c.LeaseFile)
+	if l.Owner != c.consumer && now.UnixNano() < l.Expires {
+		c.setActive(false)
+		return false
+	}
+	err := writeLease(c.LeaseFile, lease{Owner: c.consumer, Expires: now.Add(c.LeaseTTL.Duration).UnixNano()})
+	if err != nil {
+		c.Log.Errorf("renewing the lease %s: %s", c.LeaseFile, err)
+		c.setActive(false)
+		return false
+	}
+	active := readLease(c.LeaseFile).Owner == c.consumer
+	c.setActive(active)
+	return active
+}
+
+// releaseLease lets a standby take over at once
+func (c *GoRuntime) releaseLease() {
+	if c.LeaseFile != "" && readLease(c.LeaseFile).Owner == c.consumer {
+		os.Remove(c.LeaseFile)
+	}
+}
+
+func (c *GoRuntime) setActive(active bool) {
+	if active == c.active {
+		return
+	}
+	c.active = active
+	if active {
+		c.Log.Infof("acquired the lease %s, gathering", c.LeaseFile)
+	} else {
+		c.Log.Infof("lost the lease %s, standing by", c.LeaseFile)
+	}
+}
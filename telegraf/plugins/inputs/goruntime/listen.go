@@ -0,0 +1,179 @@
+package goruntime
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/jursonmo/gomonitor/model"
+	"github.com/jursonmo/gomonitor/websocket"
+)
+
+// listener receives the runtime data pushed by the agents
+type listener struct {
+	server *http.Server
+	acc    telegraf.Accumulator
+	// mu serializes the pushes, which share the state of the apps
+	mu sync.Mutex
+
+	channelsMu sync.Mutex
+	channels   map[string]*channel
+	// configs are the configs to send to the agents by serial, or "*"
+	// for all of them
+	configs map[string]model.ChannelMessage
+}
+
+// startListener serves Listen, the agents push to any path of it
+func (c *GoRuntime) startListener(acc telegraf.Accumulator) error {
+	ln, err := net.Listen("tcp", c.Listen)
+	if err != nil {
+		return fmt.Errorf("listen: %s", err)
+	}
+	c.listener = &listener{acc: acc}
+	c.listener.server = &http.Server{
+		Handler:           http.HandlerFunc(c.receive),
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       c.Timeout.Duration,
+	}
+	go func() {
+		if err := c.listener.server.Serve(ln); err != nil && err != http.ErrServerClosed {
+			c.Log.Errorf("listen on %s: %s", c.Listen, err)
+		}
+	}()
+	c.Log.Infof("listening on %s for pushes", ln.Addr())
+	return nil
+}
+
+func (c *GoRuntime) stopListener() {
+	if c.listener == nil {
+		return
+	}
+	c.listener.server.Close()
+	// the hijacked connections of the channels aren't closed by the server
+	c.listener.channelsMu.Lock()
+	defer c.listener.channelsMu.Unlock()
+	for _, ch := range c.listener.channels {
+		ch.conn.Close()
+	}
+}
+
+// receive emits the runtime data of a push, a payload, an array of
+// payloads or a payload per line, timestamped with the clock of the
+// agent. The pushes are verified and unsealed like the scrapes. It also
+// serves the channels of the agents and the commands sent over them.
+func (c *GoRuntime) receive(w http.ResponseWriter, req *http.Request) {
+	if strings.HasPrefix(req.URL.Path, "/control/") {
+		if c.authorizeAdmin(w, req) {
+			c.command(w, req)
+		}
+		return
+	}
+	if strings.HasPrefix(req.URL.Path, "/config/") {
+		if c.authorizeAdmin(w, req) {
+			c.configure(w, req)
+		}
+		return
+	}
+	if strings.HasPrefix(req.URL.Path, "/maintenance/") {
+		if c.authorizeAdmin(w, req) {
+			c.serveMaintenance(w, req)
+		}
+		return
+	}
+	if err := c.authorizePush(req); err != nil {
+		c.Log.Debugf("[push=%s] %s", req.RemoteAddr, err)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if websocket.IsUpgrade(req) {
+		c.serveChannel(w, req)
+		return
+	}
+	if req.Method != http.MethodPost && req.Method != http.MethodPut {
+		w.Header().Set("Allow", "POST, PUT")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, req.Body, c.ListenMaxBody))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	err = c.receivePayload(req.RemoteAddr, req.Header.Get(model.SignatureHeader), req.Header.Get("Content-Type"), body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// receivePayload verifies, unseals and emits a pushed body
+func (c *GoRuntime) receivePayload(from, signature, contentType string, body []byte) error {
+	// the state of the apps is kept by serial, whichever address pushes
+	s := &scrape{url: "push://" + c.Listen, remote: from, at: time.Now(), backfill: true}
+	acc := c.listener.acc
+	err := c.verify(signature, body, s.at)
+	if err == nil {
+		if body, err = c.unseal(body); err == nil {
+			err = checkPayload(contentType, body)
+		}
+	}
+	if err == nil {
+		c.listener.mu.Lock()
+		err = c.decodeAll(acc, body, s)
+		c.listener.mu.Unlock()
+	}
+	if err != nil {
+		var se *scrapeError
+		if errors.As(err, &se) {
+			c.addScrapeFailure(acc, s.url, se, false)
+		}
+		acc.AddError(fmt.Errorf("[push=%s]: %s", from, err))
+	}
+	return err
+}
+
+// authorizePush checks the bearer token of the push when listen_token is
+// set
+func (c *GoRuntime) authorizePush(req *http.Request) error {
+	if c.ListenToken == "" {
+		return nil
+	}
+	return c.checkBearer(req, c.ListenToken)
+}
+
+// authorizeAdmin checks the bearer token of the request to an admin
+// endpoint, refused unless listen_admin_token is set, and answers it
+// when it fails
+func (c *GoRuntime) authorizeAdmin(w http.ResponseWriter, req *http.Request) bool {
+	if c.ListenAdminToken == "" {
+		http.Error(w, "listen_admin_token is not set", http.StatusForbidden)
+		return false
+	}
+	if err := c.checkBearer(req, c.ListenAdminToken); err != nil {
+		c.Log.Debugf("[admin=%s] %s", req.RemoteAddr, err)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+func (c *GoRuntime) checkBearer(req *http.Request, secret string) error {
+	token, err := c.secret(secret)
+	if err != nil {
+		return err
+	}
+	got := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+		return errors.New("invalid token")
+	}
+	return nil
+}
@@ -0,0 +1,272 @@
+package goruntime
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MaintenanceWindow is a period the scrapes of the matching urls are
+// expected to fail, e.g. a planned reboot: their failures are tagged
+// maintenance=true and not reported as errors. It is a single window
+// from Start to End, RFC 3339, or a window of Duration starting every
+// week at Weekly, e.g. "Sun 03:00" or "Sun 03:00 Europe/Paris", in UTC
+// without a location.
+type MaintenanceWindow struct {
+	Name string `toml:"name" json:"name,omitempty"`
+	// URL is a glob of the urls, whose * matches any characters, all of
+	// them when empty
+	URL string `toml:"url" json:"url,omitempty"`
+	// Tags must all be tags of the last points of the url
+	Tags map[string]string `toml:"tags" json:"tags,omitempty"`
+
+	Start    string `toml:"start" json:"start,omitempty"`
+	End      string `toml:"end" json:"end,omitempty"`
+	Weekly   string `toml:"weekly" json:"weekly,omitempty"`
+	Duration string `toml:"duration" json:"duration,omitempty"`
+}
+
+const week = 7 * 24 * time.Hour
+
+// window is a parsed MaintenanceWindow
+type window struct {
+	MaintenanceWindow
+	url        *regexp.Regexp
+	start, end time.Time
+	// weekly is the offset of the start in the week from Sunday 00:00
+	weekly   time.Duration
+	location *time.Location
+	duration time.Duration
+}
+
+func parseWindow(mw MaintenanceWindow) (window, error) {
+	w := window{MaintenanceWindow: mw}
+	if mw.URL != "" {
+		// unlike path.Match, * also matches the slashes of the urls
+		glob := strings.NewReplacer(`\*`, ".*", `\?`, ".").Replace(regexp.QuoteMeta(mw.URL))
+		w.url = regexp.MustCompile("^" + glob + "$")
+	}
+	var err error
+	switch {
+	case mw.Weekly != "":
+		if mw.Start != "" || mw.End != "" {
+			return w, fmt.Errorf("weekly and start/end are exclusive")
+		}
+		if w.weekly, w.location, err = parseWeekly(mw.Weekly); err != nil {
+			return w, err
+		}
+		if w.duration, err = time.ParseDuration(mw.Duration); err != nil || w.duration <= 0 || w.duration > week {
+			return w, fmt.Errorf("invalid duration %q: must be positive and at most a week", mw.Duration)
+		}
+	case mw.Start != "" && mw.End != "":
+		if w.start, err = time.Parse(time.RFC3339, mw.Start); err != nil {
+			return w, fmt.Errorf("invalid start: %s", err)
+		}
+		if w.end, err = time.Parse(time.RFC3339, mw.End); err != nil {
+			return w, fmt.Errorf("invalid end: %s", err)
+		}
+		if !w.end.After(w.start) {
+			return w, fmt.Errorf("end %s is not after start %s", mw.End, mw.Start)
+		}
+	default:
+		return w, fmt.Errorf("start and end, or weekly and duration, are required")
+	}
+	return w, nil
+}
+
+// parseWeekly parses "Sun 03:00" with an optional location
+func parseWeekly(s string) (time.Duration, *time.Location, error) {
+	parts := strings.Fields(s)
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, nil, fmt.Errorf("invalid weekly %q: must be like \"Sun 03:00\"", s)
+	}
+	day := -1
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if strings.EqualFold(parts[0], d.String()[:3]) || strings.EqualFold(parts[0], d.String()) {
+			day = int(d)
+		}
+	}
+	at, err := time.Parse("15:04", parts[1])
+	if day < 0 || err != nil {
+		return 0, nil, fmt.Errorf("invalid weekly %q: must be like \"Sun 03:00\"", s)
+	}
+	loc := time.UTC
+	if len(parts) == 3 {
+		if loc, err = time.LoadLocation(parts[2]); err != nil {
+			return 0, nil, fmt.Errorf("invalid weekly %q: %s", s, err)
+		}
+	}
+	return time.Duration(day)*24*time.Hour + time.Duration(at.Hour())*time.Hour + time.Duration(at.Minute())*time.Minute, loc, nil
+}
+
+// active tells if the window is open at now
+func (w window) active(now time.Time) bool {
+	if w.Weekly == "" {
+		return !now.Before(w.start) && now.Before(w.end)
+	}
+	now = now.In(w.location)
+	offset := time.Duration(now.Weekday())*24*time.Hour +
+		time.Duration(now.Hour())*time.Hour + time.Duration(now.Minute())*time.Minute +
+		time.Duration(now.Second())*time.Second
+	return ((offset-w.weekly)%week+week)%week < w.duration
+}
+
+// matches tells if the window is for the url, whose last points had the
+// tags
+func (w window) matches(url string, tags []map[string]string) bool {
+	if w.url != nil && !w.url.MatchString(url) {
+		return false
+	}
+	if len(w.Tags) == 0 {
+		return true
+	}
+	for _, t := range tags {
+		all := true
+		for k, v := range w.Tags {
+			if t[k] != v {
+				all = false
+				break
+			}
+		}
+		if all {
+			return true
+		}
+	}
+	return false
+}
+
+// maintenance are the windows of the config, of the reload file and the
+// ones set through the listener by name
+type maintenance struct {
+	mu     sync.Mutex
+	config []window
+	file   []window
+	api    map[string]window
+}
+
+func parseWindows(mws []MaintenanceWindow) ([]window, error) {
+	ws := make([]window, 0, len(mws))
+	for i, mw := range mws {
+		w, err := parseWindow(mw)
+		if err != nil {
+			return nil, fmt.Errorf("maintenance window %d: %s", i+1, err)
+		}
+		ws = append(ws, w)
+	}
+	return ws, nil
+}
+
+func (m *maintenance) setFile(ws []window) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.file = ws
+}
+
+// inMaintenance tells if the url is in a maintenance window at now, only
+// the goroutine gathering the url may call it
+func (c *GoRuntime) inMaintenance(url string, target *targetState, now time.Time) bool {
+	m := &c.maintenance
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, ws := range [][]window{m.config, m.file} {
+		for _, w := range ws {
+			if w.active(now) && w.matches(url, target.tags) {
+				return true
+			}
+		}
+	}
+	for _, w := range m.api {
+		if w.active(now) && w.matches(url, target.tags) {
+			return true
+		}
+	}
+	return false
+}
+
+// maintenanceStatus is a window as listed by GET /maintenance/
+type maintenanceStatus struct {
+	MaintenanceWindow
+	Source string `json:"source"`
+	Active bool   `json:"active"`
+}
+
+// serveMaintenance lists the maintenance windows on GET /maintenance/,
+// sets the window of the name to the JSON body on PUT
+// /maintenance/<name> and deletes it on DELETE /maintenance/<name>. The
+// windows set this way are lost when telegraf restarts.
+func (c *GoRuntime) serveMaintenance(w http.ResponseWriter, req *http.Request) {
+	name := strings.TrimPrefix(req.URL.Path, "/maintenance/")
+	m := &c.maintenance
+	switch {
+	case name == "" && req.Method == http.MethodGet:
+		now := time.Now()
+		m.mu.Lock()
+		var list []maintenanceStatus
+		for _, s := range []struct {
+			source string
+			ws     []window
+		}{{"config", m.config}, {"file", m.file}} {
+			for _, w := range s.ws {
+				list = append(list, maintenanceStatus{w.MaintenanceWindow, s.source, w.active(now)})
+			}
+		}
+		names := make([]string, 0, len(m.api))
+		for name := range m.api {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			list = append(list, maintenanceStatus{m.api[name].MaintenanceWindow, "api", m.api[name].active(now)})
+		}
+		m.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(list)
+
+	case name != "" && !strings.Contains(name, "/") && req.Method == http.MethodPut:
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, req.Body, c.ListenMaxBody))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		var mw MaintenanceWindow
+		if err = json.Unmarshal(body, &mw); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		mw.Name = name
+		win, err := parseWindow(mw)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		m.mu.Lock()
+		if m.api == nil {
+			m.api = make(map[string]window)
+		}
+		m.api[name] = win
+		m.mu.Unlock()
+		c.Log.Infof("[maintenance=%s] set by %s", name, req.RemoteAddr)
+		w.WriteHeader(http.StatusNoContent)
+
+	case name != "" && !strings.Contains(name, "/") && req.Method == http.MethodDelete:
+		m.mu.Lock()
+		_, ok := m.api[name]
+		delete(m.api, name)
+		m.mu.Unlock()
+		if !ok {
+			http.Error(w, "no such maintenance window", http.StatusNotFound)
+			return
+		}
+		c.Log.Infof("[maintenance=%s] deleted by %s", name, req.RemoteAddr)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "GET /maintenance/, PUT or DELETE /maintenance/<name>", http.StatusMethodNotAllowed)
+	}
+}
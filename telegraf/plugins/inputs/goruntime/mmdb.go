@@ -0,0 +1,248 @@
+package goruntime
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"net"
+)
+
+// mmdb is a MaxMind DB file, e.g. GeoLite2-City.mmdb, read in memory. Only
+// the lookups are supported, see
+// https://maxmind.github.io/MaxMind-DB/
+type mmdb struct {
+	buf        []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	// data is the data section, after the search tree
+	data []byte
+	// ipv4Start is the node of ::/96, where the IPv4 addresses start in
+	// an IPv6 tree
+	ipv4Start uint
+}
+
+var mmdbMetadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+func openMMDB(path string) (*mmdb, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	i := bytes.LastIndex(buf, mmdbMetadataMarker)
+	if i < 0 {
+		return nil, errors.New("not a MaxMind DB: no metadata")
+	}
+	meta, _, err := mmdbDecode(buf[i+len(mmdbMetadataMarker):], 0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("metadata: %s", err)
+	}
+	m, ok := meta.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("metadata: not a map")
+	}
+	db := &mmdb{buf: buf}
+	db.nodeCount, _ = mmdbUint(m["node_count"])
+	db.recordSize, _ = mmdbUint(m["record_size"])
+	db.ipVersion, _ = mmdbUint(m["ip_version"])
+	switch db.recordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("unsupported record size %d", db.recordSize)
+	}
+	treeSize := db.nodeCount * db.recordSize / 4
+	if treeSize+16 > uint(i) {
+		return nil, errors.New("search tree beyond the data")
+	}
+	db.data = buf[treeSize+16 : i]
+
+	if db.ipVersion == 6 {
+		node := uint(0)
+		for n := 0; n < 96 && node < db.nodeCount; n++ {
+			node = db.record(node, 0)
+		}
+		db.ipv4Start = node
+	}
+	return db, nil
+}
+
+// record returns the left, 0, or right, 1, record of the node
+func (db *mmdb) record(node, bit uint) uint {
+	b := db.buf[node*db.recordSize/4:]
+	switch db.recordSize {
+	case 24:
+		b = b[bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		if bit == 0 {
+			return uint(b[3]&0xF0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0F)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	}
+	return uint(binary.BigEndian.Uint32(b[bit*4:]))
+}
+
+// lookup returns the record of the ip, nil when it is not in the database
+func (db *mmdb) lookup(ip net.IP) (interface{}, error) {
+	node := uint(0)
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+		if db.ipVersion == 6 {
+			node = db.ipv4Start
+		}
+	} else if db.ipVersion == 4 {
+		return nil, nil
+	}
+	for i := 0; i < len(ip)*8 && node < db.nodeCount; i++ {
+		node = db.record(node, uint(ip[i/8]>>(7-uint(i%8)))&1)
+	}
+	if node <= db.nodeCount {
+		return nil, nil
+	}
+	offset := node - db.nodeCount - 16
+	if offset >= uint(len(db.data)) {
+		return nil, errors.New("invalid data pointer")
+	}
+	v, _, err := mmdbDecode(db.data, offset, 0)
+	return v, err
+}
+
+// mmdbDecode decodes the value at offset of the section, whose pointers
+// are relative to its start, and returns the offset after it
+func mmdbDecode(section []byte, offset uint, depth int) (interface{}, uint, error) {
+	if depth > 32 {
+		return nil, 0, errors.New("too deep")
+	}
+	next := func(n uint) ([]byte, error) {
+		if offset+n > uint(len(section)) {
+			return nil, errors.New("unexpected end of data")
+		}
+		b := section[offset : offset+n]
+		offset += n
+		return b, nil
+	}
+	b, err := next(1)
+	if err != nil {
+		return nil, 0, err
+	}
+	ctrl := b[0]
+	typ := uint(ctrl >> 5)
+
+	if typ == 1 {
+		// a pointer, sized by the 2 bits after the type
+		ss, v := uint(ctrl>>3)&3, uint(ctrl&7)
+		if b, err = next(ss + 1); err != nil {
+			return nil, 0, err
+		}
+		var p uint
+		switch ss {
+		case 0:
+			p = v<<8 | uint(b[0])
+		case 1:
+			p = (v<<16 | uint(b[0])<<8 | uint(b[1])) + 2048
+		case 2:
+			p = (v<<24 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])) + 526336
+		default:
+			p = uint(binary.BigEndian.Uint32(b))
+		}
+		val, _, err := mmdbDecode(section, p, depth+1)
+		return val, offset, err
+	}
+	if typ == 0 {
+		if b, err = next(1); err != nil {
+			return nil, 0, err
+		}
+		typ = 7 + uint(b[0])
+	}
+	size := uint(ctrl & 0x1f)
+	if size >= 29 {
+		n := size - 28
+		if b, err = next(n); err != nil {
+			return nil, 0, err
+		}
+		var v uint
+		for _, c := range b {
+			v = v<<8 | uint(c)
+		}
+		size = []uint{29, 285, 65821}[n-1] + v
+	}
+
+	switch typ {
+	case 2: // string
+		b, err = next(size)
+		return string(b), offset, err
+	case 3: // double
+		if b, err = next(8); err != nil {
+			return nil, 0, err
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), offset, nil
+	case 4: // bytes
+		b, err = next(size)
+		return append([]byte(nil), b...), offset, err
+	case 5, 6, 9: // uint16, uint32, uint64
+		if b, err = next(size); err != nil {
+			return nil, 0, err
+		}
+		var v uint64
+		for _, c := range b {
+			v = v<<8 | uint64(c)
+		}
+		return v, offset, nil
+	case 8: // int32
+		if b, err = next(size); err != nil {
+			return nil, 0, err
+		}
+		var v uint32
+		for _, c := range b {
+			v = v<<8 | uint32(c)
+		}
+		return int64(int32(v)), offset, nil
+	case 10: // uint128
+		b, err = next(size)
+		return new(big.Int).SetBytes(b), offset, err
+	case 7: // map
+		m := make(map[string]interface{}, size)
+		for i := uint(0); i < size; i++ {
+			var k, v interface{}
+			if k, offset, err = mmdbDecode(section, offset, depth+1); err != nil {
+				return nil, 0, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, 0, errors.New("map key is not a string")
+			}
+			if v, offset, err = mmdbDecode(section, offset, depth+1); err != nil {
+				return nil, 0, err
+			}
+			m[key] = v
+		}
+		return m, offset, nil
+	case 11: // array
+		a := make([]interface{}, 0, size)
+		for i := uint(0); i < size; i++ {
+			var v interface{}
+			if v, offset, err = mmdbDecode(section, offset, depth+1); err != nil {
+				return nil, 0, err
+			}
+			a = append(a, v)
+		}
+		return a, offset, nil
+	case 14: // boolean, the size is the value
+		return size != 0, offset, nil
+	case 15: // float
+		if b, err = next(4); err != nil {
+			return nil, 0, err
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), offset, nil
+	}
+	return nil, 0, fmt.Errorf("unsupported type %d", typ)
+}
+
+func mmdbUint(v interface{}) (uint, bool) {
+	n, ok := v.(uint64)
+	return uint(n), ok
+}
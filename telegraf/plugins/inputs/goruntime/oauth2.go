@@ -0,0 +1,83 @@
+package goruntime
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// oauth2Token is the access token of the client credentials flow, used
+// until a minute before it expires
+type oauth2Token struct {
+	sync.Mutex
+	value   string
+	expires time.Time
+}
+
+// oauth2AccessToken returns the cached access token, or requests a new
+// one from the token url
+func (c *GoRuntime) oauth2AccessToken() (string, error) {
+	c.oauth2.Lock()
+	defer c.oauth2.Unlock()
+	if c.oauth2.value != "" && time.Until(c.oauth2.expires) > time.Minute {
+		return c.oauth2.value, nil
+	}
+
+	id, err := c.secret(c.OAuth2ClientID)
+	if err != nil {
+		return "", err
+	}
+	secret, err := c.secret(c.OAuth2ClientSecret)
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(c.OAuth2Scopes) > 0 {
+		form.Set("scope", strings.Join(c.OAuth2Scopes, " "))
+	}
+	req, err := http.NewRequestWithContext(c.requestContext(), http.MethodPost, c.OAuth2TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(id), url.QueryEscape(secret))
+	client := http.Client{Timeout: c.Timeout.Duration}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("oauth2 token: %s", err)
+	}
+	defer resp.Body.Close()
+	var token struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		ExpiresIn   int64  `json:"expires_in"`
+		Error       string `json:"error"`
+	}
+	json.NewDecoder(resp.Body).Decode(&token)
+	if resp.StatusCode != http.StatusOK || token.AccessToken == "" {
+		return "", fmt.Errorf("oauth2 token: status code %d %s", resp.StatusCode, token.Error)
+	}
+	if token.TokenType != "" && !strings.EqualFold(token.TokenType, "bearer") {
+		return "", fmt.Errorf("oauth2 token: unsupported token type %q", token.TokenType)
+	}
+	c.oauth2.value = token.AccessToken
+	// a token without expiry is requested again every hour
+	c.oauth2.expires = time.Now().Add(time.Hour)
+	if token.ExpiresIn > 0 {
+		c.oauth2.expires = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	}
+	return c.oauth2.value, nil
+}
+
+// expireOAuth2Token drops the access token rejected by a target, e.g.
+// revoked, so the next scrape requests a new one
+func (c *GoRuntime) expireOAuth2Token() {
+	c.oauth2.Lock()
+	c.oauth2.value = ""
+	c.oauth2.Unlock()
+}
@@ -0,0 +1,378 @@
+package goruntime
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"sort"
+	"time"
+)
+
+// A minimal Parquet writer: one row group, one uncompressed PLAIN data
+// page per column, the columns optional but the time. Enough for Spark
+// and DuckDB to read the archive without a dependency on a Parquet
+// library.
+
+// parquet physical types, repetitions, converted types and encodings
+const (
+	parquetBoolean   = 0
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	parquetRequired = 0
+	parquetOptional = 1
+
+	parquetUTF8            = 0
+	parquetTimestampMicros = 10
+
+	parquetPlain = 0
+	parquetRLE   = 3
+)
+
+// thrift compact protocol types
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter writes the thrift compact protocol, the parquet metadata
+type thriftWriter struct {
+	bytes.Buffer
+	last  int16
+	stack []int16
+}
+
+func (w *thriftWriter) varint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	w.Write(b[:binary.PutUvarint(b[:], v)])
+}
+
+func (w *thriftWriter) zigzag(v int64) {
+	w.varint(uint64(v<<1) ^ uint64(v>>63))
+}
+
+func (w *thriftWriter) field(id int16, typ byte) {
+	if d := id - w.last; d > 0 && d <= 15 {
+		w.WriteByte(byte(d)<<4 | typ)
+	} else {
+		w.WriteByte(typ)
+		w.zigzag(int64(id))
+	}
+	w.last = id
+}
+
+func (w *thriftWriter) i32(id int16, v int32) {
+	w.field(id, thriftI32)
+	w.zigzag(int64(v))
+}
+
+func (w *thriftWriter) i64(id int16, v int64) {
+	w.field(id, thriftI64)
+	w.zigzag(v)
+}
+
+func (w *thriftWriter) binary(id int16, s string) {
+	w.field(id, thriftBinary)
+	w.varint(uint64(len(s)))
+	w.WriteString(s)
+}
+
+// list starts a list field of n elements of typ
+func (w *thriftWriter) list(id int16, typ byte, n int) {
+	w.field(id, thriftList)
+	if n < 15 {
+		w.WriteByte(byte(n)<<4 | typ)
+		return
+	}
+	w.WriteByte(0xf0 | typ)
+	w.varint(uint64(n))
+}
+
+// begin starts a struct, a field or a list element when id is 0
+func (w *thriftWriter) begin(id int16) {
+	if id != 0 {
+		w.field(id, thriftStruct)
+	}
+	w.stack = append(w.stack, w.last)
+	w.last = 0
+}
+
+func (w *thriftWriter) end() {
+	w.WriteByte(0)
+	w.last = w.stack[len(w.stack)-1]
+	w.stack = w.stack[:len(w.stack)-1]
+}
+
+// parquetColumn is a column of values, nil for null
+type parquetColumn struct {
+	name      string
+	typ       int32
+	converted int32 // -1 for none
+	required  bool
+	values    []interface{}
+}
+
+// newParquetColumn returns the column of the values, typed by the first
+// one not nil, or double for integers and floats. The values of another
+// type are null.
+func newParquetColumn(name string, values []interface{}) *parquetColumn {
+	c := &parquetColumn{name: name, typ: -1, converted: -1}
+	for _, v := range values {
+		typ := int32(-1)
+		switch v.(type) {
+		case int64, int, uint64:
+			typ = parquetInt64
+		case float64:
+			typ = parquetDouble
+		case bool:
+			typ = parquetBoolean
+		case string:
+			typ = parquetByteArray
+		}
+		switch {
+		case c.typ < 0:
+			c.typ = typ
+		case c.typ == parquetInt64 && typ == parquetDouble:
+			c.typ = parquetDouble
+		}
+	}
+	if c.typ == parquetByteArray {
+		c.converted = parquetUTF8
+	}
+	for _, v := range values {
+		if c.typ == parquetDouble {
+			switch x := v.(type) {
+			case int64:
+				v = float64(x)
+			case int:
+				v = float64(x)
+			case uint64:
+				v = float64(x)
+			}
+		}
+		switch x := v.(type) {
+		case int:
+			v = int64(x)
+		case uint64:
+			v = int64(x)
+		}
+		switch v.(type) {
+		case int64:
+			if c.typ != parquetInt64 {
+				v = nil
+			}
+		case float64:
+			if c.typ != parquetDouble {
+				v = nil
+			}
+		case bool:
+			if c.typ != parquetBoolean {
+				v = nil
+			}
+		case string:
+			if c.typ != parquetByteArray {
+				v = nil
+			}
+		default:
+			v = nil
+		}
+		c.values = append(c.values, v)
+	}
+	return c
+}
+
+// page returns the definition levels and the PLAIN values of the column
+func (c *parquetColumn) page() []byte {
+	var page bytes.Buffer
+	if !c.required {
+		// the levels are RLE runs of 0 for null and 1, with a width of 1
+		var levels thriftWriter
+		for i := 0; i < len(c.values); {
+			j := i
+			for j < len(c.values) && (c.values[j] == nil) == (c.values[i] == nil) {
+				j++
+			}
+			levels.varint(uint64(j-i) << 1)
+			if c.values[i] == nil {
+				levels.WriteByte(0)
+			} else {
+				levels.WriteByte(1)
+			}
+			i = j
+		}
+		binary.Write(&page, binary.LittleEndian, uint32(levels.Len()))
+		page.Write(levels.Bytes())
+	}
+
+	var bits byte
+	var nbits uint
+	for _, v := range c.values {
+		switch x := v.(type) {
+		case int64:
+			binary.Write(&page, binary.LittleEndian, x)
+		case float64:
+			binary.Write(&page, binary.LittleEndian, math.Float64bits(x))
+		case string:
+			binary.Write(&page, binary.LittleEndian, uint32(len(x)))
+			page.WriteString(x)
+		case bool:
+			if x {
+				bits |= 1 << nbits
+			}
+			if nbits++; nbits == 8 {
+				page.WriteByte(bits)
+				bits, nbits = 0, 0
+			}
+		}
+	}
+	if nbits > 0 {
+		page.WriteByte(bits)
+	}
+	return page.Bytes()
+}
+
+// writeParquet writes the rows as a Parquet file with a time column, the
+// tags and then the fields, each sorted by name. A field named as a tag
+// is dropped.
+func writeParquet(out io.Writer, rows []archiveRow) error {
+	times := make([]interface{}, len(rows))
+	tagSet := make(map[string]bool)
+	fieldSet := make(map[string]bool)
+	for i, r := range rows {
+		times[i] = r.time.UnixNano() / int64(time.Microsecond)
+		for k := range r.tags {
+			tagSet[k] = true
+		}
+		for k := range r.values {
+			fieldSet[k] = true
+		}
+	}
+	timeColumn := newParquetColumn("time", times)
+	timeColumn.converted, timeColumn.required = parquetTimestampMicros, true
+	columns := []*parquetColumn{timeColumn}
+
+	for _, k := range sortedKeys(tagSet) {
+		values := make([]interface{}, len(rows))
+		for i, r := range rows {
+			if v, ok := r.tags[k]; ok {
+				values[i] = v
+			}
+		}
+		columns = append(columns, newParquetColumn(k, values))
+	}
+	for _, k := range sortedKeys(fieldSet) {
+		if tagSet[k] || k == "time" {
+			continue
+		}
+		values := make([]interface{}, len(rows))
+		for i, r := range rows {
+			values[i] = r.values[k]
+		}
+		if c := newParquetColumn(k, values); c.typ >= 0 {
+			columns = append(columns, c)
+		}
+	}
+	return encodeParquet(out, columns, len(rows))
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// encodeParquet writes the columns of n rows
+func encodeParquet(out io.Writer, columns []*parquetColumn, n int) error {
+	var file bytes.Buffer
+	file.WriteString("PAR1")
+
+	type chunk struct {
+		offset, size int64
+	}
+	chunks := make([]chunk, len(columns))
+	for i, c := range columns {
+		page := c.page()
+		var header thriftWriter
+		header.begin(0)
+		header.i32(1, 0) // DATA_PAGE
+		header.i32(2, int32(len(page)))
+		header.i32(3, int32(len(page)))
+		header.begin(5)
+		header.i32(1, int32(n))
+		header.i32(2, parquetPlain)
+		header.i32(3, parquetRLE)
+		header.i32(4, parquetRLE)
+		header.end()
+		header.end()
+		chunks[i] = chunk{int64(file.Len()), int64(header.Len() + len(page))}
+		file.Write(header.Bytes())
+		file.Write(page)
+	}
+
+	var meta thriftWriter
+	meta.begin(0)
+	meta.i32(1, 1)
+	meta.list(2, thriftStruct, len(columns)+1)
+	meta.begin(0)
+	meta.binary(4, "schema")
+	meta.i32(5, int32(len(columns)))
+	meta.end()
+	for _, c := range columns {
+		meta.begin(0)
+		meta.i32(1, c.typ)
+		repetition := int32(parquetOptional)
+		if c.required {
+			repetition = parquetRequired
+		}
+		meta.i32(3, repetition)
+		meta.binary(4, c.name)
+		if c.converted >= 0 {
+			meta.i32(6, c.converted)
+		}
+		meta.end()
+	}
+	meta.i64(3, int64(n))
+	meta.list(4, thriftStruct, 1)
+	meta.begin(0)
+	meta.list(1, thriftStruct, len(columns))
+	var total int64
+	for i, c := range columns {
+		meta.begin(0)
+		meta.i64(2, chunks[i].offset)
+		meta.begin(3)
+		meta.i32(1, c.typ)
+		meta.list(2, thriftI32, 2)
+		meta.zigzag(parquetPlain)
+		meta.zigzag(parquetRLE)
+		meta.list(3, thriftBinary, 1)
+		meta.varint(uint64(len(c.name)))
+		meta.WriteString(c.name)
+		meta.i32(4, 0) // UNCOMPRESSED
+		meta.i64(5, int64(n))
+		meta.i64(6, chunks[i].size)
+		meta.i64(7, chunks[i].size)
+		meta.i64(9, chunks[i].offset)
+		meta.end()
+		meta.end()
+		total += chunks[i].size
+	}
+	meta.i64(2, total)
+	meta.i64(3, int64(n))
+	meta.end()
+	meta.binary(6, "gomonitor goruntime input")
+	meta.end()
+
+	file.Write(meta.Bytes())
+	binary.Write(&file, binary.LittleEndian, uint32(meta.Len()))
+	file.WriteString("PAR1")
+	_, err := out.Write(file.Bytes())
+	return err
+}
@@ -0,0 +1,209 @@
+package goruntime
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/influxdata/telegraf"
+)
+
+// checkPaths validates the paths fetched from every url
+func checkPaths(paths []string) error {
+	for _, p := range paths {
+		if !strings.HasPrefix(p, "/") {
+			return fmt.Errorf("invalid path %q: must start with /", p)
+		}
+	}
+	return nil
+}
+
+// pathURLs returns the url with its path replaced by each of the paths
+func (c *GoRuntime) pathURLs(target string) []string {
+	if len(c.Paths) == 0 {
+		return []string{target}
+	}
+	urls := make([]string, 0, len(c.Paths))
+	for _, p := range c.Paths {
+		urls = append(urls, withPath(target, p))
+	}
+	return urls
+}
+
+// withPath returns the url with its path replaced
+func withPath(target, path string) string {
+	u, err := url.Parse(target)
+	if err != nil {
+		return target
+	}
+	u.Path = path
+	return u.String()
+}
+
+// targetURLs returns the urls of the shard gathered separately, with
+// merge_paths the paths of an url are gathered together
+func (c *GoRuntime) targetURLs() []string {
+	if len(c.Paths) == 0 || c.MergePaths {
+		return c.shardURLs()
+	}
+	var urls []string
+	for _, u := range c.shardURLs() {
+		urls = append(urls, c.pathURLs(u)...)
+	}
+	return urls
+}
+
+// gatherPaths fetches every path of the url and decodes the payloads,
+// which must be objects, into one runtime data: a field set by a later
+// path replaces the one of an earlier path. With strict the merged
+// payload is validated, a path may lack what another one serves.
+func (c *GoRuntime) gatherPaths(acc telegraf.Accumulator, target string) (err error) {
+	start := time.Now()
+	s := &scrape{url: target}
+	if c.OTLPEndpoint != "" {
+		s.trace = newScrapeTrace(target)
+		defer func() {
+			s.trace.finish(start, err)
+			c.addTrace(s.trace)
+		}()
+	}
+
+	var merged map[string]interface{}
+	if c.Strict {
+		merged = make(map[string]interface{})
+	}
+	data := getData()
+	defer putData(data)
+	for _, u := range c.pathURLs(target) {
+		at, err := c.mergePath(u, data, merged, s.trace)
+		if err != nil {
+			return err
+		}
+		s.at = at
+	}
+	if c.Strict {
+		b, err := json.Marshal(merged)
+		if err == nil {
+			err = validate(b)
+		}
+		if err != nil {
+			return &scrapeError{failureSchema, err}
+		}
+	}
+	s.duration = time.Since(start)
+	c.addExtraJSON(acc, s)
+	c.Log.Debugf("[url=%s] %d paths scraped in %s", target, len(c.Paths), s.duration)
+	parseStart := time.Now()
+	err = c.parse(data, acc, s)
+	s.trace.add("parse", parseStart, time.Now(), err)
+	return err
+}
+
+// mergePath fetches the url and decodes its payload into data, and into
+// merged unless nil, it returns when the response arrived. Its phases are
+// added to the trace unless nil.
+func (c *GoRuntime) mergePath(u string, data *RuntimeData, merged map[string]interface{}, trace *scrapeTrace) (time.Time, error) {
+	ps := &scrape{url: u, trace: trace}
+	if trace != nil {
+		ps.timings = &timings{}
+	}
+	start := time.Now()
+	body, err := c.fetch(ps)
+	defer ps.release()
+	trace.addTimings(ps.timings)
+	trace.add("fetch "+pathOf(u), start, time.Now(), err)
+	if err != nil {
+		if body != nil {
+			c.dumpPayload(u, body)
+		}
+		return ps.at, err
+	}
+	if b, err := c.remap(body); err == nil {
+		body = b
+	}
+	if merged != nil {
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.UseNumber()
+		var payload map[string]interface{}
+		if err = dec.Decode(&payload); err != nil {
+			c.dumpPayload(u, body)
+			return ps.at, &scrapeError{failureDecode, fmt.Errorf("%s: %s", u, err)}
+		}
+		mergeObjects(merged, payload)
+	}
+	start = time.Now()
+	err = json.Unmarshal(body, data)
+	trace.add("decode "+pathOf(u), start, time.Now(), err)
+	if err != nil {
+		c.dumpPayload(u, body)
+		return ps.at, &scrapeError{failureDecode, fmt.Errorf("%s: %s", u, err)}
+	}
+	return ps.at, nil
+}
+
+// mergeObjects merges src into dst the way json.Unmarshal merges payloads
+// into a struct: objects are merged key by key, anything else replaced
+func mergeObjects(dst, src map[string]interface{}) {
+	for k, v := range src {
+		s, ok := v.(map[string]interface{})
+		d, dok := dst[k].(map[string]interface{})
+		if ok && dok {
+			mergeObjects(d, s)
+			continue
+		}
+		dst[k] = v
+	}
+}
+
+// isRuntimeData tells if the payload is runtime data, an object with
+// memstats or the array of an aggregating agent. A payload which is no
+// object is left to decode to report.
+func isRuntimeData(body []byte) bool {
+	if b := bytes.TrimLeft(body, " \t\r\n"); len(b) > 0 && b[0] == '[' {
+		return true
+	}
+	var keys map[string]json.RawMessage
+	if json.Unmarshal(body, &keys) != nil {
+		return true
+	}
+	if _, ok := keys["runtime"]; ok {
+		return true
+	}
+	_, ok := keys["memstats"]
+	return ok
+}
+
+// addPathJSON emits the flattened payload of a path which is not runtime
+// data as a measurement named after the path
+func (c *GoRuntime) addPathJSON(acc telegraf.Accumulator, url, path string, body []byte) error {
+	fields := make(map[string]interface{})
+	if err := flatten(fields, "", body); err != nil {
+		return &scrapeError{failureDecode, err}
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	name := c.measurement() + "_" + strings.Trim(unsafeFileChars.ReplaceAllString(path, "_"), "_")
+	acc.AddFields(name, fields, map[string]string{"url": url, "path": path})
+	return nil
+}
+
+// pathTag returns the path of the url when the paths are gathered
+// separately, so their points can be told apart
+func (c *GoRuntime) pathTag(target string) string {
+	if len(c.Paths) == 0 || c.MergePaths {
+		return ""
+	}
+	return pathOf(target)
+}
+
+func pathOf(target string) string {
+	u, err := url.Parse(target)
+	if err != nil {
+		return ""
+	}
+	return u.Path
+}
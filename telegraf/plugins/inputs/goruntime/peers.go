@@ -0,0 +1,160 @@
+package goruntime
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+)
+
+// peerStale is how long an agent which stopped reporting stays in its
+// peer group
+const peerStale = 5 * time.Minute
+
+// peers compares the fields of every agent to the median of its peer
+// group, the agents of the same peer tags, e.g. app and version. The
+// deviation is a robust z-score, (value - median) / (1.4826 * MAD),
+// with the mean absolute deviation scaled by 1.2533 instead when most
+// of the group has the same value and the MAD is 0, so one bad instance
+// among identical ones still stands out.
+type peers struct {
+	fields []string
+	tags   []string
+	min    int
+
+	mu     sync.Mutex
+	agents map[string]*peerAgent
+}
+
+type peerAgent struct {
+	group  string
+	tags   map[string]string
+	values map[string]float64
+	at     time.Time
+	// fresh is true when the agent reported since the last report
+	fresh bool
+}
+
+func newPeers(fields, tags []string, min int) *peers {
+	return &peers{fields: fields, tags: tags, min: min, agents: make(map[string]*peerAgent)}
+}
+
+// add records the point of the agent of the serial tag
+func (p *peers) add(tags map[string]string, values map[string]interface{}) {
+	serial := tags["serial"]
+	if serial == "" || serial == invalidSerial {
+		return
+	}
+	a := &peerAgent{tags: map[string]string{"serial": serial}, values: make(map[string]float64), at: time.Now(), fresh: true}
+	group := make([]string, len(p.tags))
+	for i, k := range p.tags {
+		group[i] = tags[k]
+		if v, ok := tags[k]; ok {
+			a.tags[k] = v
+		}
+	}
+	a.group = strings.Join(group, "\x00")
+	for _, k := range p.fields {
+		if v, ok := toFloat(values[k]); ok {
+			a.values[k] = v
+		}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.agents[serial] = a
+}
+
+// report emits into <measurement>_peers the median of the group and the
+// deviation of the fields of the agents which reported since the last
+// report, and the largest deviation of each in deviation.max, in groups
+// of at least min agents
+func (p *peers) report(acc telegraf.Accumulator, measurement string, now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	groups := make(map[string][]*peerAgent)
+	for serial, a := range p.agents {
+		if now.Sub(a.at) > peerStale {
+			delete(p.agents, serial)
+			continue
+		}
+		groups[a.group] = append(groups[a.group], a)
+	}
+	for _, group := range groups {
+		if len(group) < p.min {
+			continue
+		}
+		stats := make(map[string]peerStats, len(p.fields))
+		for _, k := range p.fields {
+			var vs []float64
+			for _, a := range group {
+				if v, ok := a.values[k]; ok {
+					vs = append(vs, v)
+				}
+			}
+			if len(vs) >= p.min {
+				stats[k] = newPeerStats(vs)
+			}
+		}
+		for _, a := range group {
+			if !a.fresh {
+				continue
+			}
+			a.fresh = false
+			fields := make(map[string]interface{}, 2*len(stats)+1)
+			max := 0.0
+			for k, st := range stats {
+				v, ok := a.values[k]
+				if !ok {
+					continue
+				}
+				d := 0.0
+				if st.scale > 0 {
+					d = (v - st.median) / st.scale
+				}
+				fields[k+".median"] = st.median
+				fields[k+".deviation"] = d
+				max = math.Max(max, math.Abs(d))
+			}
+			if len(fields) == 0 {
+				continue
+			}
+			fields["deviation.max"] = max
+			acc.AddFields(measurement+"_peers", fields, a.tags, now)
+		}
+	}
+}
+
+// peerStats are the median of the values of a field in a group and the
+// scale of their deviations
+type peerStats struct {
+	median, scale float64
+}
+
+func newPeerStats(vs []float64) (st peerStats) {
+	st.median = median(vs)
+	devs := make([]float64, len(vs))
+	var sum float64
+	for i, v := range vs {
+		devs[i] = math.Abs(v - st.median)
+		sum += devs[i]
+	}
+	if mad := median(devs); mad > 0 {
+		st.scale = 1.4826 * mad
+	} else {
+		st.scale = 1.2533 * sum / float64(len(vs))
+	}
+	return st
+}
+
+// median sorts the values
+func median(vs []float64) float64 {
+	sort.Float64s(vs)
+	n := len(vs)
+	if n%2 == 1 {
+		return vs[n/2]
+	}
+	return (vs[n/2-1] + vs[n/2]) / 2
+}
@@ -0,0 +1,41 @@
+package goruntime
+
+import (
+	"bytes"
+	"sync"
+)
+
+// the read buffers and runtime data are reused between scrapes, at
+// thousands of targets they are most of the garbage of the plugin
+var bufPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+var dataPool = sync.Pool{
+	New: func() interface{} { return new(RuntimeData) },
+}
+
+// maxPooledBuf keeps the buffers of unusually large payloads out of the pool
+const maxPooledBuf = 1 << 20
+
+// release returns the read buffer of the scrape to the pool, the body
+// returned by fetch must not be used after
+func (s *scrape) release() {
+	if s.buf == nil {
+		return
+	}
+	if s.buf.Cap() <= maxPooledBuf {
+		bufPool.Put(s.buf)
+	}
+	s.buf = nil
+}
+
+func getData() *RuntimeData {
+	rd := dataPool.Get().(*RuntimeData)
+	*rd = RuntimeData{}
+	return rd
+}
+
+func putData(rd *RuntimeData) {
+	dataPool.Put(rd)
+}
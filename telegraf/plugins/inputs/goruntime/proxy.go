@@ -0,0 +1,57 @@
+package goruntime
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// parseProxies parses the global and per target proxies, the per target
+// ones are keyed by the host of the target url so they survive redirects
+func (c *GoRuntime) parseProxies() error {
+	var err error
+	if c.HTTPProxyURL != "" {
+		if c.proxyURL, err = parseProxyURL(c.HTTPProxyURL); err != nil {
+			return err
+		}
+	}
+
+	c.targetProxies = make(map[string]*url.URL, len(c.ProxyURLs))
+	for target, proxy := range c.ProxyURLs {
+		t, err := url.Parse(target)
+		if err != nil {
+			return fmt.Errorf("invalid proxy target %q: %s", target, err)
+		}
+		p, err := parseProxyURL(proxy)
+		if err != nil {
+			return err
+		}
+		c.targetProxies[t.Host] = p
+	}
+	return nil
+}
+
+// proxy picks the proxy of the target, then the global one and falls back
+// to the environment
+func (c *GoRuntime) proxy(req *http.Request) (*url.URL, error) {
+	if p, ok := c.targetProxies[req.URL.Host]; ok {
+		return p, nil
+	}
+	if c.proxyURL != nil {
+		return c.proxyURL, nil
+	}
+	return http.ProxyFromEnvironment(req)
+}
+
+func parseProxyURL(proxy string) (*url.URL, error) {
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy url %q: %s", proxy, err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("invalid proxy url %q: scheme must be http, https or socks5", proxy)
+	}
+	return u, nil
+}
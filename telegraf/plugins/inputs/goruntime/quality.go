@@ -0,0 +1,63 @@
+package goruntime
+
+import (
+	"sort"
+
+	"github.com/jursonmo/gomonitor/model"
+)
+
+// the modes of data_quality
+const (
+	qualityFlag = "flag"
+	qualityDrop = "drop"
+)
+
+// qualityIssues returns the impossible values of the fields of the
+// runtime data, values being their map: negative gauges, the heap larger
+// than the memory obtained from the OS and percents beyond 100, or 100
+// per CPU for the CPU
+func qualityIssues(fields *model.Fields, values map[string]interface{}) []string {
+	var issues []string
+	for k, v := range values {
+		var negative bool
+		switch v := v.(type) {
+		case int64:
+			negative = v < 0
+		case float64:
+			negative = v < 0
+		}
+		if negative {
+			issues = append(issues, "negative:"+k)
+		}
+	}
+	sort.Strings(issues)
+	if fields.Sys > 0 && (fields.HeapAlloc > fields.Sys || fields.HeapSys > fields.Sys) {
+		issues = append(issues, "heap_over_sys")
+	}
+	if fields.HeapSys > 0 && fields.HeapInuse > fields.HeapSys {
+		issues = append(issues, "heap_inuse_over_heap_sys")
+	}
+	if fields.MemPercent > 100 {
+		issues = append(issues, "percent_over_100:mem.percent")
+	}
+	if fields.NumCpu > 0 && fields.CpuPercent > 100*fields.NumCpu {
+		issues = append(issues, "percent_over_100:cpu.percent")
+	}
+	return issues
+}
+
+// checkGCCount tells if the GC count of the app went back without
+// evidence of a restart, its start time changing or its uptime going
+// back. A count going back is not remembered, the next sample is
+// compared to the last valid one.
+func (st *appState) checkGCCount(numGC, startTime int64, restarted bool) bool {
+	if restarted || startTime != st.qualityStart {
+		st.qualityStart, st.qualityNumGC = startTime, numGC
+		return true
+	}
+	if numGC < st.qualityNumGC {
+		return false
+	}
+	st.qualityNumGC = numGC
+	return true
+}
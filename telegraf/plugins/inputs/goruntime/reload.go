@@ -0,0 +1,133 @@
+package goruntime
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+)
+
+// reloadConfig is the content of the reload file, it replaces the
+// matching options of the plugin each time the file changes
+type reloadConfig struct {
+	Urls     []string `json:"urls"`
+	Username string   `json:"username"`
+	Password string   `json:"password"`
+	Fields   []string `json:"fields"`
+
+	Maintenance []MaintenanceWindow `json:"maintenance"`
+}
+
+// reload re-reads the reload file when it changed since the last call
+// or the process got SIGHUP, the current config is kept when the file is
+// invalid
+func (c *GoRuntime) reload() error {
+	fi, err := os.Stat(c.ReloadFile)
+	if err != nil {
+		return err
+	}
+	forced := atomic.SwapInt32(&c.reloadForced, 0) == 1
+	if !forced && fi.ModTime().Equal(c.reloadModTime) {
+		return nil
+	}
+
+	b, err := ioutil.ReadFile(c.ReloadFile)
+	if err != nil {
+		return err
+	}
+	var rc reloadConfig
+	if err = json.Unmarshal(b, &rc); err != nil {
+		return err
+	}
+	if len(rc.Urls) == 0 {
+		return errors.New("no urls")
+	}
+	for _, u := range rc.Urls {
+		if err = validateURL(u); err != nil {
+			return err
+		}
+	}
+	if rc.Password != "" && rc.Username == "" {
+		return errors.New("password is set without username")
+	}
+	if err = checkSecret("username", rc.Username); err != nil {
+		return err
+	}
+	if err = checkSecret("password", rc.Password); err != nil {
+		return err
+	}
+	windows, err := parseWindows(rc.Maintenance)
+	if err != nil {
+		return err
+	}
+
+	c.Urls = rc.Urls
+	c.Username = rc.Username
+	c.Password = rc.Password
+	c.Fields = rc.Fields
+	c.maintenance.setFile(windows)
+	c.reloadModTime = fi.ModTime()
+	c.Log.Infof("reloaded %s: %d urls, %d fields", c.ReloadFile, len(c.Urls), len(c.Fields))
+	return nil
+}
+
+// watchReload forces the reload before the next gather whenever the
+// process gets SIGHUP, the returned func stops watching. Telegraf gets
+// the signal too.
+func (c *GoRuntime) watchReload() (stop func()) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-hup:
+				atomic.StoreInt32(&c.reloadForced, 1)
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(hup)
+		close(done)
+	}
+}
+
+// filterFields keeps the fields of the config and the derived fields
+func (c *GoRuntime) filterFields(values map[string]interface{}) {
+	if len(c.Fields) == 0 {
+		return
+	}
+	keep := make(map[string]bool, len(c.Fields)+len(c.Derived))
+	for _, f := range c.Fields {
+		keep[f] = true
+	}
+	for f := range c.Derived {
+		keep[f] = true
+	}
+	for k := range values {
+		if !keep[k] {
+			delete(values, k)
+		}
+	}
+}
+
+func validateURL(u string) error {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return fmt.Errorf("invalid url %q: %s", u, err)
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return fmt.Errorf("invalid url %q: scheme must be http or https", u)
+	}
+	if parsed.Host == "" {
+		return fmt.Errorf("invalid url %q: missing host", u)
+	}
+	return nil
+}
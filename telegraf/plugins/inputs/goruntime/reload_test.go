@@ -0,0 +1,61 @@
+//go:build !windows
+// +build !windows
+
+package goruntime
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/plugins/inputs"
+	"github.com/influxdata/telegraf/testutil"
+)
+
+func TestReloadOnSIGHUP(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "goruntime.json")
+	write := func(url string) {
+		if err := ioutil.WriteFile(path, []byte(`{"urls": ["`+url+`"]}`), 0644); err != nil {
+			t.Fatal(err)
+		}
+		// the change keeps the modification time
+		at := time.Unix(1600000000, 0)
+		if err := os.Chtimes(path, at, at); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("http://a:8080/debug/vars")
+
+	c := inputs.Inputs["goruntime"]().(*GoRuntime)
+	c.Log = testutil.Logger{}
+	c.ReloadFile = path
+	if err := c.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Start(&testutil.Accumulator{}); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop()
+
+	write("http://b:8080/debug/vars")
+	if err := c.reload(); err != nil || c.Urls[0] != "http://a:8080/debug/vars" {
+		t.Fatalf("reloaded %v without SIGHUP: %v", c.Urls, err)
+	}
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); atomic.LoadInt32(&c.reloadForced) == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("SIGHUP not received")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := c.reload(); err != nil || c.Urls[0] != "http://b:8080/debug/vars" {
+		t.Errorf("urls %v after SIGHUP: %v", c.Urls, err)
+	}
+}
@@ -0,0 +1,108 @@
+package goruntime
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/jursonmo/gomonitor/model"
+)
+
+// configure sets the config of the agents of PUT /config/<serial>, or
+// /config/* for all of them, with its version in ?version=N and the
+// config, in the JSON format of the config file of the agent, as body.
+// POST /config/<serial>/rollback rolls them back to the config before.
+// The config is sent to the agents connected and to the ones connecting
+// later with another version, the results are answered by serial.
+func (c *GoRuntime) configure(w http.ResponseWriter, req *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(req.URL.Path, "/config/"), "/")
+	target := parts[0]
+	var m model.ChannelMessage
+	switch {
+	case target == "":
+		http.Error(w, "the path must be /config/<serial>", http.StatusNotFound)
+		return
+	case len(parts) == 2 && parts[1] == "rollback" && req.Method == http.MethodPost:
+		m.Type = model.ChannelRollback
+	case len(parts) == 1 && req.Method == http.MethodPut:
+		version, err := strconv.ParseInt(req.URL.Query().Get("version"), 10, 64)
+		if err != nil || version <= 0 {
+			http.Error(w, "version must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, req.Body, c.ListenMaxBody))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		if !json.Valid(body) {
+			http.Error(w, "the config must be JSON", http.StatusBadRequest)
+			return
+		}
+		m = model.ChannelMessage{Type: model.ChannelConfig, Version: version, Config: body}
+	default:
+		http.Error(w, "PUT /config/<serial>?version=N or POST /config/<serial>/rollback", http.StatusMethodNotAllowed)
+		return
+	}
+
+	l := c.listener
+	l.channelsMu.Lock()
+	if l.configs == nil {
+		l.configs = make(map[string]model.ChannelMessage)
+	}
+	if m.Type == model.ChannelConfig {
+		l.configs[target] = m
+	} else {
+		// the agents keep the config they rolled back to when reconnecting
+		delete(l.configs, target)
+	}
+	var targets []*channel
+	for serial, ch := range l.channels {
+		if serial == target {
+			targets = append(targets, ch)
+		} else if _, own := l.configs[serial]; target == "*" && !own {
+			targets = append(targets, ch)
+		}
+	}
+	l.channelsMu.Unlock()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	results := make(map[string]model.ChannelMessage, len(targets))
+	for _, ch := range targets {
+		wg.Add(1)
+		go func(ch *channel) {
+			defer wg.Done()
+			res := c.sendConfig(ch, m)
+			mu.Lock()
+			results[ch.serial] = res
+			mu.Unlock()
+		}(ch)
+	}
+	wg.Wait()
+	what := m.Type
+	if m.Type == model.ChannelConfig {
+		what = "config version " + strconv.FormatInt(m.Version, 10)
+	}
+	c.Log.Infof("[config=%s] %s by %s to %d agents", target, what, req.RemoteAddr, len(targets))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+// sendConfig sends the config, or rollback, to the agent and returns its
+// result
+func (c *GoRuntime) sendConfig(ch *channel, m model.ChannelMessage) model.ChannelMessage {
+	m.ID = strconv.FormatInt(atomic.AddInt64(&commandID, 1), 10)
+	res, err := ch.send(m, c.Timeout.Duration)
+	if err != nil {
+		res = model.ChannelMessage{Type: model.ChannelResult, ID: m.ID, Result: err.Error()}
+	}
+	if !res.OK {
+		c.Log.Warnf("[channel=%s] %s: %s", ch.serial, m.Type, res.Result)
+	}
+	return res
+}
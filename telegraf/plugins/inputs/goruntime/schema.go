@@ -0,0 +1,436 @@
+package goruntime
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jursonmo/gomonitor/model"
+)
+
+// genericSchema is the JSON Schema of the payload of the runtimes other
+// than Go, which report their heap and gc instead of the memstats
+const genericSchema = `{
+  "type": "object",
+  "required": ["runtime", "heap", "gc"],
+  "properties": {
+    "serial": {"type": "string"},
+    "runtime": {"type": "string"},
+    "schemaVersion": {"type": "integer"},
+    "cpuNum": {"type": "integer"},
+    "threadNum": {"type": "integer"},
+    "cpuPercent": {"type": "integer"},
+    "memPercent": {"type": "integer"},
+    "startTime": {"type": "integer"},
+    "uptime": {"type": "integer"},
+    "seq": {"type": "integer"},
+    "labels": {"type": "object"},
+    "heap": {
+      "type": "object",
+      "required": ["used"],
+      "properties": {
+        "used": {"type": "integer"},
+        "committed": {"type": "integer"},
+        "max": {"type": "integer"},
+        "objects": {"type": "integer"}
+      }
+    },
+    "gc": {
+      "type": "object",
+      "required": ["count"],
+      "properties": {
+        "count": {"type": "integer"},
+        "pauseTotalNs": {"type": "integer"},
+        "lastPauseNs": {"type": "integer"},
+        "cpuFraction": {"type": "number"}
+      }
+    }
+  }
+}`
+
+// schemas are the JSON Schemas of the payload per schemaVersion, a payload
+// without schemaVersion is version 1. Only type, required, properties and
+// items are used, type being a name or a list of names.
+var schemas = map[int64]string{
+	1: `{
+  "type": "object",
+  "required": ["cpuNum", "threadNum", "goroutineNum", "memstats"],
+  "properties": {
+    "serial": {"type": "string"},
+    "runtime": {"type": "string"},
+    "schemaVersion": {"type": "integer"},
+    "cpuNum": {"type": "integer"},
+    "threadNum": {"type": "integer"},
+    "goroutineNum": {"type": "integer"},
+    "cgoCalls": {"type": "integer"},
+    "cpuPercent": {"type": "integer"},
+    "memPercent": {"type": "integer"},
+    "gcPercent": {"type": "integer"},
+    "memoryLimit": {"type": "integer"},
+    "clock": {"type": "integer"},
+    "monotonic": {"type": "integer"},
+    "startTime": {"type": "integer"},
+    "uptime": {"type": "integer"},
+    "seq": {"type": "integer"},
+    "panics": {"type": "integer"},
+    "lastPanic": {"type": "string"},
+    "labels": {"type": "object"},
+    "events": {
+      "type": ["array", "null"],
+      "items": {
+        "type": "object",
+        "required": ["time", "action"],
+        "properties": {
+          "time": {"type": "integer"},
+          "who": {"type": "string"},
+          "action": {"type": "string"},
+          "result": {"type": "string"},
+          "ok": {"type": "boolean"}
+        }
+      }
+    },
+    "ebpf": {
+      "type": ["object", "null"],
+      "properties": {
+        "syscalls": {"type": "integer"},
+        "offCpuNs": {"type": "integer"},
+        "tcpRetransmits": {"type": "integer"},
+        "error": {"type": "string"}
+      }
+    },
+    "sockets": {
+      "type": ["object", "null"],
+      "properties": {
+        "tcp": {"type": "object"},
+        "udp": {"type": "integer"},
+        "listenQueue": {"type": "integer"},
+        "listenDrops": {"type": "integer"}
+      }
+    },
+    "procIO": {
+      "type": ["object", "null"],
+      "properties": {
+        "readBytes": {"type": "integer"},
+        "writeBytes": {"type": "integer"},
+        "readSyscalls": {"type": "integer"},
+        "writeSyscalls": {"type": "integer"}
+      }
+    },
+    "threads": {
+      "type": ["array", "null"],
+      "items": {
+        "type": "object",
+        "required": ["tid", "cpuNs"],
+        "properties": {
+          "tid": {"type": "integer"},
+          "name": {"type": "string"},
+          "cpuNs": {"type": "integer"}
+        }
+      }
+    },
+    "placement": {
+      "type": ["object", "null"],
+      "properties": {
+        "cpus": {"type": "string"},
+        "cpuCount": {"type": "integer"},
+        "memNodes": {"type": "string"},
+        "cgroupCpus": {"type": "string"},
+        "numa": {"type": ["object", "null"]}
+      }
+    },
+    "paging": {
+      "type": ["object", "null"],
+      "properties": {
+        "minorFaults": {"type": "integer"},
+        "majorFaults": {"type": "integer"},
+        "swapBytes": {"type": "integer"},
+        "hostSwapTotal": {"type": "integer"},
+        "hostSwapUsed": {"type": "integer"},
+        "hostSwapIns": {"type": "integer"},
+        "hostSwapOuts": {"type": "integer"}
+      }
+    },
+    "pressure": {"type": ["object", "null"]},
+    "host": {
+      "type": ["object", "null"],
+      "properties": {
+        "load1": {"type": "number"},
+        "load5": {"type": "number"},
+        "load15": {"type": "number"},
+        "memTotal": {"type": "integer"},
+        "memAvailable": {"type": "integer"},
+        "cpuSteal": {"type": "number"}
+      }
+    },
+    "hw": {
+      "type": ["object", "null"],
+      "properties": {
+        "temps": {"type": ["object", "null"]},
+        "cpus": {"type": "integer"},
+        "cpuFreqMHz": {"type": "number"},
+        "cpuLimitMHz": {"type": "number"},
+        "cpuMaxFreqMHz": {"type": "number"},
+        "throttleCount": {"type": "integer"}
+      }
+    },
+    "slo": {
+      "type": ["object", "null"],
+      "properties": {
+        "target": {"type": "number"},
+        "shortBurnRate": {"type": "number"},
+        "longBurnRate": {"type": "number"}
+      }
+    },
+    "gcEvents": {
+      "type": ["array", "null"],
+      "items": {
+        "type": "object",
+        "required": ["cycle", "end", "pauseNs"],
+        "properties": {
+          "cycle": {"type": "integer"},
+          "end": {"type": "integer"},
+          "pauseNs": {"type": "integer"},
+          "heapGoal": {"type": "integer"},
+          "heapAfter": {"type": "integer"},
+          "forced": {"type": "boolean"}
+        }
+      }
+    },
+    "allocSites": {
+      "type": ["array", "null"],
+      "items": {
+        "type": "object",
+        "required": ["function", "bytesPerSec"],
+        "properties": {
+          "function": {"type": "string"},
+          "bytesPerSec": {"type": "number"},
+          "objectsPerSec": {"type": "number"}
+        }
+      }
+    },
+    "offHeap": {
+      "type": ["object", "null"],
+      "properties": {
+        "finalizersPending": {"type": "integer"},
+        "finalizersRun": {"type": "integer"},
+        "cgoEstimated": {"type": "integer"}
+      }
+    },
+    "timers": {
+      "type": "object",
+      "properties": {
+        "activeEstimate": {"type": "integer"},
+        "sleeping": {"type": "integer"},
+        "tickers": {"type": "integer"}
+      }
+    },
+    "queues": {"type": ["object", "null"]},
+    "pools": {"type": ["object", "null"]},
+    "memOS": {
+      "type": ["object", "null"],
+      "properties": {
+        "rss": {"type": "integer"},
+        "pss": {"type": "integer"},
+        "anon": {"type": "integer"},
+        "file": {"type": "integer"},
+        "shared": {"type": "integer"},
+        "private": {"type": "integer"}
+      }
+    },
+    "log": {
+      "type": "object",
+      "properties": {
+        "errors": {"type": "integer"},
+        "warns": {"type": "integer"},
+        "errorRate": {"type": "number"},
+        "warnRate": {"type": "number"}
+      }
+    },
+    "memstats": {
+      "type": "object",
+      "required": ["Alloc", "TotalAlloc", "Sys", "Mallocs", "Frees", "HeapAlloc", "HeapSys",
+        "HeapIdle", "HeapInuse", "HeapReleased", "HeapObjects", "StackInuse", "StackSys",
+        "NextGC", "LastGC", "PauseTotalNs", "PauseNs", "NumGC", "GCCPUFraction"],
+      "properties": {
+        "Alloc": {"type": "integer"},
+        "TotalAlloc": {"type": "integer"},
+        "Sys": {"type": "integer"},
+        "Lookups": {"type": "integer"},
+        "Mallocs": {"type": "integer"},
+        "Frees": {"type": "integer"},
+        "HeapAlloc": {"type": "integer"},
+        "HeapSys": {"type": "integer"},
+        "HeapIdle": {"type": "integer"},
+        "HeapInuse": {"type": "integer"},
+        "HeapReleased": {"type": "integer"},
+        "HeapObjects": {"type": "integer"},
+        "StackInuse": {"type": "integer"},
+        "StackSys": {"type": "integer"},
+        "MSpanInuse": {"type": "integer"},
+        "MSpanSys": {"type": "integer"},
+        "MCacheInuse": {"type": "integer"},
+        "MCacheSys": {"type": "integer"},
+        "BuckHashSys": {"type": "integer"},
+        "GCSys": {"type": "integer"},
+        "OtherSys": {"type": "integer"},
+        "NextGC": {"type": "integer"},
+        "LastGC": {"type": "integer"},
+        "PauseTotalNs": {"type": "integer"},
+        "PauseNs": {"type": "array", "items": {"type": "integer"}},
+        "PauseEnd": {"type": "array", "items": {"type": "integer"}},
+        "NumGC": {"type": "integer"},
+        "NumForcedGC": {"type": "integer"},
+        "GCCPUFraction": {"type": "number"},
+        "EnableGC": {"type": "boolean"},
+        "DebugGC": {"type": "boolean"}
+      }
+    }
+  }
+}`,
+}
+
+type schema struct {
+	Type       types              `json:"type"`
+	Required   []string           `json:"required"`
+	Properties map[string]*schema `json:"properties"`
+	Items      *schema            `json:"items"`
+}
+
+// validate checks the payload, an object or an array of objects, against
+// the schema of its schemaVersion
+func validate(body []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return err
+	}
+	if items, ok := v.([]interface{}); ok {
+		for i, item := range items {
+			if err := validateVersion(item, fmt.Sprintf("/%d", i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return validateVersion(v, "")
+}
+
+func validateVersion(v interface{}, path string) error {
+	version := int64(1)
+	rt := model.RuntimeGo
+	if m, ok := v.(map[string]interface{}); ok {
+		if n, ok := m["schemaVersion"].(json.Number); ok {
+			version, _ = n.Int64()
+		}
+		if s, ok := m["runtime"].(string); ok && s != "" {
+			rt = s
+		}
+	}
+	doc, ok := schemas[version]
+	if !ok {
+		return fmt.Errorf("%s: unsupported schemaVersion %d, supported %s", path, version, supportedVersions())
+	}
+	if rt != model.RuntimeGo {
+		doc = genericSchema
+	}
+	var s schema
+	if err := json.Unmarshal([]byte(doc), &s); err != nil {
+		return err
+	}
+	return s.validate(v, path)
+}
+
+// types are the names of the types a value may have
+type types []string
+
+func (t *types) UnmarshalJSON(b []byte) error {
+	var name string
+	if err := json.Unmarshal(b, &name); err == nil {
+		*t = types{name}
+		return nil
+	}
+	return json.Unmarshal(b, (*[]string)(t))
+}
+
+func (s *schema) validate(v interface{}, path string) error {
+	if len(s.Type) > 0 && !hasType(v, s.Type) {
+		return fmt.Errorf("%s: expected %s, got %s", pathOrRoot(path), strings.Join(s.Type, " or "), typeOf(v))
+	}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for _, k := range s.Required {
+			if _, ok := v[k]; !ok {
+				return fmt.Errorf("%s: missing required %q", pathOrRoot(path), k)
+			}
+		}
+		keys := make([]string, 0, len(s.Properties))
+		for k := range s.Properties {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if e, ok := v[k]; ok {
+				if err := s.Properties[k].validate(e, path+"/"+k); err != nil {
+					return err
+				}
+			}
+		}
+	case []interface{}:
+		if s.Items != nil {
+			for i, e := range v {
+				if err := s.Items.validate(e, fmt.Sprintf("%s/%d", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func hasType(v interface{}, ts types) bool {
+	got := typeOf(v)
+	for _, t := range ts {
+		if t == got || t == "number" && got == "integer" {
+			return true
+		}
+	}
+	return false
+}
+
+func typeOf(v interface{}) string {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case json.Number:
+		if strings.ContainsAny(string(v), ".eE") {
+			return "number"
+		}
+		return "integer"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	}
+	return "null"
+}
+
+func pathOrRoot(path string) string {
+	if path == "" {
+		return "/"
+	}
+	return path
+}
+
+func supportedVersions() string {
+	var vs []string
+	for v := range schemas {
+		vs = append(vs, fmt.Sprint(v))
+	}
+	sort.Strings(vs)
+	return strings.Join(vs, ", ")
+}
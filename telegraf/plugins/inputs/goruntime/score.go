@@ -0,0 +1,74 @@
+package goruntime
+
+import (
+	"fmt"
+
+	"github.com/jursonmo/gomonitor/model"
+)
+
+// defaultSaturationWeights weigh the components of score.saturation
+var defaultSaturationWeights = map[string]float64{
+	"cpu":        1,
+	"gc":         1,
+	"goroutines": 1,
+	"heap":       1,
+}
+
+// gcBudget is the GC CPU fraction saturating the gc component, the 25% of
+// the CPU the Go GC takes during a cycle
+const gcBudget = 0.25
+
+func checkSaturationWeights(weights map[string]float64) error {
+	for name, w := range weights {
+		if _, ok := defaultSaturationWeights[name]; !ok {
+			return fmt.Errorf("invalid saturation_weights %q: must be cpu, gc, goroutines or heap", name)
+		}
+		if w < 0 {
+			return fmt.Errorf("invalid saturation_weights %q = %g: must not be negative", name, w)
+		}
+	}
+	return nil
+}
+
+// saturation returns the weighted average of the components in 0-1, as a
+// score in 0-100: the CPU used of the CPUs, the GC CPU fraction of its
+// budget, the growth of the goroutines since the last sample and the heap
+// of the memory limit. A component which is not known, e.g. the heap
+// without a limit, is left out.
+func (c *GoRuntime) saturation(f *model.Fields, st *appState) (float64, bool) {
+	weights := c.SaturationWeights
+	if weights == nil {
+		weights = defaultSaturationWeights
+	}
+
+	components := make(map[string]float64, 4)
+	cpus := f.NumCpu
+	if cpus <= 0 {
+		cpus = 1
+	}
+	components["cpu"] = float64(f.CpuPercent) / float64(100*cpus)
+	components["gc"] = f.GCCPUFraction / gcBudget
+	if st.lastGoroutines > 0 {
+		components["goroutines"] = float64(f.NumGoroutine-st.lastGoroutines) / float64(st.lastGoroutines)
+	}
+	st.lastGoroutines = f.NumGoroutine
+	if f.MemoryLimit > 0 {
+		components["heap"] = float64(f.HeapAlloc) / float64(f.MemoryLimit)
+	}
+
+	var sum, total float64
+	for name, v := range components {
+		w := weights[name]
+		if v < 0 {
+			v = 0
+		} else if v > 1 {
+			v = 1
+		}
+		sum += w * v
+		total += w
+	}
+	if total == 0 {
+		return 0, false
+	}
+	return 100 * sum / total, true
+}
@@ -0,0 +1,70 @@
+package goruntime
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/jursonmo/gomonitor/model"
+)
+
+// checkPayloadKeys validates the keys of payload_keys, the hex encoded
+// AES keys or references to them
+func checkPayloadKeys(keys map[string]string) error {
+	for id, v := range keys {
+		if err := checkSecret("payload_keys."+id, v); err != nil {
+			return err
+		}
+		if secretRef.MatchString(v) {
+			continue
+		}
+		if _, err := decodePayloadKey(v); err != nil {
+			return fmt.Errorf("invalid payload_keys %q: %s", id, err)
+		}
+	}
+	return nil
+}
+
+func decodePayloadKey(v string) ([]byte, error) {
+	key, err := hex.DecodeString(v)
+	if err != nil {
+		return nil, errors.New("must be hex encoded")
+	}
+	switch len(key) {
+	case 16, 24, 32:
+		return key, nil
+	}
+	return nil, fmt.Errorf("must have 16, 24 or 32 bytes, not %d", len(key))
+}
+
+// payloadKey returns the key of the key id of a sealed payload
+func (c *GoRuntime) payloadKey(id string) ([]byte, error) {
+	v, ok := c.PayloadKeys[id]
+	if !ok {
+		return nil, errors.New("unknown key id")
+	}
+	v, err := c.secret(v)
+	if err != nil {
+		return nil, err
+	}
+	return decodePayloadKey(v)
+}
+
+// unseal decrypts a sealed payload, plain ones are refused when
+// require_encryption is set
+func (c *GoRuntime) unseal(body []byte) ([]byte, error) {
+	if !model.IsSealed(body) {
+		if c.RequireEncryption {
+			return nil, &scrapeError{failureDecrypt, errors.New("plain payload, require_encryption is set")}
+		}
+		return body, nil
+	}
+	if len(c.PayloadKeys) == 0 {
+		return nil, &scrapeError{failureDecrypt, errors.New("sealed payload, no payload_keys")}
+	}
+	payload, err := model.Open(body, c.payloadKey)
+	if err != nil {
+		return nil, &scrapeError{failureDecrypt, err}
+	}
+	return payload, nil
+}
@@ -0,0 +1,281 @@
+package goruntime
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// secretRef is a reference to a secret in place of a credential,
+// @{store:key} like the secret-stores of telegraf: @{env:NAME},
+// @{file:/path}, @{vault:mount/data/path#field} or
+// @{awssm:secret-id#field}, the field optional for AWS Secrets Manager
+var secretRef = regexp.MustCompile(`^@\{([a-z]+):(.+)\}$`)
+
+// secretTTL is how long a secret is used before it is read again, so a
+// rotated secret is picked up without a restart
+const secretTTL = 5 * time.Minute
+
+type cachedSecret struct {
+	value string
+	at    time.Time
+}
+
+type secretCache struct {
+	sync.Mutex
+	values map[string]cachedSecret
+}
+
+// checkSecret validates a credential, plain or a reference
+func checkSecret(option, v string) error {
+	m := secretRef.FindStringSubmatch(v)
+	if m == nil {
+		return nil
+	}
+	switch m[1] {
+	case "env", "file":
+	case "vault":
+		if !strings.Contains(m[2], "#") {
+			return fmt.Errorf("%s: vault reference %q must be path#field", option, v)
+		}
+	case "awssm":
+		// the aws credentials read the awssm secrets
+		if strings.HasPrefix(option, "aws_") {
+			return fmt.Errorf("%s: must not reference an awssm secret", option)
+		}
+	default:
+		return fmt.Errorf("%s: unknown secret store %q, must be env, file, vault or awssm", option, m[1])
+	}
+	return nil
+}
+
+// secret returns the credential, read from its store when it is a
+// reference
+func (c *GoRuntime) secret(v string) (string, error) {
+	m := secretRef.FindStringSubmatch(v)
+	if m == nil {
+		return v, nil
+	}
+	c.secrets.Lock()
+	s, ok := c.secrets.values[v]
+	c.secrets.Unlock()
+	if ok && time.Since(s.at) < secretTTL {
+		return s.value, nil
+	}
+
+	var value string
+	var err error
+	switch store, key := m[1], m[2]; store {
+	case "env":
+		var ok bool
+		if value, ok = os.LookupEnv(key); !ok {
+			err = errors.New("not set")
+		}
+	case "file":
+		var b []byte
+		b, err = ioutil.ReadFile(key)
+		value = strings.TrimRight(string(b), "\r\n")
+	case "vault":
+		value, err = c.vaultSecret(key)
+	case "awssm":
+		value, err = c.awsSecret(key)
+	default:
+		err = errors.New("unknown store")
+	}
+	if err != nil {
+		return "", fmt.Errorf("secret %s: %s", v, err)
+	}
+	c.secrets.Lock()
+	defer c.secrets.Unlock()
+	if c.secrets.values == nil {
+		c.secrets.values = make(map[string]cachedSecret)
+	}
+	c.secrets.values[v] = cachedSecret{value: value, at: time.Now()}
+	return value, nil
+}
+
+// vaultSecret reads the field of a KV secret of Vault, key is
+// path#field, e.g. secret/data/gomonitor#password for the KV v2 engine
+// mounted at secret
+func (c *GoRuntime) vaultSecret(key string) (string, error) {
+	i := strings.LastIndexByte(key, '#')
+	path, field := key[:i], key[i+1:]
+	addr := c.VaultAddress
+	if addr == "" {
+		addr = os.Getenv("VAULT_ADDR")
+	}
+	if addr == "" {
+		return "", fmt.Errorf("no vault_address nor VAULT_ADDR")
+	}
+	token := os.Getenv("VAULT_TOKEN")
+	if c.VaultTokenFile != "" {
+		b, err := ioutil.ReadFile(c.VaultTokenFile)
+		if err != nil {
+			return "", err
+		}
+		token = strings.TrimSpace(string(b))
+	}
+
+	req, err := http.NewRequestWithContext(c.requestContext(), http.MethodGet, strings.TrimRight(addr, "/")+"/v1/"+strings.TrimLeft(path, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	client := http.Client{Timeout: c.Timeout.Duration}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault status code %d", resp.StatusCode)
+	}
+	// KV v2 nests the secret in data.data, KV v1 in data
+	var body struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", err
+	}
+	data := body.Data
+	if nested, ok := data["data"]; ok {
+		var v2 map[string]json.RawMessage
+		if json.Unmarshal(nested, &v2) == nil {
+			data = v2
+		}
+	}
+	raw, ok := data[field]
+	if !ok {
+		return "", fmt.Errorf("no field %q", field)
+	}
+	var value string
+	if err = json.Unmarshal(raw, &value); err != nil {
+		return "", fmt.Errorf("field %q is not a string", field)
+	}
+	return value, nil
+}
+
+// awsSecret reads the SecretString of a secret of AWS Secrets Manager,
+// or its field when key is secret-id#field, signed with the aws
+// credentials. The region is the one of the secret ARN, else
+// AWSSecretsRegion, else AWS_REGION.
+func (c *GoRuntime) awsSecret(key string) (string, error) {
+	id, field := key, ""
+	if i := strings.LastIndexByte(key, '#'); i >= 0 {
+		id, field = key[:i], key[i+1:]
+	}
+	region := c.AWSSecretsRegion
+	if arn := strings.Split(id, ":"); len(arn) > 3 && arn[0] == "arn" {
+		region = arn[3]
+	}
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	if region == "" {
+		return "", fmt.Errorf("no region in the secret ARN nor aws_secrets_region nor AWS_REGION")
+	}
+	cred, err := c.awsCredentials()
+	if err != nil {
+		return "", err
+	}
+
+	endpoint := c.AWSSecretsEndpoint
+	if endpoint == "" {
+		endpoint = "https://secretsmanager." + region + ".amazonaws.com/"
+	}
+	body, err := json.Marshal(map[string]string{"SecretId": id})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(c.requestContext(), http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	signV4Body(req, body, cred, region, "secretsmanager", time.Now())
+	client := http.Client{Timeout: c.Timeout.Duration}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("secrets manager status code %d", resp.StatusCode)
+	}
+	var secret struct {
+		SecretString *string `json:"SecretString"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return "", err
+	}
+	if secret.SecretString == nil {
+		return "", fmt.Errorf("no SecretString, binary secrets are not supported")
+	}
+	if field == "" {
+		return *secret.SecretString, nil
+	}
+	var fields map[string]json.RawMessage
+	if err = json.Unmarshal([]byte(*secret.SecretString), &fields); err != nil {
+		return "", fmt.Errorf("SecretString is not a JSON object: %s", err)
+	}
+	raw, ok := fields[field]
+	if !ok {
+		return "", fmt.Errorf("no field %q", field)
+	}
+	var value string
+	if err = json.Unmarshal(raw, &value); err != nil {
+		return "", fmt.Errorf("field %q is not a string", field)
+	}
+	return value, nil
+}
+
+// setAuth sets the credentials of the request: its SigV4 signature, or
+// else the OAuth2 or configured bearer token, or basic auth
+func (c *GoRuntime) setAuth(req *http.Request) error {
+	if c.AWSRegion != "" {
+		cred, err := c.awsCredentials()
+		if err != nil {
+			return err
+		}
+		signV4(req, cred, c.AWSRegion, c.AWSService, time.Now())
+		return nil
+	}
+	if c.OAuth2TokenURL != "" {
+		token, err := c.oauth2AccessToken()
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		return nil
+	}
+	if c.BearerToken != "" {
+		token, err := c.secret(c.BearerToken)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		return nil
+	}
+	if c.Username == "" && c.Password == "" {
+		return nil
+	}
+	username, err := c.secret(c.Username)
+	if err != nil {
+		return err
+	}
+	password, err := c.secret(c.Password)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(username, password)
+	return nil
+}
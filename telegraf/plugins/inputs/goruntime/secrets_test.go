@@ -0,0 +1,64 @@
+package goruntime
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/influxdata/telegraf/plugins/inputs"
+	"github.com/influxdata/telegraf/testutil"
+)
+
+func TestAWSSecret(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var in struct{ SecretId string }
+		json.NewDecoder(req.Body).Decode(&in)
+		if req.Header.Get("X-Amz-Target") != "secretsmanager.GetSecretValue" ||
+			!strings.HasPrefix(req.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") ||
+			!strings.Contains(req.Header.Get("Authorization"), "/eu-west-3/secretsmanager/aws4_request") {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		secrets := map[string]string{
+			"plain": "s3cret",
+			"arn:aws:secretsmanager:eu-west-3:123456789012:secret:gomonitor": `{"password": "pa55"}`,
+		}
+		s, ok := secrets[in.SecretId]
+		if !ok {
+			http.Error(w, "not found", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"SecretString": s})
+	}))
+	defer srv.Close()
+
+	c := inputs.Inputs["goruntime"]().(*GoRuntime)
+	c.Log = testutil.Logger{}
+	c.AWSAccessKey, c.AWSSecretKey = "AKID", "secret"
+	c.AWSSecretsRegion = "eu-west-3"
+	c.AWSSecretsEndpoint = srv.URL
+
+	for ref, want := range map[string]string{
+		"@{awssm:plain}": "s3cret",
+		"@{awssm:arn:aws:secretsmanager:eu-west-3:123456789012:secret:gomonitor#password}": "pa55",
+	} {
+		got, err := c.secret(ref)
+		if err != nil || got != want {
+			t.Errorf("%s = %q, %v, want %q", ref, got, err, want)
+		}
+	}
+	for _, ref := range []string{"@{awssm:missing}", "@{awssm:plain#field}"} {
+		if _, err := c.secret(ref); err == nil {
+			t.Errorf("%s: no error", ref)
+		}
+	}
+
+	if err := checkSecret("aws_secret_key", "@{awssm:plain}"); err == nil {
+		t.Error("aws_secret_key may reference an awssm secret")
+	}
+	if err := checkSecret("password", "@{awssm:plain}"); err != nil {
+		t.Error(err)
+	}
+}
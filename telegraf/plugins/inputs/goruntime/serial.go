@@ -0,0 +1,66 @@
+package goruntime
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// the handling of an invalid serial
+const (
+	serialInvalidTag    = "tag"
+	serialInvalidReject = "reject"
+)
+
+// invalidSerial replaces the serials failing the rules with tag
+const invalidSerial = "invalid"
+
+// serialRules normalize and validate the serials
+type serialRules struct {
+	trim      bool
+	lowercase bool
+	maxLength int
+	pattern   *regexp.Regexp
+}
+
+// newSerialRules returns the rules of the config, nil for none
+func (c *GoRuntime) newSerialRules() (*serialRules, error) {
+	if !c.SerialTrim && !c.SerialLowercase && c.SerialMaxLength == 0 && c.SerialPattern == "" {
+		return nil, nil
+	}
+	switch c.SerialInvalid {
+	case "", serialInvalidTag, serialInvalidReject:
+	default:
+		return nil, fmt.Errorf("invalid serial_invalid %q: must be %q or %q", c.SerialInvalid, serialInvalidTag, serialInvalidReject)
+	}
+	if c.SerialMaxLength < 0 {
+		return nil, fmt.Errorf("invalid serial_max_length %d: must not be negative", c.SerialMaxLength)
+	}
+	r := &serialRules{trim: c.SerialTrim, lowercase: c.SerialLowercase, maxLength: c.SerialMaxLength}
+	if c.SerialPattern != "" {
+		// the pattern matches the whole serial
+		p, err := regexp.Compile("^(?:" + c.SerialPattern + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid serial_pattern: %s", err)
+		}
+		r.pattern = p
+	}
+	return r, nil
+}
+
+// apply returns the serial normalized, or why it is invalid
+func (r *serialRules) apply(serial string) (string, error) {
+	if r.trim {
+		serial = strings.TrimSpace(serial)
+	}
+	if r.lowercase {
+		serial = strings.ToLower(serial)
+	}
+	if r.maxLength > 0 && len(serial) > r.maxLength {
+		return serial, fmt.Errorf("serial %q longer than %d", snippet([]byte(serial)), r.maxLength)
+	}
+	if r.pattern != nil && !r.pattern.MatchString(serial) {
+		return serial, fmt.Errorf("serial %q does not match serial_pattern", snippet([]byte(serial)))
+	}
+	return serial, nil
+}
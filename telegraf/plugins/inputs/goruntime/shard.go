@@ -0,0 +1,151 @@
+package goruntime
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// shard is the part of the urls gathered by an input out of count inputs
+// configured with the same urls, index is 1-based
+type shard struct {
+	index, count int
+}
+
+// parseShard parses "index/count", "" is the only shard
+func parseShard(s string) (shard, error) {
+	if s == "" {
+		return shard{1, 1}, nil
+	}
+	i := strings.IndexByte(s, '/')
+	if i < 0 {
+		return shard{}, fmt.Errorf("invalid shard %q: must be index/count", s)
+	}
+	index, err1 := strconv.Atoi(s[:i])
+	count, err2 := strconv.Atoi(s[i+1:])
+	if err1 != nil || err2 != nil || count < 1 || index < 1 || index > count {
+		return shard{}, fmt.Errorf("invalid shard %q: must be index/count with 1 <= index <= count", s)
+	}
+	return shard{index, count}, nil
+}
+
+// owns tells if the url belongs to the shard
+func (s shard) owns(url string) bool {
+	if s.count <= 1 {
+		return true
+	}
+	members := make([]string, s.count)
+	for i := range members {
+		members[i] = strconv.Itoa(i + 1)
+	}
+	return owner(members, url) == strconv.Itoa(s.index)
+}
+
+// owner returns the member the url goes to: the one with the highest
+// hash of the member and the url, so every input agrees without talking
+// to the others and a change of members only moves the urls of the
+// members added or removed
+func owner(members []string, url string) string {
+	var best string
+	var bestHash uint64
+	for i, m := range members {
+		h := fnv.New64a()
+		fmt.Fprintf(h, "%s/%s", m, url)
+		if sum := mix(h.Sum64()); i == 0 || sum > bestHash {
+			best, bestHash = m, sum
+		}
+	}
+	return best
+}
+
+// mix is the finalizer of splitmix64, fnv alone spreads the hashes of
+// strings differing in a few bytes poorly
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	return x ^ x>>31
+}
+
+// shardURLs returns the urls of the shard of the input
+func (c *GoRuntime) shardURLs() []string {
+	if c.ShardRegistry != "" {
+		return c.registryURLs()
+	}
+	if c.shard.count <= 1 {
+		return c.Urls
+	}
+	var urls []string
+	for _, u := range c.Urls {
+		if c.shard.owns(u) {
+			urls = append(urls, u)
+		}
+	}
+	return urls
+}
+
+// memberID names the input in the shard registry
+func (c *GoRuntime) memberID() string {
+	h := fnv.New64a()
+	h.Write([]byte(c.consumer))
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// members registers the input in the shard registry and returns the
+// members alive: the ones which registered within shard_ttl. Members gone
+// for long are removed.
+func (c *GoRuntime) members(now time.Time) ([]string, error) {
+	self := c.memberID()
+	path := filepath.Join(c.ShardRegistry, self)
+	if err := ioutil.WriteFile(path, []byte(c.consumer), 0644); err != nil {
+		return nil, err
+	}
+	infos, err := ioutil.ReadDir(c.ShardRegistry)
+	if err != nil {
+		return nil, err
+	}
+	members := []string{self}
+	for _, fi := range infos {
+		name := fi.Name()
+		if name == self || fi.IsDir() || strings.HasPrefix(name, ".") {
+			continue
+		}
+		switch age := now.Sub(fi.ModTime()); {
+		case age < c.ShardTTL.Duration:
+			members = append(members, name)
+		case age > 10*c.ShardTTL.Duration:
+			os.Remove(filepath.Join(c.ShardRegistry, name))
+		}
+	}
+	sort.Strings(members)
+	return members, nil
+}
+
+// registryURLs returns the urls going to the input among the members of
+// the shard registry, all of them when the registry is unusable
+func (c *GoRuntime) registryURLs() []string {
+	members, err := c.members(time.Now())
+	if err != nil {
+		c.Log.Errorf("shard_registry %s: %s, gathering every url", c.ShardRegistry, err)
+		return c.Urls
+	}
+	if strings.Join(members, ",") != strings.Join(c.lastMembers, ",") {
+		c.Log.Infof("shard_registry %s: %d members, rebalancing the urls", c.ShardRegistry, len(members))
+		c.lastMembers = members
+	}
+	self := c.memberID()
+	var urls []string
+	for _, u := range c.Urls {
+		if owner(members, u) == self {
+			urls = append(urls, u)
+		}
+	}
+	return urls
+}
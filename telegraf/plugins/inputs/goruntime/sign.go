@@ -0,0 +1,126 @@
+package goruntime
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/jursonmo/gomonitor/model"
+)
+
+// integrity keeps the nonces of the signatures seen within the max age,
+// to refuse the payloads replayed, and counts the payloads verified and
+// refused
+type integrity struct {
+	sync.Mutex
+	nonces map[string]time.Time
+
+	verified, unsigned, tampered, replayed int64
+}
+
+// checkSigningKeys validates the keys of signing_keys and
+// signing_public_keys, hex encoded or references to them
+func checkSigningKeys(option string, keys map[string]string) error {
+	for id, v := range keys {
+		if err := checkSecret(option+"."+id, v); err != nil {
+			return err
+		}
+		if secretRef.MatchString(v) {
+			continue
+		}
+		if _, err := hex.DecodeString(v); err != nil {
+			return fmt.Errorf("invalid %s %q: must be hex encoded", option, id)
+		}
+	}
+	return nil
+}
+
+// signingKey returns the alg and key of a key id, the key ids of
+// signing_keys are HMAC secrets, of signing_public_keys Ed25519 keys
+func (c *GoRuntime) signingKey(id string) (string, []byte, error) {
+	alg, v := model.SignHMACSHA256, c.SigningKeys[id]
+	if k, ok := c.SigningPublicKeys[id]; ok {
+		alg, v = model.SignEd25519, k
+	} else if _, ok = c.SigningKeys[id]; !ok {
+		return "", nil, fmt.Errorf("unknown key id %q", id)
+	}
+	v, err := c.secret(v)
+	if err != nil {
+		return "", nil, err
+	}
+	key, err := hex.DecodeString(v)
+	if err != nil {
+		return "", nil, fmt.Errorf("key %q must be hex encoded", id)
+	}
+	return alg, key, nil
+}
+
+// verify checks the signature of the body, as received, refusing the
+// ones signed more than signature_max_age away from now or with a nonce
+// seen before
+func (c *GoRuntime) verify(header string, body []byte, now time.Time) error {
+	if header == "" {
+		if !c.RequireSignature {
+			return nil
+		}
+		c.integrity.count(&c.integrity.unsigned)
+		return &scrapeError{failureSignature, errors.New("unsigned payload, require_signature is set")}
+	}
+	s, err := model.ParseSignature(header)
+	if err == nil {
+		var alg string
+		var key []byte
+		if alg, key, err = c.signingKey(s.KeyID); err == nil {
+			err = s.Verify(alg, key, body)
+		}
+	}
+	if err != nil {
+		c.integrity.count(&c.integrity.tampered)
+		return &scrapeError{failureSignature, err}
+	}
+
+	maxAge := c.SignatureMaxAge.Duration
+	signed := time.Unix(0, s.Time)
+	if age := now.Sub(signed); age > maxAge || age < -maxAge {
+		c.integrity.count(&c.integrity.replayed)
+		return &scrapeError{failureReplay, fmt.Errorf("signed at %s, more than %s away", signed.Format(time.RFC3339), maxAge)}
+	}
+	c.integrity.Lock()
+	defer c.integrity.Unlock()
+	for n, t := range c.integrity.nonces {
+		if now.Sub(t) > maxAge {
+			delete(c.integrity.nonces, n)
+		}
+	}
+	if _, ok := c.integrity.nonces[s.KeyID+" "+s.Nonce]; ok {
+		c.integrity.replayed++
+		return &scrapeError{failureReplay, fmt.Errorf("nonce %s seen before", s.Nonce)}
+	}
+	if c.integrity.nonces == nil {
+		c.integrity.nonces = make(map[string]time.Time)
+	}
+	c.integrity.nonces[s.KeyID+" "+s.Nonce] = signed
+	c.integrity.verified++
+	return nil
+}
+
+func (i *integrity) count(n *int64) {
+	i.Lock()
+	defer i.Unlock()
+	*n++
+}
+
+// report emits the payloads verified and refused since the start
+func (i *integrity) report(acc telegraf.Accumulator, measurement string) {
+	i.Lock()
+	defer i.Unlock()
+	acc.AddFields(measurement+"_integrity", map[string]interface{}{
+		"verified": i.verified,
+		"unsigned": i.unsigned,
+		"tampered": i.tampered,
+		"replayed": i.replayed,
+	}, nil)
+}
@@ -0,0 +1,223 @@
+package goruntime
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// awsCredentials sign the requests, Expires is zero for the static ones
+type awsCredentials struct {
+	AccessKeyID     string    `xml:"AccessKeyId"`
+	SecretAccessKey string    `xml:"SecretAccessKey"`
+	SessionToken    string    `xml:"SessionToken"`
+	Expires         time.Time `xml:"Expiration"`
+}
+
+type awsCredentialsCache struct {
+	sync.Mutex
+	assumed awsCredentials
+}
+
+// emptySHA256 is the hash of the empty payload of the scrapes
+const emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// staticAWSCredentials returns the credentials of the config, else of
+// the environment
+func (c *GoRuntime) staticAWSCredentials() (awsCredentials, error) {
+	cred := awsCredentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if c.AWSAccessKey != "" {
+		var err error
+		if cred.AccessKeyID, err = c.secret(c.AWSAccessKey); err != nil {
+			return cred, err
+		}
+		if cred.SecretAccessKey, err = c.secret(c.AWSSecretKey); err != nil {
+			return cred, err
+		}
+		if cred.SessionToken, err = c.secret(c.AWSSessionToken); err != nil {
+			return cred, err
+		}
+	}
+	if cred.AccessKeyID == "" || cred.SecretAccessKey == "" {
+		return cred, fmt.Errorf("no aws credentials: set aws_access_key and aws_secret_key or AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	return cred, nil
+}
+
+// awsCredentials returns the credentials signing the scrapes, of the role
+// of aws_role_arn when set, assumed again 5 minutes before they expire
+func (c *GoRuntime) awsCredentials() (awsCredentials, error) {
+	cred, err := c.staticAWSCredentials()
+	if err != nil || c.AWSRoleARN == "" {
+		return cred, err
+	}
+	c.awsCreds.Lock()
+	defer c.awsCreds.Unlock()
+	if time.Until(c.awsCreds.assumed.Expires) > 5*time.Minute {
+		return c.awsCreds.assumed, nil
+	}
+	assumed, err := c.assumeRole(cred)
+	if err != nil {
+		return assumed, fmt.Errorf("assuming %s: %s", c.AWSRoleARN, err)
+	}
+	c.awsCreds.assumed = assumed
+	return assumed, nil
+}
+
+// assumeRole calls AssumeRole of the regional STS endpoint
+func (c *GoRuntime) assumeRole(cred awsCredentials) (awsCredentials, error) {
+	q := url.Values{
+		"Action":          {"AssumeRole"},
+		"Version":         {"2011-06-15"},
+		"RoleArn":         {c.AWSRoleARN},
+		"RoleSessionName": {"telegraf-goruntime"},
+	}
+	endpoint := c.AWSSTSEndpoint
+	if endpoint == "" {
+		endpoint = "https://sts." + c.AWSRegion + ".amazonaws.com/"
+	}
+	req, err := http.NewRequestWithContext(c.requestContext(), http.MethodGet, endpoint+"?"+q.Encode(), nil)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	signV4(req, cred, c.AWSRegion, "sts", time.Now())
+	client := http.Client{Timeout: c.Timeout.Duration}
+	resp, err := client.Do(req)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return awsCredentials{}, fmt.Errorf("sts status code %d", resp.StatusCode)
+	}
+	var body struct {
+		Credentials awsCredentials `xml:"AssumeRoleResult>Credentials"`
+	}
+	if err = xml.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return awsCredentials{}, err
+	}
+	return body.Credentials, nil
+}
+
+// signV4 signs the request, which has no body, with AWS Signature
+// Version 4
+func signV4(req *http.Request, cred awsCredentials, region, service string, now time.Time) {
+	signV4Body(req, nil, cred, region, service, now)
+}
+
+// signV4Body signs the request of the body
+func signV4Body(req *http.Request, body []byte, cred awsCredentials, region, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	if cred.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", cred.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		if k := strings.ToLower(k); strings.HasPrefix(k, "x-amz-") {
+			headers[k] = strings.TrimSpace(strings.Join(v, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if service != "s3" {
+		segments := strings.Split(path, "/")
+		for i, s := range segments {
+			segments[i] = awsEscape(s)
+		}
+		path = strings.Join(segments, "/")
+	}
+
+	payloadHash := emptySHA256
+	if len(body) > 0 {
+		payloadHash = sha256Hex(string(body))
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex(canonicalRequest)
+
+	key := hmacSHA256([]byte("AWS4"+cred.SecretAccessKey), date)
+	for _, s := range []string{region, service, "aws4_request"} {
+		key = hmacSHA256(key, s)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		cred.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func canonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		values := append([]string(nil), q[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, awsEscape(k)+"="+awsEscape(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// awsEscape escapes all but the unreserved characters of RFC 3986
+func awsEscape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if 'A' <= ch && ch <= 'Z' || 'a' <= ch && ch <= 'z' || '0' <= ch && ch <= '9' || strings.IndexByte("-_.~", ch) >= 0 {
+			b.WriteByte(ch)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", ch)
+		}
+	}
+	return b.String()
+}
+
+func sha256Hex(s string) string {
+	h := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(h[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,120 @@
+package goruntime
+
+// appState is remembered between gathers for every app, an app being a
+// serial behind an url since an aggregating agent serves several apps
+type appState struct {
+	uptime    int64
+	lastEvent int64
+	lastSeq   int64
+
+	// the start time and recent seqs of the agent, to tell the samples
+	// delivered twice, e.g. pushed again by a retry, and the ones
+	// delivered late
+	startTime  int64
+	seen       map[int64]bool
+	duplicates int64
+	outOfOrder int64
+
+	lastGoroutines int64
+	lastGCCycle    int64
+
+	lastNumGC      uint32
+	gcPause        *histogram
+	scrapeDuration *histogram
+
+	// the start time and GC count of the last valid sample
+	qualityStart int64
+	qualityNumGC int64
+}
+
+// appState returns the state of the app, only the goroutine gathering
+// the url may use it
+func (c *GoRuntime) appState(url, serial string) *appState {
+	key := url + "|" + serial
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.states == nil {
+		c.states = make(map[string]*appState)
+	}
+	st, ok := c.states[key]
+	if !ok {
+		st = &appState{}
+		c.states[key] = st
+	}
+	return st
+}
+
+// seqWindow is how many seqs back a sample is told a duplicate
+const seqWindow = 1024
+
+// dropped returns how many samples were lost since the last one, a
+// sequence going back means the agent restarted
+func (st *appState) dropped(seq int64) int64 {
+	var n int64
+	if st.lastSeq != 0 && seq > st.lastSeq+1 {
+		n = seq - st.lastSeq - 1
+	}
+	st.lastSeq = seq
+	return n
+}
+
+// sequence tells if the sample seq of the agent started at start is a
+// duplicate, to drop, or late, older than the last one and filling a gap
+// counted as lost, and else how many samples were lost since the last
+// one. Without a start time a sequence going back
+// means the agent restarted, as the duplicates can't be told apart.
+func (st *appState) sequence(seq, start int64) (duplicate, late bool, dropped int64) {
+	if start == 0 {
+		return false, false, st.dropped(seq)
+	}
+	if start != st.startTime || seq < st.lastSeq-seqWindow {
+		st.startTime, st.lastSeq, st.seen = start, 0, nil
+	}
+	if st.seen[seq] {
+		st.duplicates++
+		return true, false, 0
+	}
+	if st.seen == nil {
+		st.seen = make(map[int64]bool)
+	}
+	st.seen[seq] = true
+	if len(st.seen) > 2*seqWindow {
+		for s := range st.seen {
+			if s < st.lastSeq-seqWindow {
+				delete(st.seen, s)
+			}
+		}
+	}
+	if seq < st.lastSeq {
+		st.outOfOrder++
+		return false, true, 0
+	}
+	return false, false, st.dropped(seq)
+}
+
+// targetState is remembered between gathers for every url
+type targetState struct {
+	etag string
+	// tags of the points emitted by the last payload
+	tags []map[string]string
+
+	breaker breaker
+	health  healthState
+}
+
+// targetState returns the state of the url, only the goroutine gathering
+// the url may use it
+func (c *GoRuntime) targetState(url string) *targetState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.targets == nil {
+		c.targets = make(map[string]*targetState)
+	}
+	t, ok := c.targets[url]
+	if !ok {
+		t = &targetState{}
+		c.targets[url] = t
+	}
+	return t
+}
@@ -0,0 +1,68 @@
+package goruntime
+
+import (
+	"context"
+
+	"github.com/influxdata/telegraf"
+)
+
+// Start makes the input a service input, so telegraf calls Stop on reload
+// and shutdown, and starts the listener
+func (c *GoRuntime) Start(acc telegraf.Accumulator) error {
+	c.inflightMu.Lock()
+	c.stopping = false
+	c.inflightMu.Unlock()
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	if c.ReloadFile != "" {
+		c.stopReload = c.watchReload()
+	}
+	if c.Listen != "" {
+		return c.startListener(acc)
+	}
+	return nil
+}
+
+// Stop cancels the scrapes in flight, waits for the gathers to return and
+// closes the idle connections
+func (c *GoRuntime) Stop() {
+	c.inflightMu.Lock()
+	c.stopping = true
+	c.inflightMu.Unlock()
+	if c.cancel != nil {
+		c.cancel()
+	}
+	c.stopListener()
+	if c.stopReload != nil {
+		c.stopReload()
+		c.stopReload = nil
+	}
+	c.inflight.Wait()
+	c.releaseLease()
+	if c.archive != nil {
+		if err := c.archive.flush(); err != nil {
+			c.Log.Error(err)
+		}
+	}
+	if c.client != nil {
+		c.client.CloseIdleConnections()
+	}
+}
+
+// startGather counts a gather in flight, unless Stop was called
+func (c *GoRuntime) startGather() bool {
+	c.inflightMu.Lock()
+	defer c.inflightMu.Unlock()
+	if c.stopping || c.requestContext().Err() != nil {
+		return false
+	}
+	c.inflight.Add(1)
+	return true
+}
+
+// requestContext returns the context of the requests, canceled by Stop
+func (c *GoRuntime) requestContext() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+	return c.ctx
+}
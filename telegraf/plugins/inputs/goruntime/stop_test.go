@@ -0,0 +1,51 @@
+package goruntime
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/plugins/inputs"
+	"github.com/influxdata/telegraf/testutil"
+)
+
+func TestStopWhileGathering(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		time.Sleep(10 * time.Millisecond)
+		w.Write([]byte(`{"cpuNum": 1}`))
+	}))
+	defer srv.Close()
+
+	c := inputs.Inputs["goruntime"]().(*GoRuntime)
+	c.Log = testutil.Logger{}
+	c.Urls = []string{srv.URL}
+	if err := c.Init(); err != nil {
+		t.Fatal(err)
+	}
+	acc := &testutil.Accumulator{}
+	if err := c.Start(acc); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.Gather(acc)
+		}()
+	}
+	c.Stop()
+	wg.Wait()
+
+	// no gather starts once stopped
+	n := acc.NMetrics()
+	if err := c.Gather(acc); err != nil {
+		t.Fatal(err)
+	}
+	if acc.NMetrics() != n {
+		t.Errorf("gathered %d metrics after Stop", acc.NMetrics()-n)
+	}
+}
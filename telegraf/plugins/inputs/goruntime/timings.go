@@ -0,0 +1,98 @@
+package goruntime
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// timings measures the network phases of a scrape, to tell a slow app
+// apart from a slow network to the app
+type timings struct {
+	mu           sync.Mutex
+	start        time.Time
+	dnsStart     time.Time
+	dns          time.Duration
+	connectStart time.Time
+	connect      time.Duration
+	tlsStart     time.Time
+	tls          time.Duration
+	ttfb         time.Duration
+	total        time.Duration
+}
+
+func (t *timings) trace(req *http.Request) *http.Request {
+	t.start = time.Now()
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.mu.Lock()
+			t.dnsStart = time.Now()
+			t.mu.Unlock()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.mu.Lock()
+			t.dns = time.Since(t.dnsStart)
+			t.mu.Unlock()
+		},
+		ConnectStart: func(_, _ string) {
+			t.mu.Lock()
+			if t.connectStart.IsZero() {
+				t.connectStart = time.Now()
+			}
+			t.mu.Unlock()
+		},
+		ConnectDone: func(_, _ string, err error) {
+			t.mu.Lock()
+			if err == nil && t.connect == 0 {
+				t.connect = time.Since(t.connectStart)
+			}
+			t.mu.Unlock()
+		},
+		TLSHandshakeStart: func() {
+			t.mu.Lock()
+			t.tlsStart = time.Now()
+			t.mu.Unlock()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.mu.Lock()
+			t.tls = time.Since(t.tlsStart)
+			t.mu.Unlock()
+		},
+		GotFirstResponseByte: func() {
+			t.mu.Lock()
+			t.ttfb = time.Since(t.start)
+			t.mu.Unlock()
+		},
+	}
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+}
+
+func (t *timings) done() {
+	t.mu.Lock()
+	t.total = time.Since(t.start)
+	t.mu.Unlock()
+}
+
+// fields returns the measured phases in nanoseconds, phases skipped
+// because of a reused connection are left out
+func (t *timings) fields() map[string]interface{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	fields := map[string]interface{}{
+		"net.ttfb":            int64(t.ttfb),
+		"net.scrape_duration": int64(t.total),
+	}
+	if t.dns > 0 {
+		fields["net.dns"] = int64(t.dns)
+	}
+	if t.connect > 0 {
+		fields["net.connect"] = int64(t.connect)
+	}
+	if t.tls > 0 {
+		fields["net.tls_handshake"] = int64(t.tls)
+	}
+	return fields
+}
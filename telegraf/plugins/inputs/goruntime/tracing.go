@@ -0,0 +1,161 @@
+package goruntime
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// span is a phase of a scrape
+type span struct {
+	name       string
+	start, end time.Time
+	err        error
+}
+
+// scrapeTrace is the trace of a scrape, exported to the OTLP endpoint
+type scrapeTrace struct {
+	traceID [16]byte
+	rootID  [8]byte
+	url     string
+	root    span
+	spans   []span
+}
+
+func newScrapeTrace(url string) *scrapeTrace {
+	t := &scrapeTrace{url: url}
+	rand.Read(t.traceID[:])
+	rand.Read(t.rootID[:])
+	return t
+}
+
+// traceparent is the W3C header continuing the trace in the agent
+func (t *scrapeTrace) traceparent() string {
+	return fmt.Sprintf("00-%x-%x-01", t.traceID, t.rootID)
+}
+
+func (t *scrapeTrace) add(name string, start, end time.Time, err error) {
+	if t == nil || start.IsZero() {
+		return
+	}
+	t.spans = append(t.spans, span{name: name, start: start, end: end, err: err})
+}
+
+// finish ends the scrape span
+func (t *scrapeTrace) finish(start time.Time, err error) {
+	if t == nil {
+		return
+	}
+	t.root = span{name: "scrape", start: start, end: time.Now(), err: err}
+}
+
+// addTimings adds the network phases measured by the timings
+func (t *scrapeTrace) addTimings(tm *timings) {
+	if t == nil || tm == nil {
+		return
+	}
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	if tm.dns > 0 {
+		t.add("dns", tm.dnsStart, tm.dnsStart.Add(tm.dns), nil)
+	}
+	if tm.connect > 0 {
+		t.add("connect", tm.connectStart, tm.connectStart.Add(tm.connect), nil)
+	}
+	if tm.tls > 0 {
+		t.add("tls", tm.tlsStart, tm.tlsStart.Add(tm.tls), nil)
+	}
+	if tm.ttfb > 0 {
+		t.add("ttfb", tm.start, tm.start.Add(tm.ttfb), nil)
+	}
+}
+
+// addTrace keeps the trace of a finished scrape for exportTraces
+func (c *GoRuntime) addTrace(t *scrapeTrace) {
+	if t == nil {
+		return
+	}
+	c.mu.Lock()
+	c.traces = append(c.traces, t)
+	c.mu.Unlock()
+}
+
+// exportTraces posts the traces of the gather to the OTLP/HTTP endpoint
+// in the OTLP JSON encoding
+func (c *GoRuntime) exportTraces() error {
+	c.mu.Lock()
+	traces := c.traces
+	c.traces = nil
+	c.mu.Unlock()
+	if len(traces) == 0 {
+		return nil
+	}
+
+	type kv map[string]interface{}
+	attr := func(k, v string) kv {
+		return kv{"key": k, "value": kv{"stringValue": v}}
+	}
+	nanos := func(t time.Time) string {
+		return strconv.FormatInt(t.UnixNano(), 10)
+	}
+
+	var spans []kv
+	for _, t := range traces {
+		traceID := hex.EncodeToString(t.traceID[:])
+		rootID := hex.EncodeToString(t.rootID[:])
+		for i, s := range append([]span{t.root}, t.spans...) {
+			status := kv{"code": 1}
+			if s.err != nil {
+				status = kv{"code": 2, "message": s.err.Error()}
+			}
+			sp := kv{
+				"traceId":           traceID,
+				"name":              "goruntime." + s.name,
+				"kind":              1,
+				"startTimeUnixNano": nanos(s.start),
+				"endTimeUnixNano":   nanos(s.end),
+				"attributes":        []kv{attr("url.full", t.url)},
+				"status":            status,
+			}
+			// the scrape is the parent of the phases
+			if i == 0 {
+				sp["spanId"] = rootID
+				sp["kind"] = 3
+			} else {
+				var id [8]byte
+				rand.Read(id[:])
+				sp["spanId"] = hex.EncodeToString(id[:])
+				sp["parentSpanId"] = rootID
+			}
+			spans = append(spans, sp)
+		}
+	}
+
+	body, err := json.Marshal(kv{"resourceSpans": []kv{{
+		"resource":   kv{"attributes": []kv{attr("service.name", "telegraf")}},
+		"scopeSpans": []kv{{"scope": kv{"name": "goruntime"}, "spans": spans}},
+	}}})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(c.requestContext(), http.MethodPost, c.OTLPEndpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := &http.Client{Timeout: c.Timeout.Duration}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("status code %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package goruntime
+
+import "fmt"
+
+// byteFields are the fields holding a size in bytes
+var byteFields = []string{
+	"mem.alloc", "mem.total", "mem.sys", "mem.othersys",
+	"mem.heap.alloc", "mem.heap.sys", "mem.heap.idle", "mem.heap.inuse", "mem.heap.released",
+	"mem.stack.inuse", "mem.stack.sys", "mem.stack.mspan_inuse", "mem.stack.mspan_sys",
+	"mem.stack.mcache_inuse", "mem.stack.mcache_sys",
+	"mem.gc.sys", "mem.gc.next", "mem.limit", "mem.cgo.estimated",
+	"mem.os.rss", "mem.os.pss", "mem.os.anon", "mem.os.file", "mem.os.shared", "mem.os.private",
+}
+
+// durationFields are the fields holding a duration in nanoseconds
+var durationFields = []string{
+	"mem.gc.pause_total", "mem.gc.pause",
+	"net.dns", "net.connect", "net.tls_handshake", "net.ttfb", "net.scrape_duration",
+}
+
+func checkUnits(bytesAs, durationsAs string) error {
+	switch bytesAs {
+	case "", "bytes", "mb":
+	default:
+		return fmt.Errorf("invalid bytes_as %q: must be bytes or mb", bytesAs)
+	}
+	switch durationsAs {
+	case "", "ns", "ms":
+	default:
+		return fmt.Errorf("invalid durations_as %q: must be ns or ms", durationsAs)
+	}
+	return nil
+}
+
+// convertUnits rescales the byte and duration fields to the configured
+// units, the converted values become floats
+func (c *GoRuntime) convertUnits(values map[string]interface{}) {
+	if c.BytesAs == "mb" {
+		scale(values, byteFields, 1<<20)
+	}
+	if c.DurationsAs == "ms" {
+		scale(values, durationFields, 1e6)
+	}
+}
+
+func scale(values map[string]interface{}, keys []string, div float64) {
+	for _, k := range keys {
+		if v, ok := values[k].(int64); ok {
+			values[k] = float64(v) / div
+		}
+	}
+}
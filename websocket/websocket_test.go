@@ -0,0 +1,73 @@
+package websocket
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEcho(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		c, err := Accept(w, req)
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		for {
+			msg, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+			c.WriteMessage(msg)
+		}
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c, err := Dial(ctx, "ws"+strings.TrimPrefix(srv.URL, "http"), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the lengths of the three encodings
+	for _, n := range []int{0, 125, 126, 70000} {
+		msg := bytes.Repeat([]byte{'x'}, n)
+		if err = c.WriteMessage(msg); err != nil {
+			t.Fatal(err)
+		}
+		if err = c.Ping(); err != nil {
+			t.Fatal(err)
+		}
+		got, err := c.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, msg) {
+			t.Errorf("echo of %d bytes: got %d bytes", n, len(got))
+		}
+	}
+
+	c.ReadLimit = 10
+	c.WriteMessage(make([]byte, 11))
+	if _, err = c.ReadMessage(); err == nil {
+		t.Error("read a message over the limit")
+	}
+	c.Close()
+
+	if _, err = Dial(ctx, "http"+strings.TrimPrefix(srv.URL, "http"), nil, nil); err == nil {
+		t.Error("dialed an http url")
+	}
+	c, err = Dial(ctx, "ws"+strings.TrimPrefix(srv.URL, "http"), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.conn.Write([]byte{0x88, 0x80, 0, 0, 0, 0})
+	if _, err = c.ReadMessage(); err != io.EOF {
+		t.Errorf("read after close: %v, want EOF", err)
+	}
+}